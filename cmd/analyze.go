@@ -1,20 +1,21 @@
 package cmd
 
 import (
+	"encoding/csv"
 	"encoding/json"
 	"fmt"
 	"io"
-	"io/ioutil"
-	"math"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/MShoaei/techan"
 	"github.com/MShoaei/trader/internal"
-	"github.com/adshao/go-binance/v2"
-	"github.com/sdcoffey/big"
 	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 // newAnalyzeCommand represents the analyze command
@@ -29,15 +30,33 @@ func newAnalyzeCommand() *cobra.Command {
 
 func newCryptoCommand() *cobra.Command {
 	var (
-		input      string
-		fetch      bool
-		strategy   int
-		logFile    string
-		symbol     string
-		risk       float64
-		commission float64
-		leverage   int
-		count      int
+		input       string
+		fetch       bool
+		strategy    string
+		paramValues []string
+		specFile    string
+		logFile     string
+		symbol      string
+		risk        float64
+		leverage    int
+		maintenance float64
+		count       int
+		brackets    bracketFlags
+		fills       fillFlags
+		fees        feeFlags
+		sizers      sizerFlags
+		scalings    scalingFlags
+		dates       dateRange
+		equityOut   string
+		htmlOut     string
+		timeframes  []string
+		benchmark   string
+		runsDir     string
+		noSave      bool
+
+		monteCarlo int
+		seed       int64
+		resample   bool
 	)
 	var analysisFile io.Writer
 	cmd := &cobra.Command{
@@ -47,6 +66,7 @@ func newCryptoCommand() *cobra.Command {
 		PreRunE: func(cmd *cobra.Command, args []string) error {
 			var err error
 			if logFile == "-" {
+				analysisFile = os.Stdout
 				log.SetOutput(os.Stdout)
 				return nil
 			}
@@ -59,152 +79,747 @@ func newCryptoCommand() *cobra.Command {
 			return nil
 		},
 		RunE: func(cmd *cobra.Command, args []string) error {
+			bracket, err := brackets.bracket()
+			if err != nil {
+				return err
+			}
+			fill, err := fills.model(sizers.lotSize())
+			if err != nil {
+				return err
+			}
+			feeModel, err := fees.model()
+			if err != nil {
+				return err
+			}
+			higher, err := parseTimeframes(timeframes)
+			if err != nil {
+				return err
+			}
+			sizer, err := sizers.sizer(risk)
+			if err != nil {
+				return err
+			}
+			scaling, err := scalings.scaling(bracket.HasStop())
+			if err != nil {
+				return err
+			}
+			var info internal.StrategyInfo
+			var params internal.Params
+			var specStrategy internal.MultiTimeframeStrategyFunc
+			var name string
+			switch {
+			case specFile != "":
+				var spec internal.StrategySpec
+				if spec, specStrategy, err = readStrategySpec(specFile, higher); err != nil {
+					return err
+				}
+				name = spec.Name
+			case strategy == "":
+				return fmt.Errorf("either --strategy or --strategy-file is required")
+			default:
+				if info, err = lookupStrategy(strategy); err != nil {
+					return err
+				}
+				if params, err = strategyParams(info, paramValues); err != nil {
+					return err
+				}
+				name = info.Name
+			}
+			bt := &internal.Backtest{
+				Symbol:          symbol,
+				Risk:            risk,
+				Leverage:        leverage,
+				MaintenanceRate: maintenance,
+				Bracket:         bracket,
+				Fees:            feeModel,
+				Capital:         sizers.capital,
+				Sizer:           sizer,
+				Scaling:         scaling,
+				LotSize:         sizers.lotSize(),
+				Fill:            fill,
+				Timeframes:      higher,
+			}
+
 			file, err := os.Open(input)
 			if err != nil {
 				return err
 			}
-			candleC, err := cryptoCandleGenerator(file, count)
+			candleC, err := cryptoCandleGenerator(file, dates, count)
 			if err != nil {
 				return err
 			}
 
 			var record *techan.TradingRecord
 			var series *techan.TimeSeries
-			switch strategy {
-			case 0:
-				series, record = RunDynamicStrategy(internal.CreateBollingerStochStrategy, candleC, symbol, risk, leverage)
-			case 1:
-				series, record = RunDynamicStrategy(internal.CreateMACDStrategy, candleC, symbol, risk, leverage)
-			case 2:
-				series, record = RunDynamicStrategy(internal.CreateEMAStrategy, candleC, symbol, risk, leverage)
-			case 3:
-				series, record = RunDynamicStrategy(internal.CreateIchimokuStrategy, candleC, symbol, risk, leverage)
-			default:
-				return fmt.Errorf("invalid strategy")
-			}
-
-			totalProfit := techan.TotalProfitAnalysis{}.Analyze(record)
-			commissionValue := internal.CommissionAnalysis{Commission: commission}.Analyze(record)
-			openPL := internal.OpenPLAnalysis{LastCandle: series.LastCandle()}.Analyze(record)
-			tradeCount := techan.NumTradesAnalysis{}.Analyze(record)
-			profitableTradeCount := internal.ProfitableTradesAnalysis{}.Analyze(record)
-			log.Infof("Total profit: %f, Commission: %f, PNL: %f",
-				totalProfit,
-				commissionValue,
-				openPL,
-			)
-			log.Infof("Total trades: %d, Profitable trades: %d, Win rate: %f%%",
-				int(tradeCount),
-				int(profitableTradeCount),
-				(profitableTradeCount/tradeCount)*100,
+			if specStrategy != nil {
+				series, record = bt.RunMultiTimeframe(specStrategy, candleC)
+			} else if series, record, err = runStrategy(bt, info, params, candleC); err != nil {
+				return err
+			}
+
+			longRecord, shortRecord := internal.SplitRecord(record)
+			logAnalysis("All", record, series.LastCandle(), feeModel)
+			logAnalysis("Long", longRecord, series.LastCandle(), feeModel)
+			logAnalysis("Short", shortRecord, series.LastCandle(), feeModel)
+			log.Infof("All - Liquidations: %d, Liquidation loss: %f",
+				int(internal.LiquidationsAnalysis{Journal: feeModel.Journal}.Analyze(record)),
+				internal.LiquidationLossAnalysis{Fees: feeModel}.Analyze(record),
 			)
-			log.Infof("Win streak: %d, Lose streak: %d", int(internal.WinStreakAnalysis{}.Analyze(record)), int(internal.LoseStreakAnalysis{}.Analyze(record)))
-			log.Infof("Max win: %f, Max loss: %f", internal.MaxWinAnalysis{}.Analyze(record), internal.MaxLossAnalysis{}.Analyze(record))
-			log.Infof("Average win: %f, Average loss: %f", internal.AverageWinAnalysis{}.Analyze(record), internal.AverageLossAnalysis{}.Analyze(record))
+
+			margin := sizers.capital
+			if margin <= 0 {
+				margin = risk
+			}
+			equity := internal.EquityCurve(series, record, feeModel)
+			logBenchmark(internal.NewBenchmark("Buy and hold", equity, margin, leverage, series.Candles))
+			if benchmark != "" {
+				file, err := os.Open(benchmark)
+				if err != nil {
+					return err
+				}
+				candles, err := readCandles(file, 0)
+				file.Close()
+				if err != nil {
+					return err
+				}
+				name := strings.TrimSuffix(filepath.Base(benchmark), filepath.Ext(benchmark))
+				logBenchmark(internal.NewBenchmark(name, equity, margin, leverage, candles))
+			}
+
+			if monteCarlo > 0 {
+				report := internal.MonteCarlo{
+					Iterations: monteCarlo,
+					Seed:       seed,
+					Fees:       feeModel,
+					Resample:   resample,
+				}.Run(record)
+				logMonteCarlo(report, record, feeModel)
+			}
 
 			internal.LogTradesAnalysis{
 				Writer: analysisFile,
+				Fees:   feeModel,
 			}.Analyze(record)
-			return nil
+
+			if !noSave {
+				data, err := internal.HashData(input)
+				if err != nil {
+					return err
+				}
+				run := internal.NewRun(name, symbol, runParams(cmd.Flags()), data, record, feeModel)
+				if err := (internal.RunStore{Dir: runsDir}).Save(&run); err != nil {
+					return err
+				}
+				log.Infof("saved run %s", run.ID)
+			}
+
+			if equityOut != "" {
+				if err := writeEquityCurve(equityOut, equity); err != nil {
+					return err
+				}
+			}
+			if htmlOut == "" {
+				return nil
+			}
+			overlays, clouds := reportOverlays(info.Name, params, series)
+			return writeHTMLReport(htmlOut, internal.HTMLReport{
+				Title:    fmt.Sprintf("%s strategy %s", symbol, name),
+				Series:   series,
+				Record:   record,
+				Fees:     feeModel,
+				Overlays: overlays,
+				Clouds:   clouds,
+			})
 		},
 	}
 	f := cmd.Flags()
-	f.StringVarP(&input, "input", "i", "", "path to json file to read data from")
+	f.StringVarP(&input, "input", "i", "", "path to a json, binance csv or zip archive file of klines to read data from")
 	f.BoolVarP(&fetch, "fetch", "f", false, "if data should be downloaded")
-	f.IntVar(&strategy, "strategy", 0, "the strategy to use for analysis")
-	_ = cmd.MarkFlagRequired("strategy")
+	f.StringVar(&strategy, "strategy", "", "name or number of the strategy to use for analysis. see 'trader strategies list'")
+	f.StringArrayVarP(&paramValues, "param", "p", nil, "parameter of the strategy as name=value e.g. fast=20. can be repeated")
+	f.StringVar(&specFile, "strategy-file", "", "path to a yaml or json strategy definition to use instead of --strategy")
 	f.StringVarP(&logFile, "output", "o", "-", "path to file to write analysis data use '-' if you want to print to stdout")
 	f.StringVarP(&symbol, "symbol", "s", "", "symbol of the test")
 	_ = cmd.MarkFlagRequired("symbol")
 	f.Float64VarP(&risk, "risk", "r", 25.0, "total value of the position in USD including leverage. e.g. if the risk is 100$ and leverage is 25X the position would be 4$")
 	_ = cmd.MarkFlagRequired("risk")
-	f.Float64VarP(&commission, "commission", "c", 0.04, "commission per trade in percent")
 	f.IntVarP(&leverage, "leverage", "l", 1, "account leverage")
+	f.Float64Var(&maintenance, "maintenance-margin", 0.5, "maintenance margin rate in percent. positions are liquidated when their loss leaves less margin")
 	f.IntVar(&count, "count", 0, "use the latest 'count' candles. 0 means all")
+	dates.register(f)
+	brackets.register(f)
+	fills.register(f)
+	fees.register(f)
+	sizers.register(f)
+	scalings.register(f)
+	f.StringVar(&equityOut, "equity-out", "", "path to a file to write the equity curve to. written as json if the path ends with .json, csv otherwise")
+	f.StringArrayVar(&timeframes, "timeframe", nil, "higher timeframe series of the strategy as name=duration, e.g. trend=4h, derived from the input or name=path of a file of klines to read it from. can be repeated")
+	f.StringVar(&benchmark, "benchmark", "", "path to a file of klines of a second asset to compare the backtest with, e.g. BTCUSDT. buy and hold on the tested symbol is always reported")
+	f.StringVar(&htmlOut, "html", "", "path to an html file to write a report with charts of the backtest to")
+	f.StringVar(&runsDir, "runs-dir", defaultRunsDir, "directory the run is saved to. see 'analyze runs'")
+	f.BoolVar(&noSave, "no-save", false, "do not save the run")
+	f.IntVar(&monteCarlo, "monte-carlo", 0, "number of Monte Carlo iterations run on the closed trades. 0 disables the simulation")
+	f.Int64Var(&seed, "seed", 1, "seed of the Monte Carlo simulation")
+	f.BoolVar(&resample, "resample", false, "draw the trades of the Monte Carlo simulation with replacement instead of shuffling them")
 	return cmd
 }
 
-// RunDynamicStrategy runs the analysis using a strategy with dynamic exit rules.
-// A exit rule with fixed stop loss and/or take profit price is not a dynamic strategy.
-func RunDynamicStrategy(f internal.DynamicStrategyFunc, candleC chan *techan.Candle, symbol string, risk float64, leverage int) (*techan.TimeSeries, *techan.TradingRecord) {
-	series := techan.NewTimeSeries()
-	record := techan.NewTradingRecord()
-	long, _ := f(series)
-	index := 0
-	for candle := range candleC {
-		series.AddCandle(candle)
-
-		if long.ShouldEnter(series.LastIndex(), record) {
-			log.Debugf("entering long at price: %f", candle.ClosePrice.Float())
-			log.Debugln(index, candle)
-			record.Operate(techan.Order{
-				Side:          techan.BUY,
-				Security:      symbol,
-				Price:         candle.ClosePrice,
-				Amount:        CalculateAmount(big.NewDecimal(risk), candle.ClosePrice, big.NewFromInt(leverage)),
-				ExecutionTime: candle.Period.Start,
-			})
-		} else if record.CurrentPosition().IsLong() && long.ShouldExit(series.LastIndex(), record) {
-			log.Debugf("exiting at price: %f", candle.ClosePrice.Float())
-			log.Debugln(index, candle)
-			record.Operate(techan.Order{
-				Side:          techan.SELL,
-				Security:      symbol,
-				Price:         candle.ClosePrice,
-				Amount:        record.CurrentPosition().EntranceOrder().Amount,
-				ExecutionTime: candle.Period.Start,
-			})
+// bracketFlags holds the values of the flags describing the bracket of a backtest.
+type bracketFlags struct {
+	stopPercent float64
+	takePercent float64
+	stopATR     float64
+	takeATR     float64
+	rewardRisk  float64
+	bothHit     string
+}
+
+func (b *bracketFlags) register(f *pflag.FlagSet) {
+	f.Float64Var(&b.stopPercent, "sl", 0, "stop loss distance in percent of the entry price. 0 means no stop loss")
+	f.Float64Var(&b.takePercent, "tp", 0, "take profit distance in percent of the entry price. 0 means no take profit")
+	f.Float64Var(&b.stopATR, "sl-atr", 0, "stop loss distance as a multiple of ATR. used if --sl is not set")
+	f.Float64Var(&b.takeATR, "tp-atr", 0, "take profit distance as a multiple of ATR. used if --tp is not set")
+	f.Float64Var(&b.rewardRisk, "rr", 0, "take profit distance as a multiple of the stop loss distance. used if neither --tp nor --tp-atr is set")
+	f.StringVar(&b.bothHit, "both-hit", "stop", "level assumed to be hit first when a candle touches both stop loss and take profit. one of stop, target or nearest")
+}
+
+func (b *bracketFlags) bracket() (internal.Bracket, error) {
+	policy, err := internal.ParseBothHitPolicy(b.bothHit)
+	if err != nil {
+		return internal.Bracket{}, err
+	}
+	return internal.Bracket{
+		StopPercent: b.stopPercent,
+		TakePercent: b.takePercent,
+		StopATR:     b.stopATR,
+		TakeATR:     b.takeATR,
+		RewardRisk:  b.rewardRisk,
+		BothHit:     policy,
+	}, nil
+}
+
+// fillFlags holds the values of the flags describing the fill model of a backtest.
+type fillFlags struct {
+	name          string
+	slippage      float64
+	fixedSlippage float64
+	participation float64
+	limitOffset   float64
+	limitExpiry   int
+}
+
+func (fl *fillFlags) register(f *pflag.FlagSet) {
+	f.StringVar(&fl.name, "fill", "close", "how orders are filled. one of close (signal candle close), next-open (next candle open) or limit (limit order at the signal candle close)")
+	f.Float64Var(&fl.slippage, "slippage", 0, "slippage of every fill in percent of the price")
+	f.Float64Var(&fl.fixedSlippage, "fixed-slippage", 0, "slippage of every fill in price units")
+	f.Float64Var(&fl.participation, "participation", 0, "maximum amount of an entry in percent of the volume of the candle it is filled on. 0 means no limit")
+	f.Float64Var(&fl.limitOffset, "limit-offset", 0, "distance of limit orders from the signal candle close in percent, in favor of the order")
+	f.IntVar(&fl.limitExpiry, "limit-expiry", 0, "number of candles after which an unfilled limit order is cancelled. 0 means never")
+}
+
+// model returns the fill model of the flags. entries capped by the participation are rounded with lotSize.
+func (fl *fillFlags) model(lotSize internal.LotSize) (internal.FillModel, error) {
+	var model internal.FillModel
+	switch fl.name {
+	case "close":
+		model = internal.CloseFill{}
+	case "next-open":
+		model = internal.NextOpenFill{}
+	case "limit":
+		model = internal.LimitFill{Offset: fl.limitOffset, Expiry: fl.limitExpiry}
+	default:
+		return nil, fmt.Errorf("invalid fill model: %s", fl.name)
+	}
+	if fl.slippage > 0 || fl.fixedSlippage > 0 {
+		model = internal.Slippage{Model: model, Percent: fl.slippage, Fixed: fl.fixedSlippage}
+	}
+	if fl.participation > 0 {
+		model = internal.VolumeCap{Model: model, Participation: fl.participation, LotSize: lotSize}
+	}
+	return model, nil
+}
+
+// sizerFlags holds the values of the flags describing how positions are sized.
+type sizerFlags struct {
+	name          string
+	capital       float64
+	percent       float64
+	atrMultiplier float64
+	kellyFraction float64
+	kellyCap      float64
+	minTrades     int
+	stepSize      float64
+	minQty        float64
+	maxQty        float64
+}
+
+func (s *sizerFlags) register(f *pflag.FlagSet) {
+	f.StringVar(&s.name, "sizer", "fixed", "how positions are sized. one of fixed (--risk USD of margin), equity (percent of the equity), fractional (lose percent of the equity at the stop loss), volatility (lose percent of the equity on a move of --atr-multiplier ATR) or kelly")
+	f.Float64Var(&s.capital, "capital", 0, "starting equity of the account in USD. required by every sizer except fixed")
+	f.Float64Var(&s.percent, "size-percent", 1, "percent of the equity used by the equity, fractional and volatility sizers. the kelly sizer uses it until --kelly-min-trades trades are closed")
+	f.Float64Var(&s.atrMultiplier, "atr-multiplier", 1, "multiple of ATR used by the volatility sizer")
+	f.Float64Var(&s.kellyFraction, "kelly-fraction", 0.5, "fraction of the Kelly criterion used by the kelly sizer")
+	f.Float64Var(&s.kellyCap, "kelly-cap", 25, "maximum margin of the kelly sizer in percent of the equity")
+	f.IntVar(&s.minTrades, "kelly-min-trades", 20, "number of closed trades needed before the kelly sizer uses the Kelly criterion")
+	f.Float64Var(&s.stepSize, "step-size", 0.001, "step size the amounts are rounded down to")
+	f.Float64Var(&s.minQty, "min-qty", 0, "minimum amount of a position. smaller entries are skipped")
+	f.Float64Var(&s.maxQty, "max-qty", 0, "maximum amount of a position. 0 means no limit")
+}
+
+// sizer returns the sizer described by the flags. the fixed sizer uses risk USD of margin.
+func (s *sizerFlags) sizer(risk float64) (internal.Sizer, error) {
+	if s.name != "fixed" && s.capital <= 0 {
+		return nil, fmt.Errorf("the %s sizer needs a positive --capital", s.name)
+	}
+	switch s.name {
+	case "fixed":
+		return internal.FixedSizer{Margin: risk}, nil
+	case "equity":
+		return internal.EquitySizer{Percent: s.percent}, nil
+	case "fractional":
+		return internal.FixedFractionalSizer{Percent: s.percent}, nil
+	case "volatility":
+		return internal.VolatilitySizer{Percent: s.percent, Multiplier: s.atrMultiplier}, nil
+	case "kelly":
+		return internal.KellySizer{Fraction: s.kellyFraction, Cap: s.kellyCap, MinTrades: s.minTrades, Percent: s.percent}, nil
+	}
+	return nil, fmt.Errorf("invalid sizer: %s", s.name)
+}
+
+func (s *sizerFlags) lotSize() internal.LotSize {
+	return internal.LotSize{Step: s.stepSize, Min: s.minQty, Max: s.maxQty}
+}
+
+// scalingFlags holds the values of the flags describing how positions are scaled in and out.
+type scalingFlags struct {
+	entries  int
+	targets  []string
+	trailATR float64
+}
+
+func (sc *scalingFlags) register(f *pflag.FlagSet) {
+	f.IntVar(&sc.entries, "entries", 1, "maximum number of entries of a position. entry signals add to an open position until it is reached")
+	f.StringArrayVar(&sc.targets, "target", nil, "partial take profit as distance=percent of the amount entered, e.g. 1R=50 at 1 times the stop loss distance or 2%=50 at 2 percent of the entry price. can be repeated")
+	f.Float64Var(&sc.trailATR, "trail-atr", 0, "trail the stop loss of the rest of a position this multiple of ATR behind the close once its first target is taken. 0 disables it")
+}
+
+// scaling returns the scaling described by the flags for positions which have a stop loss if hasStop is true.
+func (sc *scalingFlags) scaling(hasStop bool) (internal.Scaling, error) {
+	scaling := internal.Scaling{Entries: sc.entries, TrailATR: sc.trailATR}
+	for _, value := range sc.targets {
+		parts := strings.SplitN(value, "=", 2)
+		if len(parts) != 2 {
+			return scaling, fmt.Errorf("invalid target %q. e.g. 1R=50", value)
+		}
+		var target internal.Target
+		distance := strings.ToUpper(parts[0])
+		var err error
+		switch {
+		case strings.HasSuffix(distance, "R"):
+			target.R, err = strconv.ParseFloat(strings.TrimSuffix(distance, "R"), 64)
+		case strings.HasSuffix(distance, "%"):
+			target.Gain, err = strconv.ParseFloat(strings.TrimSuffix(distance, "%"), 64)
+		default:
+			err = fmt.Errorf("missing R or %% suffix")
 		}
-		index++
+		if err != nil {
+			return scaling, fmt.Errorf("invalid target %q: %v", value, err)
+		}
+		if target.Percent, err = strconv.ParseFloat(parts[1], 64); err != nil || target.Percent <= 0 {
+			return scaling, fmt.Errorf("invalid target %q. the percent must be positive", value)
+		}
+		scaling.Targets = append(scaling.Targets, target)
 	}
-	return series, record
+	return scaling, scaling.Validate(hasStop)
+}
+
+// feeFlags holds the values of the flags describing the fee model of a backtest.
+type feeFlags struct {
+	flags       *pflag.FlagSet
+	commission  float64
+	maker       float64
+	taker       float64
+	vip         int
+	bnbDiscount float64
+	funding     string
 }
 
-func CalculateAmount(total big.Decimal, price big.Decimal, leverage big.Decimal) big.Decimal {
-	amount := total.Div(price.Div(leverage)).Float()
-	return big.NewDecimal(math.Floor(amount*1000) / 1000)
+func (fe *feeFlags) register(f *pflag.FlagSet) {
+	fe.flags = f
+	f.Float64VarP(&fe.commission, "commission", "c", 0.04, "commission per trade in percent. used as both the maker and the taker rate")
+	f.Float64Var(&fe.maker, "maker", 0, "maker rate in percent. overrides --commission and --vip")
+	f.Float64Var(&fe.taker, "taker", 0, "taker rate in percent. overrides --commission and --vip")
+	f.IntVar(&fe.vip, "vip", -1, "use the maker and taker rates of the binance futures VIP tier instead of --commission. -1 disables it")
+	f.Float64Var(&fe.bnbDiscount, "bnb-discount", 0, "discount of the fees in percent when they are paid with BNB")
+	f.StringVar(&fe.funding, "funding", "", "path to a json file of funding rates in the format of the binance funding rate history")
 }
 
-func cryptoCandleGenerator(input io.Reader, count int) (candleC chan *techan.Candle, err error) {
-	candleC = make(chan *techan.Candle)
-	b, err := ioutil.ReadAll(input)
+// model returns the fee model described by the flags. every order pays the maker or the taker rate depending on
+// how it is filled.
+func (fe *feeFlags) model() (internal.FeeModel, error) {
+	fees := internal.FlatFee(fe.commission)
+	if fe.vip >= 0 {
+		var err error
+		if fees, err = internal.VIPFee(fe.vip); err != nil {
+			return internal.FeeModel{}, err
+		}
+	}
+	if fe.flags.Changed("maker") {
+		fees.Maker = fe.maker
+	}
+	if fe.flags.Changed("taker") {
+		fees.Taker = fe.taker
+	}
+	fees.BNBDiscount = fe.bnbDiscount
+	fees.Journal = internal.NewJournal()
+
+	if fe.funding != "" {
+		file, err := os.Open(fe.funding)
+		if err != nil {
+			return internal.FeeModel{}, err
+		}
+		defer file.Close()
+		if fees.Funding, err = internal.ReadFundingRates(file); err != nil {
+			return internal.FeeModel{}, err
+		}
+	}
+	return fees, nil
+}
+
+// dateRange selects the candles opening from the time of --from until before the time of --to.
+type dateRange struct {
+	from, to string
+}
+
+func (d *dateRange) register(f *pflag.FlagSet) {
+	f.StringVar(&d.from, "from", "", "use the candles opening from this UTC date or time e.g. 2021-01-01 or 2021-01-01T12:00")
+	f.StringVar(&d.to, "to", "", "use the candles opening before this UTC date or time e.g. 2021-02-01")
+}
+
+func (d *dateRange) filter(candles []*techan.Candle) ([]*techan.Candle, error) {
+	from, err := parseDate(d.from)
 	if err != nil {
 		return nil, err
 	}
-	data := make([]*binance.Kline, 0)
-	if err := json.Unmarshal(b, &data); err != nil {
+	to, err := parseDate(d.to)
+	if err != nil {
 		return nil, err
 	}
-	data = data[len(data)-count:]
-	go func() {
-		defer close(candleC)
+	filtered := make([]*techan.Candle, 0, len(candles))
+	for _, candle := range candles {
+		if candle.Period.Start.Before(from) || (!to.IsZero() && !candle.Period.Start.Before(to)) {
+			continue
+		}
+		filtered = append(filtered, candle)
+	}
+	return filtered, nil
+}
 
-		c := 0
-		for _, candle := range data {
-			data := &techan.Candle{
-				Period: techan.TimePeriod{
-					Start: time.Unix(candle.OpenTime/1e3, (candle.OpenTime%1e3)*1e3),
-					End:   time.Unix(candle.CloseTime/1e3, (candle.CloseTime%1e3)*1e3),
-				},
-				OpenPrice:  big.NewFromString(candle.Open),
-				ClosePrice: big.NewFromString(candle.Close),
-				MaxPrice:   big.NewFromString(candle.High),
-				MinPrice:   big.NewFromString(candle.Low),
-				Volume:     big.NewFromString(candle.Volume),
-				TradeCount: uint(candle.TradeNum),
-			}
+// parseDate parses a UTC date or time. An empty value is the zero time.
+func parseDate(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	for _, layout := range []string{"2006-01-02", "2006-01-02T15:04", "2006-01-02T15:04:05", time.RFC3339} {
+		if t, err := time.ParseInLocation(layout, value, time.UTC); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date %q. e.g. 2021-01-01 or 2021-01-01T12:00", value)
+}
+
+func parseTimeframes(values []string) (map[string]internal.Timeframe, error) {
+	timeframes := make(map[string]internal.Timeframe, len(values))
+	for _, value := range values {
+		parts := strings.SplitN(value, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid timeframe %q. expected name=duration or name=path", value)
+		}
+		if period, err := time.ParseDuration(parts[1]); err == nil {
+			timeframes[parts[0]] = internal.Timeframe{Period: period}
+			continue
+		}
+		file, err := os.Open(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		candles, err := readCandles(file, 0)
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+		timeframes[parts[0]] = internal.Timeframe{Candles: candles}
+	}
+	return timeframes, nil
+}
+
+// lookupStrategy returns the strategy registered as name. Strategies can also be given by their number in the
+// order of 'trader strategies list'.
+func lookupStrategy(name string) (internal.StrategyInfo, error) {
+	if n, err := strconv.Atoi(name); err == nil {
+		strategies := internal.Strategies()
+		if n < 0 || n >= len(strategies) {
+			return internal.StrategyInfo{}, fmt.Errorf("invalid strategy %d", n)
+		}
+		return strategies[n], nil
+	}
+	return internal.LookupStrategy(name)
+}
+
+// strategyParams returns the parameters of info with the name=value pairs of values replacing their defaults.
+func strategyParams(info internal.StrategyInfo, values []string) (internal.Params, error) {
+	overrides := make(internal.Params, len(values))
+	for _, value := range values {
+		parts := strings.SplitN(value, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid parameter %q. expected name=value", value)
+		}
+		v, err := strconv.ParseFloat(parts[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid parameter %q: %v", value, err)
+		}
+		overrides[parts[0]] = v
+	}
+	return info.Params(overrides)
+}
 
-			// ticker := time.NewTicker(2 * time.Second)
-			// <-ticker.C
-			candleC <- data
-			c++
+// checkStrategy reports why info can not be backtested by bt, if it can not.
+func checkStrategy(bt *internal.Backtest, info internal.StrategyInfo) error {
+	if info.Static != nil && !bt.Bracket.HasStop() && !bt.Bracket.HasTake() {
+		return fmt.Errorf("strategy %s only exits through the bracket. set a stop loss or take profit", info.Name)
+	}
+	for _, name := range info.Timeframes {
+		if _, ok := bt.Timeframes[name]; !ok {
+			return fmt.Errorf("strategy %s needs a %s timeframe. e.g. --timeframe %s=4h", info.Name, name, name)
 		}
-	}()
-	return candleC, nil
+	}
+	return nil
+}
+
+// runStrategy backtests info using params with bt.
+func runStrategy(bt *internal.Backtest, info internal.StrategyInfo, params internal.Params, candleC <-chan *techan.Candle) (*techan.TimeSeries, *techan.TradingRecord, error) {
+	if err := checkStrategy(bt, info); err != nil {
+		return nil, nil, err
+	}
+	if info.Static != nil {
+		series, record := bt.RunStatic(info.Static, candleC)
+		return series, record, nil
+	}
+	series, record := bt.RunMultiTimeframe(info.New(params), candleC)
+	return series, record, nil
+}
+
+// readStrategySpec reads the strategy definition at path and compiles it. The timeframes of the definition missing
+// from timeframes are added to it, derived from the base series.
+func readStrategySpec(path string, timeframes map[string]internal.Timeframe) (internal.StrategySpec, internal.MultiTimeframeStrategyFunc, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return internal.StrategySpec{}, nil, err
+	}
+	defer file.Close()
+	spec, err := internal.ReadStrategySpec(file)
+	if err != nil {
+		return spec, nil, fmt.Errorf("%s: %v", path, err)
+	}
+	for name, interval := range spec.Timeframes {
+		if _, ok := timeframes[name]; ok {
+			continue
+		}
+		period, err := internal.IntervalDuration(interval)
+		if err != nil {
+			return spec, nil, err
+		}
+		timeframes[name] = internal.Timeframe{Period: period}
+	}
+	f, err := spec.Compile()
+	return spec, f, err
+}
+
+// paramStrategy returns the parameterized constructor and the default parameters of the strategy named name.
+func paramStrategy(name string) (internal.ParamStrategyFunc, internal.StrategyInfo, error) {
+	info, err := lookupStrategy(name)
+	if err != nil {
+		return nil, info, err
+	}
+	f, err := info.ParamStrategy()
+	return f, info, err
+}
+
+// logAnalysis logs the result of the analyses on record prefixed with name.
+func logAnalysis(name string, record *techan.TradingRecord, lastCandle *techan.Candle, fees internal.FeeModel) {
+	totalProfit := techan.TotalProfitAnalysis{}.Analyze(record)
+	commissionValue := internal.CommissionAnalysis{Fees: fees}.Analyze(record)
+	fundingValue := internal.FundingAnalysis{Fees: fees}.Analyze(record)
+	openPL := internal.OpenPLAnalysis{LastCandle: lastCandle, Fees: fees}.Analyze(record)
+	tradeCount := techan.NumTradesAnalysis{}.Analyze(record)
+	profitableTradeCount := internal.ProfitableTradesAnalysis{Fees: fees}.Analyze(record)
+	log.Infof("%s - Total profit: %f, Commission: %f, Funding: %f, Net profit: %f, PNL: %f",
+		name,
+		totalProfit,
+		commissionValue,
+		fundingValue,
+		internal.TotalProfitAnalysis{Fees: fees}.Analyze(record),
+		openPL,
+	)
+	log.Infof("%s - Total trades: %d, Profitable trades: %d, Win rate: %f%%",
+		name,
+		int(tradeCount),
+		int(profitableTradeCount),
+		(profitableTradeCount/tradeCount)*100,
+	)
+	log.Infof("%s - Win streak: %d, Lose streak: %d", name, int(internal.WinStreakAnalysis{Fees: fees}.Analyze(record)), int(internal.LoseStreakAnalysis{Fees: fees}.Analyze(record)))
+	log.Infof("%s - Max win: %f, Max loss: %f", name, internal.MaxWinAnalysis{Fees: fees}.Analyze(record), internal.MaxLossAnalysis{Fees: fees}.Analyze(record))
+	log.Infof("%s - Average win: %f, Average loss: %f", name, internal.AverageWinAnalysis{Fees: fees}.Analyze(record), internal.AverageLossAnalysis{Fees: fees}.Analyze(record))
+}
+
+func logBenchmark(b internal.Benchmark) {
+	log.Infof("%s - Strategy return: %f%%, Return: %f%%, Profit: %f, Excess return: %f%%",
+		b.Name, b.StrategyReturn, b.Return, b.Profit, b.Excess)
+	log.Infof("%s - Beta: %f, Correlation: %f, Alpha: %f%%", b.Name, b.Beta, b.Correlation, b.Alpha)
+}
+
+func logMonteCarlo(report internal.MonteCarloReport, record *techan.TradingRecord, fees internal.FeeModel) {
+	logDistribution := func(name string, d internal.Distribution) {
+		log.Infof("Monte Carlo - %s: mean: %f, min: %f, p5: %f, p25: %f, p50: %f, p75: %f, p95: %f, max: %f",
+			name, d.Mean, d.Min, d.P5, d.P25, d.P50, d.P75, d.P95, d.Max)
+	}
+	log.Infof("Monte Carlo - Iterations: %d, Trades: %d", report.Iterations, report.Trades)
+	log.Infof("Monte Carlo - Backtest net profit: %f, Max drawdown: %f, Lose streak: %d",
+		internal.TotalProfitAnalysis{Fees: fees}.Analyze(record),
+		internal.MaxDrawdownAnalysis{Fees: fees}.Analyze(record),
+		int(internal.LoseStreakAnalysis{Fees: fees}.Analyze(record)),
+	)
+	logDistribution("Final profit", report.FinalProfit)
+	logDistribution("Max drawdown", report.MaxDrawdown)
+	logDistribution("Lose streak", report.LoseStreak)
+}
+
+func writeHTMLReport(path string, report internal.HTMLReport) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return report.Write(file)
+}
+
+// reportOverlays returns the indicators of the strategy named name using p drawn over the candles of an html report.
+func reportOverlays(name string, p internal.Params, series *techan.TimeSeries) ([]internal.Overlay, []internal.Cloud) {
+	closePrice := techan.NewClosePriceIndicator(series)
+	switch name {
+	case "bollinger-stoch":
+		return []internal.Overlay{
+			{Name: "BB upper", Color: "#7e57c2", Indicator: techan.NewBollingerUpperBandIndicator(closePrice, p.Int("bb_window"), p["bb_sigma"])},
+			{Name: "BB lower", Color: "#7e57c2", Indicator: techan.NewBollingerLowerBandIndicator(closePrice, p.Int("bb_window"), p["bb_sigma"])},
+		}, nil
+	case "ema", "ema-trend":
+		return []internal.Overlay{
+			{Name: fmt.Sprintf("EMA %d", p.Int("fast")), Color: "#ff9800", Indicator: techan.NewEMAIndicator(closePrice, p.Int("fast"))},
+			{Name: fmt.Sprintf("EMA %d", p.Int("slow")), Color: "#3f51b5", Indicator: techan.NewEMAIndicator(closePrice, p.Int("slow"))},
+		}, nil
+	case "ichimoku":
+		return []internal.Overlay{
+			{Name: "Conversion line", Color: "#2196f3", Indicator: internal.NewConversionLineIndicator(series, p.Int("conversion"))},
+			{Name: "Base line", Color: "#b71c1c", Indicator: internal.NewBaseLineIndicator(series, p.Int("base"))},
+		}, []internal.Cloud{
+			internal.NewIchimokuCloud(series, p),
+		}
+	case "ema-stoch-atr":
+		return []internal.Overlay{
+			{Name: "EMA 8", Color: "#ff9800", Indicator: techan.NewEMAIndicator(closePrice, 8)},
+			{Name: "EMA 14", Color: "#4caf50", Indicator: techan.NewEMAIndicator(closePrice, 14)},
+			{Name: "EMA 50", Color: "#3f51b5", Indicator: techan.NewEMAIndicator(closePrice, 50)},
+		}, nil
+	}
+	return nil, nil
+}
+
+// writeEquityCurve writes points to path as json if path ends with .json and as csv otherwise.
+func writeEquityCurve(path string, points []internal.EquityPoint) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		enc := json.NewEncoder(file)
+		enc.SetIndent("", "  ")
+		return enc.Encode(points)
+	}
+
+	w := csv.NewWriter(file)
+	if err := w.Write([]string{"time", "realized", "open", "equity", "drawdown", "position", "amount", "entry_price"}); err != nil {
+		return err
+	}
+	formatFloat := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	for _, point := range points {
+		err := w.Write([]string{
+			point.Time.UTC().Format(time.RFC3339),
+			formatFloat(point.Realized),
+			formatFloat(point.Open),
+			formatFloat(point.Equity),
+			formatFloat(point.Drawdown),
+			point.Position,
+			formatFloat(point.Amount),
+			formatFloat(point.EntryPrice),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
+
+func cryptoCandleGenerator(input io.Reader, dates dateRange, count int) (candleC <-chan *techan.Candle, err error) {
+	candles, err := readCandles(input, 0)
+	if err != nil {
+		return nil, err
+	}
+	if candles, err = dates.filter(candles); err != nil {
+		return nil, err
+	}
+	candles = latest(candles, count)
+	if len(candles) == 0 {
+		return nil, fmt.Errorf("no candles to analyze")
+	}
+	return internal.CandleChannel(candles), nil
+}
+
+// readCandles reads klines in any format supported by internal.ReadKlines from input and returns the latest count
+// of them as candles. count 0 returns all of them.
+func readCandles(input io.Reader, count int) ([]*techan.Candle, error) {
+	data, err := internal.ReadKlines(input)
+	if err != nil {
+		return nil, err
+	}
+	candles := make([]*techan.Candle, 0, len(data))
+	for _, kline := range data {
+		candles = append(candles, internal.KlineCandle(kline))
+	}
+	return latest(candles, count), nil
+}
+
+// latest returns the latest count candles. count 0 returns all of them.
+func latest(candles []*techan.Candle, count int) []*techan.Candle {
+	if count > 0 && count < len(candles) {
+		return candles[len(candles)-count:]
+	}
+	return candles
 }
 
 func init() {
 	ac := newAnalyzeCommand()
 	rootCmd.AddCommand(ac)
 	ac.AddCommand(newCryptoCommand())
+	ac.AddCommand(newOptimizeCommand())
+	ac.AddCommand(newWalkForwardCommand())
+	ac.AddCommand(newPortfolioCommand())
+	ac.AddCommand(newCompareCommand())
+	ac.AddCommand(newRunsCommand())
+	ac.AddCommand(newGridAnalysisCommand())
+	ac.AddCommand(newDCAAnalysisCommand())
 }
@@ -0,0 +1,249 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/MShoaei/techan"
+	"github.com/MShoaei/trader/internal"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func newCompareCommand() *cobra.Command {
+	var (
+		inputs      []string
+		strategies  []string
+		specFiles   []string
+		objective   string
+		risk        float64
+		leverage    int
+		maintenance float64
+		count       int
+		workers     int
+		format      string
+		output      string
+		timeframes  []string
+		dates       dateRange
+		brackets    bracketFlags
+		fees        feeFlags
+		sizers      sizerFlags
+	)
+	cmd := &cobra.Command{
+		Use:   "compare",
+		Short: "rank strategies by backtesting them on several symbols",
+		Long: `compare backtests every strategy, or the ones given by --strategy and --strategy-file, on every input concurrently
+and prints a leaderboard of every symbol. inputs are given as SYMBOL=path. if the symbol is omitted it is
+taken from the file name, e.g. data/ethusdt.json is ETHUSDT.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			bracket, err := brackets.bracket()
+			if err != nil {
+				return err
+			}
+			feeModel, err := fees.model()
+			if err != nil {
+				return err
+			}
+			sizer, err := sizers.sizer(risk)
+			if err != nil {
+				return err
+			}
+			higher, err := parseTimeframes(timeframes)
+			if err != nil {
+				return err
+			}
+			t := internal.Tournament{
+				Backtest: internal.Backtest{
+					Risk:            risk,
+					Leverage:        leverage,
+					MaintenanceRate: maintenance,
+					Bracket:         bracket,
+					Fees:            feeModel,
+					Capital:         sizers.capital,
+					Sizer:           sizer,
+					LotSize:         sizers.lotSize(),
+					Timeframes:      higher,
+				},
+				Workers: workers,
+			}
+
+			var specEntrants []internal.Entrant
+			for _, path := range specFiles {
+				spec, f, err := readStrategySpec(path, higher)
+				if err != nil {
+					return err
+				}
+				name := spec.Name
+				if name == "" {
+					name = path
+				}
+				specEntrants = append(specEntrants, internal.Entrant{
+					Name: name,
+					Run: func(bt *internal.Backtest, candleC <-chan *techan.Candle) (*techan.TimeSeries, *techan.TradingRecord) {
+						return bt.RunMultiTimeframe(f, candleC)
+					},
+				})
+			}
+			var entrants []internal.Entrant
+			if len(strategies) > 0 || len(specEntrants) == 0 {
+				if entrants, err = compareEntrants(&t.Backtest, strategies); err != nil {
+					return err
+				}
+			}
+			entrants = append(entrants, specEntrants...)
+			markets := make([]internal.Market, 0, len(inputs))
+			for _, input := range inputs {
+				symbol, path := parseSymbolInput(input)
+				file, err := os.Open(path)
+				if err != nil {
+					return err
+				}
+				candles, err := readCandles(file, 0)
+				file.Close()
+				if err != nil {
+					return err
+				}
+				if candles, err = dates.filter(candles); err != nil {
+					return err
+				}
+				markets = append(markets, internal.Market{Symbol: symbol, Candles: latest(candles, count)})
+			}
+
+			log.Infof("running %d strategies on %d symbols", len(entrants), len(markets))
+			standings, err := t.Run(entrants, markets, objective)
+			if err != nil {
+				return err
+			}
+
+			out := os.Stdout
+			if output != "-" {
+				out, err = os.Create(output)
+				if err != nil {
+					return err
+				}
+				defer out.Close()
+			}
+			switch format {
+			case "table":
+				return writeStandingsTable(out, standings)
+			case "csv":
+				return writeStandingsCSV(out, standings)
+			case "json":
+				enc := json.NewEncoder(out)
+				enc.SetIndent("", "  ")
+				return enc.Encode(standings)
+			}
+			return fmt.Errorf("invalid format: %s", format)
+		},
+	}
+	f := cmd.Flags()
+	f.SortFlags = false
+	f.StringArrayVarP(&inputs, "input", "i", nil, "SYMBOL=path of a json, binance csv or zip archive file of klines to read data from. can be repeated")
+	_ = cmd.MarkFlagRequired("input")
+	f.StringSliceVar(&strategies, "strategy", nil, "names or numbers of the strategies to compare e.g. ema,macd. every strategy which can run with the given flags if neither this nor --strategy-file is set")
+	f.StringArrayVar(&specFiles, "strategy-file", nil, "path to a yaml or json strategy definition to compare as well. can be repeated")
+	f.StringVar(&objective, "objective", "profit", "the objective to rank the strategies by. one of "+strings.Join(internal.Objectives, ", "))
+	f.Float64VarP(&risk, "risk", "r", 25.0, "total value of the position in USD including leverage")
+	f.IntVarP(&leverage, "leverage", "l", 1, "account leverage")
+	f.Float64Var(&maintenance, "maintenance-margin", 0.5, "maintenance margin rate in percent. positions are liquidated when their loss leaves less margin")
+	f.IntVar(&count, "count", 0, "use the latest 'count' candles of every input. 0 means all")
+	dates.register(f)
+	f.StringArrayVar(&timeframes, "timeframe", nil, "higher timeframe series of the strategies as name=duration, e.g. trend=4h, derived from every input. can be repeated")
+	f.IntVar(&workers, "workers", 0, "number of backtests to run concurrently. 0 means the number of CPUs")
+	f.StringVar(&format, "format", "table", "output format. one of table, csv or json")
+	f.StringVarP(&output, "output", "o", "-", "path to file to write the leaderboard to. use '-' to print to stdout")
+	brackets.register(f)
+	fees.register(f)
+	sizers.register(f)
+	return cmd
+}
+
+// compareEntrants returns the strategies named by names. every registered strategy which bt can run is returned if
+// names is empty.
+func compareEntrants(bt *internal.Backtest, names []string) ([]internal.Entrant, error) {
+	var strategies []internal.StrategyInfo
+	all := len(names) == 0
+	if all {
+		strategies = internal.Strategies()
+	}
+	for _, name := range names {
+		info, err := lookupStrategy(name)
+		if err != nil {
+			return nil, err
+		}
+		strategies = append(strategies, info)
+	}
+
+	entrants := make([]internal.Entrant, 0, len(strategies))
+	for _, info := range strategies {
+		if err := checkStrategy(bt, info); err != nil {
+			if !all {
+				return nil, err
+			}
+			log.Infof("skipping %v", err)
+			continue
+		}
+		info := info
+		entrants = append(entrants, internal.Entrant{
+			Name: info.Name,
+			Run: func(bt *internal.Backtest, candleC <-chan *techan.Candle) (*techan.TimeSeries, *techan.TradingRecord) {
+				series, record, _ := runStrategy(bt, info, info.Defaults, candleC)
+				return series, record
+			},
+		})
+	}
+	if len(entrants) == 0 {
+		return nil, fmt.Errorf("no strategy to compare")
+	}
+	return entrants, nil
+}
+
+func writeStandingsTable(out io.Writer, standings []internal.Standing) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "symbol\trank\tstrategy\ttrades\twin rate\tnet profit\tmax drawdown\tprofit factor\t")
+	for _, s := range standings {
+		m := s.Metrics
+		fmt.Fprintf(w, "%s\t%d\t%s\t%d\t%.2f%%\t%.4f\t%.4f\t%.2f\t\n",
+			s.Symbol, s.Rank, s.Strategy, m.Trades, m.WinRate, m.NetProfit, m.MaxDrawdown, m.ProfitFactor)
+	}
+	return w.Flush()
+}
+
+func writeStandingsCSV(out io.Writer, standings []internal.Standing) error {
+	w := csv.NewWriter(out)
+	header := []string{"symbol", "rank", "strategy", "trades", "win_rate", "profit", "commission", "funding", "net_profit", "max_drawdown", "profit_factor"}
+	if err := w.Write(header); err != nil {
+		return err
+	}
+	formatFloat := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	for _, s := range standings {
+		m := s.Metrics
+		row := []string{
+			s.Symbol,
+			strconv.Itoa(s.Rank),
+			s.Strategy,
+			strconv.Itoa(m.Trades),
+			formatFloat(m.WinRate),
+			formatFloat(m.Profit),
+			formatFloat(m.Commission),
+			formatFloat(m.Funding),
+			formatFloat(m.NetProfit),
+			formatFloat(m.MaxDrawdown),
+			formatFloat(m.ProfitFactor),
+		}
+		if err := w.Write(row); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
@@ -0,0 +1,90 @@
+package cmd
+
+import (
+	"os"
+	"time"
+
+	"github.com/MShoaei/trader/internal"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// dcaFlags describe a dollar-cost averaging plan. the plan is disabled if --dca-quote is not set.
+type dcaFlags struct {
+	quote      float64
+	every      time.Duration
+	steps      []float64
+	takeProfit float64
+	maxBuys    int
+}
+
+func (d *dcaFlags) register(f *pflag.FlagSet) {
+	f.Float64Var(&d.quote, "dca-quote", 0, "value of every buy of the dollar-cost averaging plan in the quote asset e.g. USDT. trades the plan instead of the strategy if set")
+	f.DurationVar(&d.every, "dca-every", 0, "time between the scheduled buys of the plan e.g. 24h. 0 disables the schedule")
+	f.Float64SliceVar(&d.steps, "dca-steps", nil, "drops in percent under the last buy which buy again e.g. 1,2,4. the last one is repeated")
+	f.Float64Var(&d.takeProfit, "dca-take-profit", 0, "sell the position once the price is this percent over its average entry price. 0 never sells")
+	f.IntVar(&d.maxBuys, "dca-max-buys", 0, "maximum number of buys of a position. 0 means no limit")
+}
+
+// dca returns the plan described by the flags, or nil if it is disabled.
+func (d *dcaFlags) dca() (*internal.DCA, error) {
+	if d.quote == 0 {
+		return nil, nil
+	}
+	plan := &internal.DCA{Quote: d.quote, Every: d.every, Steps: d.steps, TakeProfit: d.takeProfit, MaxBuys: d.maxBuys}
+	return plan, plan.Validate()
+}
+
+func newDCAAnalysisCommand() *cobra.Command {
+	var (
+		input      string
+		symbol     string
+		count      int
+		commission float64
+		dates      dateRange
+		plan       dcaFlags
+		sizers     sizerFlags
+	)
+	cmd := &cobra.Command{
+		Use:   "dca",
+		Short: "backtest a dollar-cost averaging plan",
+		Long: `dca backtests the dollar-cost averaging plan of the watch command on stored klines. every buy is filled at the close
+of the kline it is made on.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			d, err := plan.dca()
+			if err != nil {
+				return err
+			}
+			file, err := os.Open(input)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			candleC, err := cryptoCandleGenerator(file, dates, count)
+			if err != nil {
+				return err
+			}
+
+			fees := internal.FlatFee(commission)
+			bt := &internal.Backtest{Symbol: symbol, Fees: fees, LotSize: sizers.lotSize()}
+			series, record := bt.RunDCA(*d, candleC)
+			logAnalysis("DCA", record, series.LastCandle(), fees)
+			return nil
+		},
+	}
+	f := cmd.Flags()
+	f.SortFlags = false
+	f.StringVarP(&input, "input", "i", "", "path to a json, binance csv or zip archive file of klines to read data from")
+	_ = cmd.MarkFlagRequired("input")
+	f.StringVarP(&symbol, "symbol", "s", "", "the symbol of the klines e.g. ETHUSDT")
+	f.IntVar(&count, "count", 0, "use the latest 'count' candles. 0 means all")
+	dates.register(f)
+	plan.register(f)
+	_ = cmd.MarkFlagRequired("dca-quote")
+	f.Float64VarP(&commission, "commission", "c", 0.1, "commission per order in percent")
+	f.Float64Var(&sizers.stepSize, "step-size", 0.001, "step size the amounts are rounded down to")
+	f.Float64Var(&sizers.minQty, "min-qty", 0, "minimum amount of a buy")
+	f.Float64Var(&sizers.maxQty, "max-qty", 0, "maximum amount of a buy. 0 means no limit")
+	return cmd
+}
@@ -0,0 +1,237 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/MShoaei/trader/internal"
+	"github.com/adshao/go-binance/v2"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// gridFlags describe a grid strategy.
+type gridFlags struct {
+	lower   float64
+	upper   float64
+	levels  int
+	spacing string
+	amount  float64
+	quote   float64
+}
+
+func (g *gridFlags) register(f *pflag.FlagSet) {
+	f.Float64Var(&g.lower, "lower", 0, "lowest price level of the grid")
+	f.Float64Var(&g.upper, "upper", 0, "highest price level of the grid")
+	f.IntVar(&g.levels, "levels", 10, "number of price levels from --lower to --upper, both included")
+	f.StringVar(&g.spacing, "spacing", "arithmetic", "spacing of the levels. arithmetic keeps the same price difference between levels and geometric the same ratio")
+	f.Float64Var(&g.amount, "amount", 0, "quantity of every order in the base asset")
+	f.Float64Var(&g.quote, "quote", 0, "value of every order in the quote asset e.g. USDT. used instead of --amount")
+}
+
+func (g *gridFlags) strategy() (internal.GridStrategy, error) {
+	spacing, err := internal.ParseGridSpacing(g.spacing)
+	if err != nil {
+		return internal.GridStrategy{}, err
+	}
+	return internal.GridStrategy{
+		Lower:   g.lower,
+		Upper:   g.upper,
+		Levels:  g.levels,
+		Spacing: spacing,
+		Amount:  g.amount,
+		Quote:   g.quote,
+	}, nil
+}
+
+func newGridCommand() *cobra.Command {
+	var (
+		symbol     string
+		interval   string
+		commission float64
+		demo       bool
+		grid       gridFlags
+	)
+	cmd := &cobra.Command{
+		Use:   "grid",
+		Short: "trade a grid of resting limit orders on a ranging symbol",
+		Long: `grid rests a buy limit order at every level of the grid under the price. when a buy is filled, what it bought
+is sold by a limit order at the next level up, after which the level is bought again. the fills are checked on
+every closed kline of --interval. the resting orders are cancelled on interrupt.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			g, err := grid.strategy()
+			if err != nil {
+				return err
+			}
+			info, err := client.NewExchangeInfoService().Do(context.Background())
+			if err != nil {
+				return err
+			}
+			var symbolInfo *binance.Symbol
+			for i := range info.Symbols {
+				if info.Symbols[i].Symbol == symbol {
+					symbolInfo = &info.Symbols[i]
+				}
+			}
+			if symbolInfo == nil {
+				return fmt.Errorf("symbol %s not found", symbol)
+			}
+			lotSize, err := internal.NewLotSize(symbolInfo.LotSizeFilter())
+			if err != nil {
+				return err
+			}
+			tickSize, err := internal.NewTickSize(symbolInfo.PriceFilter())
+			if err != nil {
+				return err
+			}
+			klines, err := client.NewKlinesService().Symbol(symbol).Interval(interval).Limit(1).Do(context.Background())
+			if err != nil {
+				return err
+			}
+			if len(klines) == 0 {
+				return fmt.Errorf("no klines of %s", symbol)
+			}
+
+			engine := &internal.GridEngine{
+				Symbol:   symbol,
+				Grid:     g,
+				LotSize:  lotSize,
+				TickSize: tickSize,
+				Fees:     internal.FeeModel{Maker: commission, Taker: commission, Liquidity: internal.Maker},
+				Exchange: &internal.BinanceGridExchange{Client: client, Symbol: symbol, Demo: demo},
+			}
+			if err := engine.Start(internal.KlineCandle(klines[0])); err != nil {
+				return err
+			}
+			defer func() {
+				if err := engine.Stop(); err != nil {
+					log.Errorf("failed to cancel the orders of the grid: %v", err)
+				}
+				logGridReport(symbol, engine.Report())
+			}()
+
+			interruptCh := make(chan os.Signal, 1)
+			signal.Notify(interruptCh, os.Interrupt)
+			defer signal.Stop(interruptCh)
+			errHandler := func(err error) {
+				log.Error(err)
+			}
+			t := time.NewTicker(23 * time.Hour)
+			defer t.Stop()
+		loop:
+			doneC, stopC, err := binance.WsKlineServe(symbol, interval, engine.Handle, errHandler)
+			if err != nil {
+				return err
+			}
+
+			select {
+			case <-doneC:
+			case <-t.C:
+				close(stopC)
+				goto loop
+			case <-interruptCh:
+				close(stopC)
+			}
+			return nil
+		},
+	}
+	f := cmd.Flags()
+	f.SortFlags = false
+	f.StringVarP(&symbol, "symbol", "s", "", "the symbol to trade e.g. ETHUSDT")
+	_ = cmd.MarkFlagRequired("symbol")
+	f.StringVarP(&interval, "interval", "i", "1m", "interval of the klines the fills are checked on")
+	grid.register(f)
+	_ = cmd.MarkFlagRequired("lower")
+	_ = cmd.MarkFlagRequired("upper")
+	f.Float64VarP(&commission, "commission", "c", 0.1, "maker commission per order in percent")
+	f.BoolVar(&demo, "demo", false, "set to only test the orders and simulate their fills")
+	return cmd
+}
+
+func newGridAnalysisCommand() *cobra.Command {
+	var (
+		input      string
+		count      int
+		commission float64
+		tickSize   float64
+		output     string
+		dates      dateRange
+		grid       gridFlags
+		sizers     sizerFlags
+	)
+	cmd := &cobra.Command{
+		Use:   "grid",
+		Short: "backtest a grid of resting limit orders",
+		Long: `grid backtests the grid command on stored klines. the grid starts at the close of the first kline and its
+orders are filled when the low or the high of a later kline reaches their price.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			g, err := grid.strategy()
+			if err != nil {
+				return err
+			}
+			file, err := os.Open(input)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			candles, err := readCandles(file, 0)
+			if err != nil {
+				return err
+			}
+			if candles, err = dates.filter(candles); err != nil {
+				return err
+			}
+			candles = latest(candles, count)
+
+			fees := internal.FeeModel{Maker: commission, Taker: commission, Liquidity: internal.Maker}
+			report, err := internal.BacktestGrid(g, candles, sizers.lotSize(), internal.TickSize{Step: tickSize}, fees)
+			if err != nil {
+				return err
+			}
+			logGridReport("Grid", report)
+			if output == "" {
+				return nil
+			}
+			out, err := os.Create(output)
+			if err != nil {
+				return err
+			}
+			defer out.Close()
+			enc := json.NewEncoder(out)
+			enc.SetIndent("", "  ")
+			return enc.Encode(report)
+		},
+	}
+	f := cmd.Flags()
+	f.SortFlags = false
+	f.StringVarP(&input, "input", "i", "", "path to a json, binance csv or zip archive file of klines to read data from")
+	_ = cmd.MarkFlagRequired("input")
+	f.IntVar(&count, "count", 0, "use the latest 'count' candles. 0 means all")
+	dates.register(f)
+	grid.register(f)
+	_ = cmd.MarkFlagRequired("lower")
+	_ = cmd.MarkFlagRequired("upper")
+	f.Float64VarP(&commission, "commission", "c", 0.1, "maker commission per order in percent")
+	f.Float64Var(&tickSize, "tick-size", 0, "tick size the prices of the levels are rounded to. 0 does not round")
+	f.Float64Var(&sizers.stepSize, "step-size", 0.001, "step size the amounts are rounded down to")
+	f.Float64Var(&sizers.minQty, "min-qty", 0, "minimum amount of an order")
+	f.Float64Var(&sizers.maxQty, "max-qty", 0, "maximum amount of an order. 0 means no limit")
+	f.StringVarP(&output, "output", "o", "", "path to a json file to write the trades and the totals of the grid to")
+	return cmd
+}
+
+func logGridReport(name string, r internal.GridReport) {
+	log.Infof("%s - Trades: %d, Profit: %f, Commission: %f, Net profit: %f", name, len(r.Trades), r.Profit, r.Commission, r.NetProfit)
+	log.Infof("%s - Open buys: %d, Open amount: %f, Open profit: %f", name, r.Open, r.OpenAmount, r.OpenProfit)
+}
+
+func init() {
+	rootCmd.AddCommand(newGridCommand())
+}
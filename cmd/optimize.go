@@ -0,0 +1,206 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/MShoaei/trader/internal"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func newOptimizeCommand() *cobra.Command {
+	var (
+		input       string
+		strategy    string
+		symbol      string
+		risk        float64
+		leverage    int
+		maintenance float64
+		count       int
+		params      []string
+		objective   string
+		format      string
+		output      string
+		workers     int
+		top         int
+		brackets    bracketFlags
+		fees        feeFlags
+		sizers      sizerFlags
+	)
+	cmd := &cobra.Command{
+		Use:   "optimize",
+		Short: "search the parameters of a strategy for the best backtest result",
+		Long: `optimize runs a backtest for every combination of the given parameter values
+and prints the results ranked by the objective.
+
+parameter values are given as name=start:end:step, name=v1,v2,v3 or name=value.
+parameters which are not given use their default value.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			f, info, err := paramStrategy(strategy)
+			if err != nil {
+				return err
+			}
+			grid, err := parseGrid(params, info)
+			if err != nil {
+				return err
+			}
+			bracket, err := brackets.bracket()
+			if err != nil {
+				return err
+			}
+			feeModel, err := fees.model()
+			if err != nil {
+				return err
+			}
+			sizer, err := sizers.sizer(risk)
+			if err != nil {
+				return err
+			}
+			if format != "csv" && format != "json" {
+				return fmt.Errorf("invalid format: %s", format)
+			}
+
+			file, err := os.Open(input)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			candles, err := readCandles(file, count)
+			if err != nil {
+				return err
+			}
+
+			o := internal.Optimizer{
+				Backtest: internal.Backtest{
+					Symbol:          symbol,
+					Risk:            risk,
+					Leverage:        leverage,
+					MaintenanceRate: maintenance,
+					Bracket:         bracket,
+					Fees:            feeModel,
+					Capital:         sizers.capital,
+					Sizer:           sizer,
+					LotSize:         sizers.lotSize(),
+				},
+				Workers: workers,
+			}
+			log.Infof("running %d backtests on %d candles", len(grid.Combinations()), len(candles))
+			results := o.Run(f, grid, candles)
+			if err := internal.RankResults(results, objective); err != nil {
+				return err
+			}
+			if top > 0 && top < len(results) {
+				results = results[:top]
+			}
+
+			out := os.Stdout
+			if output != "-" {
+				out, err = os.Create(output)
+				if err != nil {
+					return err
+				}
+				defer out.Close()
+			}
+			if format == "json" {
+				enc := json.NewEncoder(out)
+				enc.SetIndent("", "  ")
+				return enc.Encode(results)
+			}
+			return writeResultsCSV(out, results)
+		},
+	}
+	f := cmd.Flags()
+	f.SortFlags = false
+	f.StringVarP(&input, "input", "i", "", "path to a json, binance csv or zip archive file of klines to read data from")
+	_ = cmd.MarkFlagRequired("input")
+	f.StringVar(&strategy, "strategy", "", "name or number of the strategy to optimize. see 'trader strategies list'")
+	_ = cmd.MarkFlagRequired("strategy")
+	f.StringArrayVarP(&params, "param", "p", nil, "values of a parameter to test e.g. fast=10:60:10. can be repeated")
+	f.StringVar(&objective, "objective", "profit", "the objective to rank the results by. one of "+strings.Join(internal.Objectives, ", "))
+	f.StringVarP(&symbol, "symbol", "s", "", "symbol of the test")
+	f.Float64VarP(&risk, "risk", "r", 25.0, "total value of the position in USD including leverage")
+	f.IntVarP(&leverage, "leverage", "l", 1, "account leverage")
+	f.Float64Var(&maintenance, "maintenance-margin", 0.5, "maintenance margin rate in percent. positions are liquidated when their loss leaves less margin")
+	f.IntVar(&count, "count", 0, "use the latest 'count' candles. 0 means all")
+	f.IntVar(&workers, "workers", 0, "number of backtests to run concurrently. 0 means the number of CPUs")
+	f.IntVar(&top, "top", 0, "only output the best 'top' results. 0 means all")
+	f.StringVar(&format, "format", "csv", "output format. either csv or json")
+	f.StringVarP(&output, "output", "o", "-", "path to file to write the results to. use '-' to print to stdout")
+	brackets.register(f)
+	fees.register(f)
+	sizers.register(f)
+	return cmd
+}
+
+// parseGrid parses the values of the --param flags. every value must be valid for the parameter of info it is
+// given for.
+func parseGrid(params []string, info internal.StrategyInfo) (internal.Grid, error) {
+	grid := make(internal.Grid, len(params))
+	for _, param := range params {
+		parts := strings.SplitN(param, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid parameter %q. expected name=values", param)
+		}
+		values, err := internal.ParseRange(parts[1])
+		if err != nil {
+			return nil, err
+		}
+		for _, value := range values {
+			if _, err := info.Params(internal.Params{parts[0]: value}); err != nil {
+				return nil, err
+			}
+		}
+		grid[parts[0]] = values
+	}
+	return grid, nil
+}
+
+func writeResultsCSV(out io.Writer, results []internal.OptimizeResult) error {
+	names := make([]string, 0)
+	if len(results) > 0 {
+		for name := range results[0].Params {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+
+	w := csv.NewWriter(out)
+	header := append([]string{"rank"}, names...)
+	header = append(header, "trades", "win_rate", "profit", "commission", "funding", "net_profit", "max_drawdown", "profit_factor")
+	if err := w.Write(header); err != nil {
+		return err
+	}
+	formatFloat := func(v float64) string {
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	for i, result := range results {
+		row := []string{strconv.Itoa(i + 1)}
+		for _, name := range names {
+			row = append(row, formatFloat(result.Params[name]))
+		}
+		m := result.Metrics
+		row = append(row,
+			strconv.Itoa(m.Trades),
+			formatFloat(m.WinRate),
+			formatFloat(m.Profit),
+			formatFloat(m.Commission),
+			formatFloat(m.Funding),
+			formatFloat(m.NetProfit),
+			formatFloat(m.MaxDrawdown),
+			formatFloat(m.ProfitFactor),
+		)
+		if err := w.Write(row); err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
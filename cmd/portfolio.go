@@ -0,0 +1,168 @@
+package cmd
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/MShoaei/trader/internal"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func newPortfolioCommand() *cobra.Command {
+	var (
+		inputs        []string
+		strategy      string
+		capital       float64
+		risk          float64
+		leverage      int
+		count         int
+		maxPositions  int
+		maxAllocation float64
+		allocations   []string
+		equityOut     string
+		brackets      bracketFlags
+		fees          feeFlags
+	)
+	cmd := &cobra.Command{
+		Use:   "portfolio",
+		Short: "analyze a strategy on several symbols sharing the same capital",
+		Long: `portfolio runs the strategy on every input with a single cash balance.
+inputs are given as SYMBOL=path. if the symbol is omitted it is taken from the file name,
+e.g. data/ethusdt.json is ETHUSDT.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			f, _, err := paramStrategy(strategy)
+			if err != nil {
+				return err
+			}
+			bracket, err := brackets.bracket()
+			if err != nil {
+				return err
+			}
+			feeModel, err := fees.model()
+			if err != nil {
+				return err
+			}
+			allocation := make(map[string]float64, len(allocations))
+			for _, a := range allocations {
+				parts := strings.SplitN(a, "=", 2)
+				if len(parts) != 2 {
+					return fmt.Errorf("invalid allocation %q. expected SYMBOL=percent", a)
+				}
+				allocation[strings.ToUpper(parts[0])], err = strconv.ParseFloat(parts[1], 64)
+				if err != nil {
+					return err
+				}
+			}
+
+			symbols := make([]internal.PortfolioSymbol, 0, len(inputs))
+			for _, input := range inputs {
+				symbol, path := parseSymbolInput(input)
+				file, err := os.Open(path)
+				if err != nil {
+					return err
+				}
+				candles, err := readCandles(file, count)
+				file.Close()
+				if err != nil {
+					return err
+				}
+				symbols = append(symbols, internal.PortfolioSymbol{Symbol: symbol, Candles: candles})
+			}
+
+			p := internal.Portfolio{
+				Capital:       capital,
+				Risk:          risk,
+				Leverage:      leverage,
+				Fees:          feeModel,
+				Bracket:       bracket,
+				MaxPositions:  maxPositions,
+				MaxAllocation: maxAllocation,
+				Allocation:    allocation,
+			}
+			report := p.Run(f(nil), symbols)
+
+			log.Infof("Portfolio - Capital: %f, Final equity: %f, Return: %f%%, Max drawdown: %f%%",
+				report.Capital,
+				report.FinalEquity,
+				report.Return,
+				report.MaxDrawdown,
+			)
+			log.Infof("Portfolio - Max exposure: %f, Average exposure: %f", report.MaxExposure, report.AverageExposure)
+			for _, s := range report.Symbols {
+				log.Infof("%s - Trades: %d, Net profit: %f, PNL: %f, Contribution: %f%%, Skipped entries: %d",
+					s.Symbol,
+					s.Trades,
+					s.NetProfit,
+					s.OpenPL,
+					s.Contribution,
+					s.Skipped,
+				)
+			}
+
+			if equityOut == "" {
+				return nil
+			}
+			return writePortfolioEquity(equityOut, report.Equity)
+		},
+	}
+	f := cmd.Flags()
+	f.SortFlags = false
+	f.StringArrayVarP(&inputs, "input", "i", nil, "SYMBOL=path of a json, binance csv or zip archive file of klines to read data from. can be repeated")
+	_ = cmd.MarkFlagRequired("input")
+	f.StringVar(&strategy, "strategy", "", "name or number of the strategy to use for analysis. see 'trader strategies list'")
+	_ = cmd.MarkFlagRequired("strategy")
+	f.Float64Var(&capital, "capital", 1000, "starting cash of the portfolio in USD")
+	f.Float64VarP(&risk, "risk", "r", 25.0, "margin of each position in USD")
+	f.IntVarP(&leverage, "leverage", "l", 1, "account leverage")
+	f.IntVar(&count, "count", 0, "use the latest 'count' candles of every input. 0 means all")
+	f.IntVar(&maxPositions, "max-positions", 0, "maximum number of positions open at the same time. 0 means no limit")
+	f.Float64Var(&maxAllocation, "max-allocation", 0, "maximum margin of a single position in percent of the equity. 0 means no limit")
+	f.StringArrayVar(&allocations, "allocation", nil, "SYMBOL=percent overriding --max-allocation for a symbol. can be repeated")
+	f.StringVar(&equityOut, "equity-out", "", "path to a csv file to write the equity curve of the portfolio to")
+	brackets.register(f)
+	fees.register(f)
+	return cmd
+}
+
+// parseSymbolInput parses an input in the form of SYMBOL=path or path.
+func parseSymbolInput(input string) (symbol, path string) {
+	if parts := strings.SplitN(input, "=", 2); len(parts) == 2 {
+		return strings.ToUpper(parts[0]), parts[1]
+	}
+	name := filepath.Base(input)
+	return strings.ToUpper(strings.TrimSuffix(name, filepath.Ext(name))), input
+}
+
+func writePortfolioEquity(path string, points []internal.PortfolioPoint) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := csv.NewWriter(file)
+	if err := w.Write([]string{"time", "cash", "equity", "exposure", "positions"}); err != nil {
+		return err
+	}
+	for _, point := range points {
+		err := w.Write([]string{
+			point.Time.UTC().Format(time.RFC3339),
+			strconv.FormatFloat(point.Cash, 'f', -1, 64),
+			strconv.FormatFloat(point.Equity, 'f', -1, 64),
+			strconv.FormatFloat(point.Exposure, 'f', -1, 64),
+			strconv.Itoa(point.Positions),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	w.Flush()
+	return w.Error()
+}
@@ -0,0 +1,202 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/MShoaei/trader/internal"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// defaultRunsDir is the directory analyze crypto saves its runs to.
+const defaultRunsDir = "runs"
+
+// runIgnoredFlags are the flags of analyze crypto which do not change the result of a run.
+var runIgnoredFlags = map[string]bool{
+	"debug":      true,
+	"input":      true,
+	"output":     true,
+	"equity-out": true,
+	"html":       true,
+	"runs-dir":   true,
+	"no-save":    true,
+}
+
+// runParams returns the values of the flags of a run by name.
+func runParams(f *pflag.FlagSet) map[string]string {
+	params := make(map[string]string)
+	f.VisitAll(func(flag *pflag.Flag) {
+		if !runIgnoredFlags[flag.Name] {
+			params[flag.Name] = flag.Value.String()
+		}
+	})
+	return params
+}
+
+func newRunsCommand() *cobra.Command {
+	var dir string
+	cmd := &cobra.Command{
+		Use:   "runs",
+		Short: "list, show and compare the saved runs of analyze crypto",
+		Args:  cobra.NoArgs,
+	}
+	cmd.PersistentFlags().StringVar(&dir, "dir", defaultRunsDir, "directory the runs are saved in")
+	store := func() internal.RunStore {
+		return internal.RunStore{Dir: dir}
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "list the saved runs from the oldest to the newest",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			runs, err := store().List()
+			if err != nil {
+				return err
+			}
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tTIME\tSYMBOL\tSTRATEGY\tTRADES\tNET PROFIT\tMAX DRAWDOWN\tDATA")
+			for _, run := range runs {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%.4f\t%.4f\t%s\n",
+					run.ID, run.Time.Format(time.RFC3339), run.Symbol, run.Strategy, run.Metrics.Trades,
+					run.Metrics.NetProfit, run.Metrics.MaxDrawdown, shortHash(run.Data.SHA256))
+			}
+			return w.Flush()
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "show ID",
+		Short: "show the parameters, metrics and trades of a run. the ID can be shortened to a unique prefix",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			run, err := store().Load(args[0])
+			if err != nil {
+				return err
+			}
+			writeRun(os.Stdout, run)
+			return nil
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "diff ID ID",
+		Short: "compare the parameters, metrics and trades of two runs",
+		Args:  cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			a, err := store().Load(args[0])
+			if err != nil {
+				return err
+			}
+			b, err := store().Load(args[1])
+			if err != nil {
+				return err
+			}
+			writeRunDiff(os.Stdout, internal.DiffRuns(a, b))
+			return nil
+		},
+	})
+	return cmd
+}
+
+func shortHash(hash string) string {
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	return hash
+}
+
+func writeRun(out io.Writer, run internal.Run) {
+	fmt.Fprintf(out, "Run %s at %s\n", run.ID, run.Time.Format(time.RFC3339))
+	fmt.Fprintf(out, "Symbol: %s, Strategy: %s\n", run.Symbol, run.Strategy)
+	fmt.Fprintf(out, "Data: %s (sha256 %s)\n", run.Data.Path, run.Data.SHA256)
+	fmt.Fprintf(out, "Fees: maker %f%%, taker %f%%, BNB discount %f%%, %s, %d funding rates\n",
+		run.Fees.Maker, run.Fees.Taker, run.Fees.BNBDiscount, run.Fees.Liquidity, run.Fees.FundingRates)
+
+	names := make([]string, 0, len(run.Params))
+	for name := range run.Params {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Fprintln(out, "\nParameters:")
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	for _, name := range names {
+		fmt.Fprintf(w, "  %s\t%s\n", name, run.Params[name])
+	}
+	w.Flush()
+
+	fmt.Fprintln(out, "\nMetrics:")
+	w = tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	for _, m := range runMetrics(run.Metrics) {
+		fmt.Fprintf(w, "  %s\t%f\n", m.name, m.value)
+	}
+	w.Flush()
+
+	fmt.Fprintln(out, "\nTrades:")
+	writeRunTrades(out, "", run.Trades)
+}
+
+func writeRunDiff(out io.Writer, d internal.RunDiff) {
+	fmt.Fprintf(out, "A: run %s, %s strategy %s\n", d.A.ID, d.A.Symbol, d.A.Strategy)
+	fmt.Fprintf(out, "B: run %s, %s strategy %s\n", d.B.ID, d.B.Symbol, d.B.Strategy)
+	if !d.SameData {
+		fmt.Fprintf(out, "the runs used different data: %s (%s) and %s (%s)\n",
+			d.A.Data.Path, shortHash(d.A.Data.SHA256), d.B.Data.Path, shortHash(d.B.Data.SHA256))
+	}
+
+	fmt.Fprintln(out, "\nParameters:")
+	if len(d.Params) == 0 {
+		fmt.Fprintln(out, "  no changes")
+	}
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	for _, p := range d.Params {
+		fmt.Fprintf(w, "  %s\t%s\t->\t%s\n", p.Name, p.A, p.B)
+	}
+	w.Flush()
+
+	fmt.Fprintln(out, "\nMetrics:")
+	w = tabwriter.NewWriter(out, 0, 4, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(w, "\tA\tB\tB - A\t")
+	a, b := runMetrics(d.A.Metrics), runMetrics(d.B.Metrics)
+	for i := range a {
+		fmt.Fprintf(w, "%s\t%f\t%f\t%+f\t\n", a[i].name, a[i].value, b[i].value, b[i].value-a[i].value)
+	}
+	w.Flush()
+
+	fmt.Fprintf(out, "\nTrades: %d in both, %d only in A, %d only in B\n", d.Common, len(d.OnlyA), len(d.OnlyB))
+	writeRunTrades(out, "- ", d.OnlyA)
+	writeRunTrades(out, "+ ", d.OnlyB)
+}
+
+type runMetric struct {
+	name  string
+	value float64
+}
+
+func runMetrics(m internal.Metrics) []runMetric {
+	return []runMetric{
+		{"Trades", float64(m.Trades)},
+		{"Win rate", m.WinRate},
+		{"Profit", m.Profit},
+		{"Commission", m.Commission},
+		{"Funding", m.Funding},
+		{"Net profit", m.NetProfit},
+		{"Max drawdown", m.MaxDrawdown},
+		{"Profit factor", m.ProfitFactor},
+	}
+}
+
+// writeRunTrades writes a line for every trade starting with prefix.
+func writeRunTrades(out io.Writer, prefix string, trades []internal.RunTrade) {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	for _, t := range trades {
+		fmt.Fprintf(w, "%s%s\t%s\t%f\t%s\t%f\t%f\t%f\n", prefix, t.Side,
+			t.EntryTime.Format(time.RFC3339), t.EntryPrice, t.ExitTime.Format(time.RFC3339), t.ExitPrice, t.Amount, t.NetProfit)
+	}
+	w.Flush()
+}
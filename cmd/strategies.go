@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/MShoaei/trader/internal"
+	"github.com/spf13/cobra"
+)
+
+func newStrategiesCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "strategies",
+		Short: "list and describe the registered strategies",
+		Args:  cobra.NoArgs,
+	}
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list",
+		Short: "list the registered strategies. they can be selected by name or number",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "#\tNAME\tTIMEFRAMES\tDESCRIPTION")
+			for i, info := range internal.Strategies() {
+				timeframes := strings.Join(info.Timeframes, ",")
+				if timeframes == "" {
+					timeframes = "-"
+				}
+				fmt.Fprintf(w, "%d\t%s\t%s\t%s\n", i, info.Name, timeframes, info.Description)
+			}
+			return w.Flush()
+		},
+	})
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "describe NAME",
+		Short: "show the description and the parameters of a strategy",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			info, err := lookupStrategy(args[0])
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s: %s\n", info.Name, info.Description)
+			for _, name := range info.Timeframes {
+				fmt.Printf("needs a higher timeframe series named %s. e.g. --timeframe %s=4h\n", name, name)
+			}
+			if info.Static != nil {
+				fmt.Println("only exits through the bracket. set a stop loss or take profit")
+			}
+			if len(info.Schema) == 0 {
+				fmt.Println("\nno parameters")
+				return nil
+			}
+			fmt.Println("\nParameters:")
+			w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "  NAME\tDEFAULT\tTYPE\tRANGE\tDESCRIPTION")
+			for _, p := range info.Schema {
+				typ := "float"
+				if p.Integer {
+					typ = "integer"
+				}
+				fmt.Fprintf(w, "  %s\t%v\t%s\t%s\t%s\n", p.Name, info.Defaults[p.Name], typ, paramRange(p), p.Description)
+			}
+			return w.Flush()
+		},
+	})
+	return cmd
+}
+
+// paramRange formats the bounds of p. zero bounds are unbounded.
+func paramRange(p internal.ParamInfo) string {
+	open, min, max := "[", "-inf", "inf"
+	switch {
+	case p.Min != 0:
+		min = fmt.Sprint(p.Min)
+	case p.Positive:
+		open, min = "(", "0"
+	case p.NonNegative:
+		min = "0"
+	}
+	if p.Max != 0 {
+		max = fmt.Sprint(p.Max)
+	}
+	return open + min + ", " + max + "]"
+}
+
+func init() {
+	rootCmd.AddCommand(newStrategiesCommand())
+}
@@ -0,0 +1,129 @@
+package cmd
+
+import (
+	"os"
+	"strings"
+
+	"github.com/MShoaei/trader/internal"
+	log "github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+func newWalkForwardCommand() *cobra.Command {
+	var (
+		input       string
+		strategy    string
+		symbol      string
+		risk        float64
+		leverage    int
+		maintenance float64
+		count       int
+		params      []string
+		objective   string
+		inSample    int
+		outSample   int
+		workers     int
+		brackets    bracketFlags
+		fees        feeFlags
+		sizers      sizerFlags
+	)
+	cmd := &cobra.Command{
+		Use:   "walkforward",
+		Short: "run a walk-forward analysis of a strategy",
+		Long: `walkforward optimizes the strategy on a window of in-sample candles, trades the best
+parameters on the out-of-sample candles that follow it and moves both windows forward.
+the out-of-sample trades of all windows are reported as a single backtest. the last
+out-of-sample window is shorter when fewer candles than out-sample are left for it.
+
+parameter values are given the same way as the optimize command.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			f, info, err := paramStrategy(strategy)
+			if err != nil {
+				return err
+			}
+			grid, err := parseGrid(params, info)
+			if err != nil {
+				return err
+			}
+			bracket, err := brackets.bracket()
+			if err != nil {
+				return err
+			}
+			feeModel, err := fees.model()
+			if err != nil {
+				return err
+			}
+			sizer, err := sizers.sizer(risk)
+			if err != nil {
+				return err
+			}
+
+			file, err := os.Open(input)
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+			candles, err := readCandles(file, count)
+			if err != nil {
+				return err
+			}
+
+			wf := internal.WalkForward{
+				Optimizer: internal.Optimizer{
+					Backtest: internal.Backtest{
+						Symbol:          symbol,
+						Risk:            risk,
+						Leverage:        leverage,
+						MaintenanceRate: maintenance,
+						Bracket:         bracket,
+						Fees:            feeModel,
+						Capital:         sizers.capital,
+						Sizer:           sizer,
+						LotSize:         sizers.lotSize(),
+					},
+					Workers: workers,
+				},
+				Objective: objective,
+				InSample:  inSample,
+				OutSample: outSample,
+			}
+			windows, record, err := wf.Run(f, grid, candles)
+			if err != nil {
+				return err
+			}
+			for i, w := range windows {
+				log.Infof("Window %d - In-sample: %s, Out-of-sample: %s, Params: %v", i+1, w.InSample, w.OutSample, w.Params)
+				log.Infof("Window %d - In-sample net profit: %f, Out-of-sample net profit: %f, Out-of-sample trades: %d, Out-of-sample win rate: %f%%",
+					i+1,
+					w.InSampleMetrics.NetProfit,
+					w.OutSampleMetrics.NetProfit,
+					w.OutSampleMetrics.Trades,
+					w.OutSampleMetrics.WinRate,
+				)
+			}
+			logAnalysis("Out-of-sample", record, candles[len(candles)-1], feeModel)
+			return nil
+		},
+	}
+	f := cmd.Flags()
+	f.SortFlags = false
+	f.StringVarP(&input, "input", "i", "", "path to a json, binance csv or zip archive file of klines to read data from")
+	_ = cmd.MarkFlagRequired("input")
+	f.StringVar(&strategy, "strategy", "", "name or number of the strategy to analyze. see 'trader strategies list'")
+	_ = cmd.MarkFlagRequired("strategy")
+	f.StringArrayVarP(&params, "param", "p", nil, "values of a parameter to test e.g. fast=10:60:10. can be repeated")
+	f.StringVar(&objective, "objective", "profit", "the objective used to pick the best parameters. one of "+strings.Join(internal.Objectives, ", "))
+	f.IntVar(&inSample, "in-sample", 2000, "number of candles in each in-sample window")
+	f.IntVar(&outSample, "out-sample", 500, "number of candles in each out-of-sample window")
+	f.StringVarP(&symbol, "symbol", "s", "", "symbol of the test")
+	f.Float64VarP(&risk, "risk", "r", 25.0, "total value of the position in USD including leverage")
+	f.IntVarP(&leverage, "leverage", "l", 1, "account leverage")
+	f.Float64Var(&maintenance, "maintenance-margin", 0.5, "maintenance margin rate in percent. positions are liquidated when their loss leaves less margin")
+	f.IntVar(&count, "count", 0, "use the latest 'count' candles. 0 means all")
+	f.IntVar(&workers, "workers", 0, "number of backtests to run concurrently. 0 means the number of CPUs")
+	brackets.register(f)
+	fees.register(f)
+	sizers.register(f)
+	return cmd
+}
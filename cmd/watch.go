@@ -1,11 +1,16 @@
 package cmd
 
 import (
+	"fmt"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/MShoaei/trader/internal"
 	"github.com/adshao/go-binance/v2"
+	log "github.com/sirupsen/logrus"
 	"github.com/spf13/cobra"
 )
 
@@ -25,12 +30,36 @@ func NewWatchCommand() *cobra.Command {
 		commission float64
 		leverage   int
 		demo       bool
+		trend      string
+		strategy   string
+		params     []string
+		timeframes []string
+		specFile   string
+		sizers     sizerFlags
+		scalings   scalingFlags
+		plan       dcaFlags
+		replay     string
+		speed      string
+		updates    int
 	)
 
 	cmd := &cobra.Command{
 		Use:   "watch",
 		Short: "watch watches the market and places order when the conditions are true",
 		RunE: func(cmd *cobra.Command, args []string) error {
+			sizer, err := sizers.sizer(risk)
+			if err != nil {
+				return err
+			}
+			// the watchdog trades without a bracket, so its positions have no stop loss.
+			scaling, err := scalings.scaling(false)
+			if err != nil {
+				return err
+			}
+			dca, err := plan.dca()
+			if err != nil {
+				return err
+			}
 			interruptCh := make(chan os.Signal, 1)
 			w := internal.Watchdog{
 				Symbol:     symbol,
@@ -39,9 +68,59 @@ func NewWatchCommand() *cobra.Command {
 				Leverage:   leverage,
 				Commission: commission,
 				Demo:       demo,
+				Sizer:      sizer,
+				Capital:    sizers.capital,
+				Scaling:    scaling,
+				DCA:        dca,
 
 				InterruptCh: interruptCh,
 			}
+			if specFile != "" {
+				if trend != "" || cmd.Flags().Changed("strategy") {
+					return fmt.Errorf("--strategy-file can not be used with --strategy or --trend")
+				}
+				file, err := os.Open(specFile)
+				if err != nil {
+					return err
+				}
+				spec, err := internal.ReadStrategySpec(file)
+				file.Close()
+				if err != nil {
+					return fmt.Errorf("%s: %v", specFile, err)
+				}
+				if w.Strategy, err = spec.Compile(); err != nil {
+					return err
+				}
+				w.Timeframes = spec.Timeframes
+			} else {
+				if trend != "" {
+					timeframes = append(timeframes, "trend="+trend)
+					if !cmd.Flags().Changed("strategy") {
+						strategy = "ema-trend"
+					}
+				}
+				if w.Timeframes, err = parseIntervals(timeframes); err != nil {
+					return err
+				}
+				info, err := lookupStrategy(strategy)
+				if err != nil {
+					return err
+				}
+				p, err := strategyParams(info, params)
+				if err != nil {
+					return err
+				}
+				names := make([]string, 0, len(w.Timeframes))
+				for name := range w.Timeframes {
+					names = append(names, name)
+				}
+				if w.Strategy, err = info.EngineStrategy(p, names); err != nil {
+					return err
+				}
+			}
+			if replay != "" {
+				return replayWatch(&w, replay, speed, limit, updates)
+			}
 			wsKlineHandler, errHandler, err := w.Watch(client)
 			if err != nil {
 				return err
@@ -77,11 +156,103 @@ func NewWatchCommand() *cobra.Command {
 	f.IntVar(&limit, "limit", 250, "number of candles to query")
 	f.Float64VarP(&commission, "commission", "c", 0.1, "commission per trade in percent")
 	f.IntVarP(&leverage, "leverage", "l", 1, "account leverage")
+	f.StringVar(&strategy, "strategy", internal.DefaultStrategy, "name or number of the strategy to trade. see 'trader strategies list'. only its long side is traded")
+	f.StringArrayVarP(&params, "param", "p", nil, "name=value overriding a parameter of the strategy e.g. fast=10. can be repeated")
+	f.StringArrayVar(&timeframes, "timeframe", nil, "higher timeframe series of the strategy as name=interval e.g. trend=4h. can be repeated")
+	f.StringVar(&trend, "trend", "", "shortcut for --strategy ema-trend --timeframe trend=INTERVAL e.g. 4h. disabled if empty")
+	f.StringVar(&specFile, "strategy-file", "", "path to a yaml or json strategy definition to trade instead of --strategy. only its long side is traded")
+	sizers.register(f)
+	scalings.register(f)
+	plan.register(f)
 	f.BoolVar(&demo, "demo", false, "set to false to place real orders")
+	f.StringVar(&replay, "replay", "", "path to a json file of klines to replay instead of watching the market. the first --limit klines are the history and orders are only simulated")
+	f.StringVar(&speed, "speed", "1x", "speed of the replay relative to the kline interval e.g. 60x. 0 or max replays without waiting")
+	f.IntVar(&updates, "updates", 3, "number of non-final kline updates synthesized before every replayed kline")
 
 	return cmd
 }
 
+// replayWatch runs w on the klines of the file at path after the first limit ones, paced by a simulated clock.
+// The orders are filled by a SimulatedExecutor, so nothing is sent to binance.
+func replayWatch(w *internal.Watchdog, path, speed string, limit, updates int) error {
+	factor, err := parseSpeed(speed)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	candles, err := readCandles(file, 0)
+	if err != nil {
+		return err
+	}
+	if limit < 1 || limit >= len(candles) {
+		return fmt.Errorf("replay needs more than --limit %d klines, the file has %d", limit, len(candles))
+	}
+
+	// the last kline of the history is finalized by the replay, as the last kline downloaded by Watch is still open.
+	w.History = candles[:limit]
+	w.Executor = internal.SimulatedExecutor{}
+	wsKlineHandler, _, err := w.Watch(nil)
+	if err != nil {
+		return err
+	}
+
+	stopC := make(chan struct{})
+	signal.Notify(w.InterruptCh, os.Interrupt)
+	defer signal.Stop(w.InterruptCh)
+	go func() {
+		<-w.InterruptCh
+		close(stopC)
+	}()
+	candles = candles[limit-1:]
+	done := internal.Replay{
+		Symbol:   w.Symbol,
+		Interval: w.Interval,
+		Candles:  candles,
+		Updates:  updates,
+		Clock:    internal.NewClock(candles[0].Period.Start, factor),
+	}.Run(wsKlineHandler, stopC)
+	if !done {
+		log.Infoln("replay interrupted")
+	}
+
+	report := w.Report()
+	log.Infof("%s replay - Total profit: %f, Commission: %f, Open profit: %f, Trades: %.0f, Profitable trades: %.0f",
+		w.Symbol, report.TotalProfit, report.CommissionValue, report.OpenProfit, report.TradeCount, report.ProfitableTradeCount)
+	return nil
+}
+
+// parseIntervals parses higher timeframe series given as name=interval.
+func parseIntervals(values []string) (map[string]string, error) {
+	intervals := make(map[string]string, len(values))
+	for _, value := range values {
+		parts := strings.SplitN(value, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid timeframe %q. expected name=interval", value)
+		}
+		if _, err := internal.IntervalDuration(parts[1]); err != nil {
+			return nil, fmt.Errorf("invalid timeframe %q: %v", value, err)
+		}
+		intervals[parts[0]] = parts[1]
+	}
+	return intervals, nil
+}
+
+// parseSpeed parses a replay speed such as 60x. max is the same as 0.
+func parseSpeed(speed string) (float64, error) {
+	if speed == "max" {
+		return 0, nil
+	}
+	factor, err := strconv.ParseFloat(strings.TrimSuffix(speed, "x"), 64)
+	if err != nil || factor < 0 {
+		return 0, fmt.Errorf("invalid speed %q. e.g. 60x", speed)
+	}
+	return factor, nil
+}
+
 // watchCmd represents the watch command
 
 func init() {
@@ -13,35 +13,20 @@ import (
 // LogTradesAnalysis is a wrapper around an io.Writer, which logs every trade executed to that writer
 type LogTradesAnalysis struct {
 	io.Writer
+	Fees FeeModel
 }
 
 // TotalProfitAnalysis analyzes the trading record for total profit.
 type TotalProfitAnalysis struct {
-	Commission float64
+	Fees FeeModel
 }
 
-// Analyze analyzes the trading record for total profit.
+// Analyze analyzes the trading record for total profit after fees and funding.
 func (tps TotalProfitAnalysis) Analyze(record *techan.TradingRecord) float64 {
 	totalProfit := big.NewDecimal(0)
 	for _, trade := range record.Trades {
 		if trade.IsClosed() {
-
-			amount := trade.EntranceOrder().Amount
-			realAmount := amount.Sub(amount.Mul(big.NewDecimal(tps.Commission * 0.01)))
-			closeCommission := trade.ExitValue().Mul(big.NewDecimal(tps.Commission * 0.01))
-
-			openValue := trade.CostBasis()
-			closeValue := realAmount.Mul(trade.ExitOrder().Price).Sub(closeCommission)
-
-			// costBasis := trade.CostBasis()
-			// exitValue := trade.ExitValue()
-
-			if trade.IsLong() {
-				totalProfit = totalProfit.Add(closeValue.Sub(openValue))
-			} else if trade.IsShort() {
-				totalProfit = totalProfit.Sub(closeValue.Sub(openValue))
-			}
-
+			totalProfit = totalProfit.Add(tps.Fees.NetProfit(trade))
 		}
 	}
 
@@ -50,18 +35,15 @@ func (tps TotalProfitAnalysis) Analyze(record *techan.TradingRecord) float64 {
 
 // Analyze logs trades to provided io.Writer
 func (lta LogTradesAnalysis) Analyze(record *techan.TradingRecord) float64 {
-	var profit big.Decimal
 	logOrder := func(trade *techan.Position) {
 		if trade.IsShort() {
 			fmt.Fprintf(lta.Writer, "%s - enter with sell %s (%s @ $%s)\n", trade.EntranceOrder().ExecutionTime.UTC().Format(time.RFC822), trade.EntranceOrder().Security, trade.EntranceOrder().Amount, trade.EntranceOrder().Price)
 			fmt.Fprintf(lta.Writer, "%s - exit with buy %s (%s @ $%s)\n", trade.ExitOrder().ExecutionTime.UTC().Format(time.RFC822), trade.ExitOrder().Security, trade.ExitOrder().Amount, trade.ExitOrder().Price)
-			profit = trade.ExitValue().Sub(trade.CostBasis()).Neg()
 		} else {
 			fmt.Fprintf(lta.Writer, "%s - enter with buy %s (%s @ $%s)\n", trade.EntranceOrder().ExecutionTime.UTC().Format(time.RFC822), trade.EntranceOrder().Security, trade.EntranceOrder().Amount, trade.EntranceOrder().Price)
 			fmt.Fprintf(lta.Writer, "%s - exit with sell %s (%s @ $%s)\n", trade.ExitOrder().ExecutionTime.UTC().Format(time.RFC822), trade.ExitOrder().Security, trade.ExitOrder().Amount, trade.ExitOrder().Price)
-			profit = trade.ExitValue().Sub(trade.CostBasis())
 		}
-		fmt.Fprintf(lta.Writer, "Profit: $%s\n", profit)
+		fmt.Fprintf(lta.Writer, "Profit: $%s, Fees: $%s, Funding: $%s\n", grossProfit(trade), lta.Fees.Fees(trade), lta.Fees.FundingCost(trade))
 	}
 
 	for _, trade := range record.Trades {
@@ -74,7 +56,7 @@ func (lta LogTradesAnalysis) Analyze(record *techan.TradingRecord) float64 {
 
 // ProfitableTradesAnalysis analyzes the trading record for the number of profitable trades
 type ProfitableTradesAnalysis struct {
-	Commission float64
+	Fees FeeModel
 }
 
 // Analyze returns the number of profitable trades in a trading record
@@ -82,14 +64,7 @@ func (pta ProfitableTradesAnalysis) Analyze(record *techan.TradingRecord) float6
 	var profitableTrades int
 
 	for _, trade := range record.Trades {
-		amount := trade.EntranceOrder().Amount
-		realAmount := amount.Sub(amount.Mul(big.NewDecimal(pta.Commission * 0.01)))
-		closeCommission := realAmount.Mul(trade.ExitOrder().Price).Mul(big.NewDecimal(pta.Commission * 0.01))
-
-		openValue := trade.CostBasis()
-		closeValue := realAmount.Mul(trade.ExitOrder().Price).Sub(closeCommission)
-
-		if (trade.IsLong() && closeValue.GT(openValue)) || (trade.IsShort() && closeValue.LT(openValue)) {
+		if pta.Fees.NetProfit(trade).GT(big.ZERO) {
 			profitableTrades++
 		}
 	}
@@ -97,58 +72,55 @@ func (pta ProfitableTradesAnalysis) Analyze(record *techan.TradingRecord) float6
 	return float64(profitableTrades)
 }
 
+// CommissionAnalysis analyzes the trading record for the total fees paid.
 type CommissionAnalysis struct {
-	Commission float64
+	Fees FeeModel
 }
 
 // Analyze analyzes the trading record for the total commission cost.
 func (ca CommissionAnalysis) Analyze(record *techan.TradingRecord) float64 {
 	total := big.NewDecimal(0)
 	for _, trade := range record.Trades {
-		amount := trade.EntranceOrder().Amount
-		commissionAmount := amount.Mul(big.NewDecimal(ca.Commission * 0.01))
-		total = total.Add(commissionAmount.Mul(trade.ExitOrder().Price))
+		total = total.Add(ca.Fees.Fees(trade))
+	}
+	return total.Float()
+}
 
-		closeCommission := amount.Sub(commissionAmount).Mul(trade.ExitOrder().Price).Mul(big.NewDecimal(ca.Commission * 0.01))
-		total = total.Add(closeCommission)
+// FundingAnalysis analyzes the trading record for the total funding paid. a negative value is a funding received.
+type FundingAnalysis struct {
+	Fees FeeModel
+}
+
+// Analyze analyzes the trading record for the total funding cost.
+func (fa FundingAnalysis) Analyze(record *techan.TradingRecord) float64 {
+	total := big.NewDecimal(0)
+	for _, trade := range record.Trades {
+		total = total.Add(fa.Fees.FundingCost(trade))
 	}
 	return total.Float()
 }
 
 type OpenPLAnalysis struct {
 	LastCandle *techan.Candle
-	Commission float64
+	Fees       FeeModel
 }
 
 func (o OpenPLAnalysis) Analyze(record *techan.TradingRecord) float64 {
-	if record.CurrentPosition().IsNew() {
+	if !record.CurrentPosition().IsOpen() {
 		return 0
 	}
-	var profit big.Decimal
-	trade := record.CurrentPosition()
-	amount := trade.EntranceOrder().Amount
-	realAmount := amount.Sub(amount.Mul(big.NewDecimal(o.Commission * 0.01)))
-
-	closeCommission := o.LastCandle.ClosePrice.Mul(realAmount).Mul(big.NewDecimal(o.Commission * 0.01))
-	if trade.IsShort() {
-		profit = o.LastCandle.ClosePrice.Mul(realAmount).Sub(trade.CostBasis()).Neg().Sub(closeCommission)
-	} else if trade.IsLong() {
-		profit = o.LastCandle.ClosePrice.Mul(realAmount).Sub(trade.CostBasis()).Sub(closeCommission)
-	}
-	return profit.Float()
+	return o.Fees.OpenProfit(record.CurrentPosition(), o.LastCandle).Float()
 }
 
-func isProfitable(trade *techan.Position) bool {
-	return (trade.IsLong() && trade.ExitOrder().Price.GT(trade.EntranceOrder().Price)) || (trade.IsShort() && trade.ExitOrder().Price.LT(trade.EntranceOrder().Price))
+type WinStreakAnalysis struct {
+	Fees FeeModel
 }
 
-type WinStreakAnalysis struct{}
-
 func (w WinStreakAnalysis) Analyze(record *techan.TradingRecord) float64 {
 	max := 0
 	currentStreak := 0
 	for _, trade := range record.Trades {
-		if !isProfitable(trade) {
+		if !w.Fees.NetProfit(trade).GT(big.ZERO) {
 			max = techan.Max(max, currentStreak)
 			currentStreak = 0
 			continue
@@ -158,13 +130,15 @@ func (w WinStreakAnalysis) Analyze(record *techan.TradingRecord) float64 {
 	return math.Max(float64(max), float64(currentStreak))
 }
 
-type LoseStreakAnalysis struct{}
+type LoseStreakAnalysis struct {
+	Fees FeeModel
+}
 
 func (l LoseStreakAnalysis) Analyze(record *techan.TradingRecord) float64 {
 	max := 0
 	currentStreak := 0
 	for _, trade := range record.Trades {
-		if isProfitable(trade) {
+		if l.Fees.NetProfit(trade).GT(big.ZERO) {
 			max = techan.Max(max, currentStreak)
 			currentStreak = 0
 			continue
@@ -174,73 +148,151 @@ func (l LoseStreakAnalysis) Analyze(record *techan.TradingRecord) float64 {
 	return math.Max(float64(max), float64(currentStreak))
 }
 
-type MaxWinAnalysis struct{}
+type MaxWinAnalysis struct {
+	Fees FeeModel
+}
 
 func (m MaxWinAnalysis) Analyze(record *techan.TradingRecord) float64 {
 	maxProfit := big.ZERO
 	for _, trade := range record.Trades {
-		if !isProfitable(trade) {
-			continue
-		}
-		if trade.IsShort() {
-			maxProfit = big.MaxSlice(maxProfit, trade.ExitValue().Sub(trade.CostBasis()).Neg())
-		} else {
-			maxProfit = big.MaxSlice(maxProfit, trade.ExitValue().Sub(trade.CostBasis()))
-		}
+		maxProfit = big.MaxSlice(maxProfit, m.Fees.NetProfit(trade))
 	}
 	return maxProfit.Float()
 }
 
-type MaxLossAnalysis struct{}
+type MaxLossAnalysis struct {
+	Fees FeeModel
+}
 
 func (m MaxLossAnalysis) Analyze(record *techan.TradingRecord) float64 {
 	minProfit := big.ZERO
 	for _, trade := range record.Trades {
-		if isProfitable(trade) {
-			continue
-		}
-		if trade.IsShort() {
-			minProfit = big.MinSlice(minProfit, trade.ExitValue().Sub(trade.CostBasis()).Neg())
-		} else {
-			minProfit = big.MinSlice(minProfit, trade.ExitValue().Sub(trade.CostBasis()))
-		}
+		minProfit = big.MinSlice(minProfit, m.Fees.NetProfit(trade))
 	}
 	return minProfit.Float()
 }
 
-type AverageWinAnalysis struct{}
+// AverageWinAnalysis analyzes the trading record for the average net profit of the profitable trades.
+type AverageWinAnalysis struct {
+	Fees FeeModel
+}
 
 func (a AverageWinAnalysis) Analyze(record *techan.TradingRecord) float64 {
 	win := big.ZERO
-	count := len(record.Trades)
+	count := 0
 	for _, trade := range record.Trades {
-		if !isProfitable(trade) {
+		profit := a.Fees.NetProfit(trade)
+		if !profit.GT(big.ZERO) {
 			continue
 		}
 		count++
-		if trade.IsShort() {
-			win = win.Add(trade.ExitValue().Sub(trade.CostBasis()).Neg())
-		} else {
-			win = win.Add(trade.ExitValue().Sub(trade.CostBasis()))
-		}
+		win = win.Add(profit)
+	}
+	if count == 0 {
+		return 0
 	}
 	return win.Div(big.NewFromInt(count)).Float()
 }
 
-type AverageLossAnalysis struct{}
+// AverageLossAnalysis analyzes the trading record for the average net profit of the losing trades.
+type AverageLossAnalysis struct {
+	Fees FeeModel
+}
 
 func (a AverageLossAnalysis) Analyze(record *techan.TradingRecord) float64 {
 	loss := big.ZERO
-	count := len(record.Trades)
+	count := 0
 	for _, trade := range record.Trades {
-		if isProfitable(trade) {
+		profit := a.Fees.NetProfit(trade)
+		if profit.GT(big.ZERO) {
 			continue
 		}
-		if trade.IsShort() {
-			loss = loss.Add(trade.ExitValue().Sub(trade.CostBasis()).Neg())
+		count++
+		loss = loss.Add(profit)
+	}
+	if count == 0 {
+		return 0
+	}
+	return loss.Div(big.NewFromInt(count)).Float()
+}
+
+// ProfitFactorAnalysis analyzes the trading record for the net profit of the profitable trades divided by the net
+// loss of the losing trades.
+type ProfitFactorAnalysis struct {
+	Fees FeeModel
+}
+
+// Analyze returns the profit factor of the closed trades. It is 0 if there are no losing trades.
+func (p ProfitFactorAnalysis) Analyze(record *techan.TradingRecord) float64 {
+	win, loss := big.ZERO, big.ZERO
+	for _, trade := range record.Trades {
+		profit := p.Fees.NetProfit(trade)
+		if profit.GT(big.ZERO) {
+			win = win.Add(profit)
 		} else {
-			loss = loss.Add(trade.ExitValue().Sub(trade.CostBasis()))
+			loss = loss.Sub(profit)
 		}
 	}
-	return loss.Div(big.NewFromInt(count)).Float()
+	if loss.Zero() {
+		return 0
+	}
+	return win.Div(loss).Float()
+}
+
+// MaxDrawdownAnalysis analyzes the trading record for the largest drop of the cumulative profit from its peak.
+// The profit of each trade is calculated after fees and funding.
+type MaxDrawdownAnalysis struct {
+	Fees FeeModel
+}
+
+// Analyze returns the maximum drawdown of the closed trades as a positive value.
+func (m MaxDrawdownAnalysis) Analyze(record *techan.TradingRecord) float64 {
+	equity, peak, drawdown := big.ZERO, big.ZERO, big.ZERO
+	for _, trade := range record.Trades {
+		if !trade.IsClosed() {
+			continue
+		}
+		equity = equity.Add(m.Fees.NetProfit(trade))
+		peak = big.MaxSlice(peak, equity)
+		drawdown = big.MaxSlice(drawdown, peak.Sub(equity))
+	}
+	return drawdown.Float()
+}
+
+// SplitRecord splits a trading record into two records holding only the long and only the short trades.
+// The current position, if any, is carried over to the record matching its side.
+func SplitRecord(record *techan.TradingRecord) (long, short *techan.TradingRecord) {
+	long = techan.NewTradingRecord()
+	short = techan.NewTradingRecord()
+	sideRecord := func(trade *techan.Position) *techan.TradingRecord {
+		if trade.IsShort() {
+			return short
+		}
+		return long
+	}
+
+	for _, trade := range record.Trades {
+		r := sideRecord(trade)
+		r.Trades = append(r.Trades, trade)
+	}
+	if current := record.CurrentPosition(); current.IsOpen() {
+		sideRecord(current).Operate(*current.EntranceOrder())
+	}
+	return long, short
+}
+
+// MergeRecords merges the trades of records, which must be in chronological order, into a single record.
+// Only the current position of the last record is carried over.
+func MergeRecords(records ...*techan.TradingRecord) *techan.TradingRecord {
+	merged := techan.NewTradingRecord()
+	for _, record := range records {
+		// the trades are kept as they are, so the fills recorded for them by a Journal still apply.
+		merged.Trades = append(merged.Trades, record.Trades...)
+	}
+	if len(records) > 0 {
+		if current := records[len(records)-1].CurrentPosition(); current.IsOpen() {
+			merged.Operate(*current.EntranceOrder())
+		}
+	}
+	return merged
 }
@@ -11,7 +11,7 @@ import (
 func TestCommissionAnalysis_Analyze(t *testing.T) {
 	record := techan.NewTradingRecord()
 	ca := CommissionAnalysis{
-		Commission: 1,
+		Fees: FlatFee(1),
 	}
 	t.Run("empty", func(t *testing.T) {
 		got := ca.Analyze(record)
@@ -42,3 +42,34 @@ func TestCommissionAnalysis_Analyze(t *testing.T) {
 		}
 	})
 }
+
+func TestSplitRecord(t *testing.T) {
+	record := techan.NewTradingRecord()
+	start := time.Now()
+	orders := []techan.Order{
+		{Side: techan.BUY, Price: big.NewDecimal(100), Amount: big.NewDecimal(1), ExecutionTime: start},
+		{Side: techan.SELL, Price: big.NewDecimal(110), Amount: big.NewDecimal(1), ExecutionTime: start.Add(time.Minute)},
+		{Side: techan.SELL, Price: big.NewDecimal(110), Amount: big.NewDecimal(1), ExecutionTime: start.Add(2 * time.Minute)},
+		{Side: techan.BUY, Price: big.NewDecimal(100), Amount: big.NewDecimal(1), ExecutionTime: start.Add(3 * time.Minute)},
+		{Side: techan.SELL, Price: big.NewDecimal(100), Amount: big.NewDecimal(1), ExecutionTime: start.Add(4 * time.Minute)},
+	}
+	for _, order := range orders {
+		record.Operate(order)
+	}
+
+	long, short := SplitRecord(record)
+	if len(long.Trades) != 1 || !long.Trades[0].IsLong() {
+		t.Errorf("expected 1 long trade, got %d", len(long.Trades))
+	}
+	if len(short.Trades) != 1 || !short.Trades[0].IsShort() {
+		t.Errorf("expected 1 short trade, got %d", len(short.Trades))
+	}
+	if !short.CurrentPosition().IsShort() {
+		t.Errorf("expected the open short position to be carried over")
+	}
+
+	expect := 10.0
+	if got := (TotalProfitAnalysis{}).Analyze(short); got != expect {
+		t.Errorf("expected %f, got %f", expect, got)
+	}
+}
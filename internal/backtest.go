@@ -0,0 +1,143 @@
+package internal
+
+import (
+	"math"
+	"time"
+
+	"github.com/MShoaei/techan"
+	"github.com/sdcoffey/big"
+)
+
+// Backtest runs a strategy against historical candles of a single symbol.
+type Backtest struct {
+	Symbol   string
+	Risk     float64
+	Leverage int
+	// MaintenanceRate is the maintenance margin rate in percent. positions are liquidated at the liquidation
+	// price of their isolated margin when a candle reaches it.
+	MaintenanceRate float64
+	Bracket         Bracket
+	// Fees are the fees paid by the trades of the backtest. they are used to track the equity of sizers.
+	Fees FeeModel
+	// Capital is the starting equity passed to Sizer. the positions are never worth more than the equity with
+	// leverage if it is set.
+	Capital float64
+	// Sizer sizes the positions of the backtest. every position uses Risk USD of margin if it is nil.
+	Sizer Sizer
+	// LotSize rounds the amounts of the positions.
+	LotSize LotSize
+	// Scaling scales the positions in and out. the partial exits are recorded as trades of their own.
+	Scaling Scaling
+	// Fill is the model used to fill the orders of the strategy. orders are filled at the close of the signal
+	// candle if it is nil. bracket exits are always filled at their level.
+	Fill FillModel
+	// Timeframes are the higher timeframe series of the strategies run by RunMultiTimeframe.
+	Timeframes map[string]Timeframe
+
+	// Start is the time of the first candle on which orders may be placed. the candles before it only
+	// warm up the indicators of the strategy.
+	Start time.Time
+}
+
+// Run runs the backtest using a strategy with dynamic exit rules.
+// Both the long and the short side of the strategy are traded, one position at a time.
+// If a bracket is set, positions are also closed when a candle reaches their stop loss or take profit level.
+func (bt *Backtest) Run(f DynamicStrategyFunc, candleC <-chan *techan.Candle) (*techan.TimeSeries, *techan.TradingRecord) {
+	e := bt.engine(func(series *techan.TimeSeries, _ map[string]*HigherSeries) (long, short techan.RuleStrategy) {
+		return f(series)
+	})
+	e.Start(nil, nil)
+	return bt.replay(e, candleC)
+}
+
+// RunStatic runs the backtest using a strategy which relies on the bracket for its exits.
+// The ATR indicator returned by f is used for the ATR based levels of the bracket.
+func (bt *Backtest) RunStatic(f StaticStrategyFunc, candleC <-chan *techan.Candle) (*techan.TimeSeries, *techan.TradingRecord) {
+	var atr techan.Indicator
+	e := bt.engine(func(series *techan.TimeSeries, _ map[string]*HigherSeries) (long, short techan.RuleStrategy) {
+		long, short, atr = f(series)
+		return long, short
+	})
+	e.Start(nil, nil)
+	e.bracket.ATR = atr
+	return bt.replay(e, candleC)
+}
+
+// RunMultiTimeframe runs the backtest using a strategy which also trades on the higher timeframe series described
+// by Timeframes. The series are rebuilt on every run.
+func (bt *Backtest) RunMultiTimeframe(f MultiTimeframeStrategyFunc, candleC <-chan *techan.Candle) (*techan.TimeSeries, *techan.TradingRecord) {
+	e := bt.engine(f)
+	e.Start(nil, newHigherSeriesMap(bt.Timeframes, e.Series()))
+	return bt.replay(e, candleC)
+}
+
+// engine returns the Engine trading f for the backtest with a SimulatedExecutor.
+func (bt *Backtest) engine(f MultiTimeframeStrategyFunc) *Engine {
+	return &Engine{
+		Symbol:          bt.Symbol,
+		Risk:            bt.Risk,
+		Leverage:        bt.Leverage,
+		MaintenanceRate: bt.MaintenanceRate,
+		Liquidate:       true,
+		Bracket:         bt.Bracket,
+		Fees:            bt.Fees,
+		Capital:         bt.Capital,
+		Sizer:           bt.Sizer,
+		LotSize:         bt.LotSize,
+		Scaling:         bt.Scaling,
+		Fill:            bt.Fill,
+		Short:           true,
+		From:            bt.Start,
+		Strategy:        f,
+		Executor:        SimulatedExecutor{},
+	}
+}
+
+// replay feeds every candle to e as a final kline event.
+func (bt *Backtest) replay(e *Engine, candleC <-chan *techan.Candle) (*techan.TimeSeries, *techan.TradingRecord) {
+	for candle := range candleC {
+		e.Handle(KlineEvent(bt.Symbol, "", candle, true))
+	}
+	return e.Series(), e.Record()
+}
+
+func exitSide(position *techan.Position) techan.OrderSide {
+	if position.IsShort() {
+		return techan.BUY
+	}
+	return techan.SELL
+}
+
+func sideName(side techan.OrderSide) string {
+	if side == techan.SELL {
+		return "short"
+	}
+	return "long"
+}
+
+// Margin returns the margin of the positions of the backtest.
+func (bt *Backtest) Margin() Margin {
+	return Margin{Leverage: bt.Leverage, MaintenanceRate: bt.MaintenanceRate}
+}
+
+// Close closes the open position of record, if any, with a market order at the close price of candle.
+func (bt *Backtest) Close(record *techan.TradingRecord, candle *techan.Candle) {
+	if position := record.CurrentPosition(); position.IsOpen() {
+		trades := len(record.Trades)
+		order := techan.Order{
+			Side:          exitSide(position),
+			Security:      bt.Symbol,
+			Price:         candle.ClosePrice,
+			Amount:        position.EntranceOrder().Amount,
+			ExecutionTime: candle.Period.End,
+		}
+		record.Operate(order)
+		bt.Fees.Journal.operate(position, record.Trades[trades:], order, Taker)
+	}
+}
+
+// CalculateAmount returns the quantity worth total at price with leverage, rounded down to 3 decimals.
+func CalculateAmount(total big.Decimal, price big.Decimal, leverage big.Decimal) big.Decimal {
+	amount := total.Div(price.Div(leverage)).Float()
+	return big.NewDecimal(math.Floor(amount*1000) / 1000)
+}
@@ -0,0 +1,86 @@
+package internal
+
+import (
+	"math"
+
+	"github.com/MShoaei/techan"
+)
+
+// Benchmark compares a backtest with holding an asset over the same candles.
+type Benchmark struct {
+	Name string
+	// StrategyReturn is the net return of the backtest on its margin in percent.
+	StrategyReturn float64
+	// Return is the return of holding the asset with the margin and leverage of the backtest in percent.
+	Return float64
+	// Profit is the profit of holding the asset in USD.
+	Profit float64
+	// Excess is StrategyReturn over Return in percent.
+	Excess float64
+	// Beta and Correlation relate the returns of the backtest on every candle to the ones of the asset.
+	Beta        float64
+	Correlation float64
+	// Alpha is the return of the backtest over the whole period in percent which is not explained by Beta.
+	Alpha float64
+}
+
+// NewBenchmark compares the equity curve of a backtest which used margin USD and leverage with holding the asset
+// of candles. Only the equity points at the end of a candle of the asset are compared.
+func NewBenchmark(name string, equity []EquityPoint, margin float64, leverage int, candles []*techan.Candle) Benchmark {
+	b := Benchmark{Name: name}
+	closes := make(map[int64]float64, len(candles))
+	for _, candle := range candles {
+		closes[candle.Period.End.UnixNano()] = candle.ClosePrice.Float()
+	}
+	var points []EquityPoint
+	var prices []float64
+	for _, point := range equity {
+		if price, ok := closes[point.Time.UnixNano()]; ok && price > 0 {
+			points = append(points, point)
+			prices = append(prices, price)
+		}
+	}
+	if len(points) < 2 || margin <= 0 {
+		return b
+	}
+
+	last := len(points) - 1
+	change := prices[last]/prices[0] - 1
+	b.StrategyReturn = (points[last].Equity - points[0].Equity) / margin * 100
+	b.Return = change * float64(leverage) * 100
+	b.Profit = margin * float64(leverage) * change
+	b.Excess = b.StrategyReturn - b.Return
+
+	strategy := make([]float64, last)
+	asset := make([]float64, last)
+	for i := 1; i <= last; i++ {
+		strategy[i-1] = (points[i].Equity - points[i-1].Equity) / (margin + points[i-1].Equity)
+		asset[i-1] = prices[i]/prices[i-1] - 1
+	}
+	meanS, meanA := mean(strategy), mean(asset)
+	var cov, varS, varA float64
+	for i := range strategy {
+		cov += (strategy[i] - meanS) * (asset[i] - meanA)
+		varS += (strategy[i] - meanS) * (strategy[i] - meanS)
+		varA += (asset[i] - meanA) * (asset[i] - meanA)
+	}
+	if varA > 0 {
+		b.Beta = cov / varA
+	}
+	if varS > 0 && varA > 0 {
+		b.Correlation = cov / math.Sqrt(varS*varA)
+	}
+	b.Alpha = (meanS - b.Beta*meanA) * float64(last) * 100
+	return b
+}
+
+func mean(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
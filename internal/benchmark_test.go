@@ -0,0 +1,45 @@
+package internal
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/MShoaei/techan"
+	"github.com/sdcoffey/big"
+)
+
+func TestNewBenchmark(t *testing.T) {
+	var candles []*techan.Candle
+	var equity []EquityPoint
+	for i, price := range []float64{100, 110, 99, 108.9} {
+		candle := techan.NewCandle(techan.NewTimePeriod(time.Unix(int64(i*60), 0), time.Minute))
+		candle.ClosePrice = big.NewDecimal(price)
+		candles = append(candles, candle)
+		// a backtest holding twice the asset with a margin of 100.
+		equity = append(equity, EquityPoint{Time: candle.Period.End, Equity: 2 * (price - 100)})
+	}
+	// a point without a candle of the asset is skipped.
+	equity = append(equity, EquityPoint{Time: time.Unix(1000, 0), Equity: 50})
+
+	b := NewBenchmark("hold", equity, 100, 2, candles)
+	for _, v := range []struct {
+		name           string
+		actual, expect float64
+	}{
+		{"strategy return", b.StrategyReturn, 17.8},
+		{"return", b.Return, 17.8},
+		{"profit", b.Profit, 17.8},
+		{"excess", b.Excess, 0},
+	} {
+		if math.Abs(v.actual-v.expect) > 1e-9 {
+			t.Errorf("expected %s %f, got %f", v.name, v.expect, v.actual)
+		}
+	}
+	if b.Correlation < 0.99 {
+		t.Errorf("expected a correlation close to 1, got %f", b.Correlation)
+	}
+	if b.Beta <= 1 {
+		t.Errorf("expected a leveraged beta over 1, got %f", b.Beta)
+	}
+}
@@ -0,0 +1,139 @@
+package internal
+
+import (
+	"fmt"
+
+	"github.com/MShoaei/techan"
+	"github.com/sdcoffey/big"
+)
+
+// BothHitPolicy decides which level of a bracket is assumed to be hit first when a single candle touches both.
+type BothHitPolicy int
+
+const (
+	// StopFirst assumes the stop loss was hit first. This is the pessimistic choice.
+	StopFirst BothHitPolicy = iota
+	// TargetFirst assumes the take profit was hit first.
+	TargetFirst
+	// NearestFirst assumes the level closest to the open price of the candle was hit first.
+	NearestFirst
+)
+
+// ParseBothHitPolicy parses the name of a BothHitPolicy. valid names are stop, target and nearest.
+func ParseBothHitPolicy(name string) (BothHitPolicy, error) {
+	switch name {
+	case "stop":
+		return StopFirst, nil
+	case "target":
+		return TargetFirst, nil
+	case "nearest":
+		return NearestFirst, nil
+	}
+	return StopFirst, fmt.Errorf("invalid both hit policy: %s", name)
+}
+
+// Bracket describes the stop loss and take profit levels attached to a position when it is entered.
+// Percent values are in percent of the entry price and ATR values are multiples of the ATR at the entry candle.
+// When RewardRisk is set the take profit distance is RewardRisk times the stop loss distance.
+type Bracket struct {
+	StopPercent float64
+	TakePercent float64
+	StopATR     float64
+	TakeATR     float64
+	RewardRisk  float64
+	BothHit     BothHitPolicy
+
+	// ATR is used by the ATR based levels. a 14 period ATR is used if it is nil.
+	ATR techan.Indicator
+}
+
+// HasStop reports if the bracket sets a stop loss level.
+func (b Bracket) HasStop() bool {
+	return b.StopPercent > 0 || b.StopATR > 0
+}
+
+// HasTake reports if the bracket sets a take profit level.
+func (b Bracket) HasTake() bool {
+	return b.TakePercent > 0 || b.TakeATR > 0 || (b.RewardRisk > 0 && b.HasStop())
+}
+
+// Levels returns the stop loss and take profit prices of a position on side entered at price on the candle at index.
+// A level which is not set by the bracket is returned as big.ZERO.
+func (b Bracket) Levels(index int, side techan.OrderSide, price big.Decimal) (stop, take big.Decimal) {
+	stopDistance, takeDistance := big.ZERO, big.ZERO
+	switch {
+	case b.StopPercent > 0:
+		stopDistance = price.Mul(big.NewDecimal(b.StopPercent * 0.01))
+	case b.StopATR > 0:
+		stopDistance = b.ATR.Calculate(index).Mul(big.NewDecimal(b.StopATR))
+	}
+	switch {
+	case b.TakePercent > 0:
+		takeDistance = price.Mul(big.NewDecimal(b.TakePercent * 0.01))
+	case b.TakeATR > 0:
+		takeDistance = b.ATR.Calculate(index).Mul(big.NewDecimal(b.TakeATR))
+	case b.RewardRisk > 0:
+		takeDistance = stopDistance.Mul(big.NewDecimal(b.RewardRisk))
+	}
+
+	stop, take = big.ZERO, big.ZERO
+	if side == techan.BUY {
+		if !stopDistance.Zero() {
+			stop = price.Sub(stopDistance)
+		}
+		if !takeDistance.Zero() {
+			take = price.Add(takeDistance)
+		}
+	} else {
+		if !stopDistance.Zero() {
+			stop = price.Add(stopDistance)
+		}
+		if !takeDistance.Zero() {
+			take = price.Sub(takeDistance)
+		}
+	}
+	return stop, take
+}
+
+// Hit checks the high and low of candle against the stop and take levels of a position on side.
+// It returns the price the position would be closed at and true if either level was reached.
+// If the candle opens beyond a level the open price is used since the level could not have been filled.
+func (b Bracket) Hit(candle *techan.Candle, side techan.OrderSide, stop, take big.Decimal) (big.Decimal, bool) {
+	var stopHit, takeHit bool
+	if side == techan.BUY {
+		stopHit = !stop.Zero() && candle.MinPrice.LTE(stop)
+		takeHit = !take.Zero() && candle.MaxPrice.GTE(take)
+	} else {
+		stopHit = !stop.Zero() && candle.MaxPrice.GTE(stop)
+		takeHit = !take.Zero() && candle.MinPrice.LTE(take)
+	}
+
+	if stopHit && takeHit {
+		switch b.BothHit {
+		case TargetFirst:
+			stopHit = false
+		case NearestFirst:
+			if candle.OpenPrice.Sub(take).Abs().LT(candle.OpenPrice.Sub(stop).Abs()) {
+				stopHit = false
+			} else {
+				takeHit = false
+			}
+		default:
+			takeHit = false
+		}
+	}
+
+	switch {
+	case stopHit:
+		if (side == techan.BUY && candle.OpenPrice.LT(stop)) || (side == techan.SELL && candle.OpenPrice.GT(stop)) {
+			return candle.OpenPrice, true
+		}
+		return stop, true
+	case takeHit:
+		if (side == techan.BUY && candle.OpenPrice.GT(take)) || (side == techan.SELL && candle.OpenPrice.LT(take)) {
+			return candle.OpenPrice, true
+		}
+		return take, true
+	}
+	return big.ZERO, false
+}
@@ -0,0 +1,57 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/MShoaei/techan"
+	"github.com/sdcoffey/big"
+)
+
+func newTestCandle(open, high, low, close float64) *techan.Candle {
+	candle := techan.NewCandle(techan.NewTimePeriod(time.Unix(0, 0), time.Minute))
+	candle.OpenPrice = big.NewDecimal(open)
+	candle.MaxPrice = big.NewDecimal(high)
+	candle.MinPrice = big.NewDecimal(low)
+	candle.ClosePrice = big.NewDecimal(close)
+	return candle
+}
+
+func TestBracket_Levels(t *testing.T) {
+	b := Bracket{StopPercent: 2, RewardRisk: 3}
+	stop, take := b.Levels(0, techan.BUY, big.NewDecimal(100))
+	if stop.Float() != 98 || take.Float() != 106 {
+		t.Errorf("expected long levels 98/106, got %s/%s", stop, take)
+	}
+	stop, take = b.Levels(0, techan.SELL, big.NewDecimal(100))
+	if stop.Float() != 102 || take.Float() != 94 {
+		t.Errorf("expected short levels 102/94, got %s/%s", stop, take)
+	}
+}
+
+func TestBracket_Hit(t *testing.T) {
+	stop, take := big.NewDecimal(98), big.NewDecimal(106)
+	tests := []struct {
+		name   string
+		policy BothHitPolicy
+		candle *techan.Candle
+		hit    bool
+		expect float64
+	}{
+		{"no hit", StopFirst, newTestCandle(100, 105, 99, 101), false, 0},
+		{"stop", StopFirst, newTestCandle(100, 101, 97, 99), true, 98},
+		{"take", StopFirst, newTestCandle(100, 107, 99, 105), true, 106},
+		{"gap below stop", StopFirst, newTestCandle(95, 96, 94, 95), true, 95},
+		{"both stop first", StopFirst, newTestCandle(100, 107, 97, 100), true, 98},
+		{"both target first", TargetFirst, newTestCandle(100, 107, 97, 100), true, 106},
+		{"both nearest", NearestFirst, newTestCandle(105, 107, 97, 100), true, 106},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			price, hit := Bracket{BothHit: tt.policy}.Hit(tt.candle, techan.BUY, stop, take)
+			if hit != tt.hit || (hit && price.Float() != tt.expect) {
+				t.Errorf("expected %v at %f, got %v at %s", tt.hit, tt.expect, hit, price)
+			}
+		})
+	}
+}
@@ -0,0 +1,118 @@
+package internal
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/MShoaei/techan"
+	"github.com/sdcoffey/big"
+	log "github.com/sirupsen/logrus"
+)
+
+// DCA is a dollar-cost averaging plan traded by an Engine instead of its strategy. It buys Quote worth of the asset
+// every Every and whenever the close drops under the last buy by the next of Steps. Buys add to the open position,
+// which is sold once the close is TakeProfit percent over its average entry price.
+type DCA struct {
+	// Quote is the value of every buy in the quote asset, e.g. USDT.
+	Quote float64
+	// Every is the time between scheduled buys. buys are not scheduled if it is zero.
+	Every time.Duration
+	// Steps are the drops in percent under the last buy of a position which buy again, in the order they are used.
+	// the last step is repeated. a position is entered at once when there is no schedule.
+	Steps []float64
+	// TakeProfit is the gain in percent over the average entry price the position is sold at. the position is
+	// never sold if it is zero.
+	TakeProfit float64
+	// MaxBuys is the maximum number of buys of a position. 0 means no limit.
+	MaxBuys int
+}
+
+// Validate reports if the plan can not be traded.
+func (d DCA) Validate() error {
+	switch {
+	case d.Quote <= 0:
+		return fmt.Errorf("the quote amount of a DCA plan must be positive, got %v", d.Quote)
+	case d.Every < 0 || d.TakeProfit < 0 || d.MaxBuys < 0:
+		return fmt.Errorf("the schedule, take profit and maximum buys of a DCA plan can not be negative")
+	case d.Every == 0 && len(d.Steps) == 0:
+		return fmt.Errorf("a DCA plan needs a schedule or drop steps")
+	}
+	for _, step := range d.Steps {
+		if step <= 0 {
+			return fmt.Errorf("the drop steps of a DCA plan must be positive, got %v", step)
+		}
+	}
+	return nil
+}
+
+// dcaState is the progress of a DCA plan.
+type dcaState struct {
+	// last is the time of the last buy. price is its price and buys the number of buys of the open position.
+	last  time.Time
+	price big.Decimal
+	buys  int
+}
+
+// dca trades the DCA plan of the engine on candle, which just closed.
+func (e *Engine) dca(candle *techan.Candle) {
+	d := e.DCA
+	position := e.record.CurrentPosition()
+	if position.IsOpen() && d.TakeProfit > 0 {
+		entry := position.EntranceOrder()
+		if candle.ClosePrice.GTE(entry.Price.Mul(big.NewDecimal(1 + d.TakeProfit*0.01))) {
+			if e.execute(e.closeOrder(candle, techan.SELL, entry.Amount), Taker) {
+				e.dcaState.buys = 0
+			}
+			return
+		}
+	}
+	if d.MaxBuys > 0 && e.dcaState.buys >= d.MaxBuys {
+		return
+	}
+
+	var buy bool
+	switch {
+	case d.Every > 0 && (e.dcaState.last.IsZero() || !candle.Period.End.Before(e.dcaState.last.Add(d.Every))):
+		buy = true
+	case e.dcaState.buys == 0:
+		buy = d.Every == 0
+	case len(d.Steps) > 0:
+		step := d.Steps[len(d.Steps)-1]
+		if e.dcaState.buys-1 < len(d.Steps) {
+			step = d.Steps[e.dcaState.buys-1]
+		}
+		buy = candle.ClosePrice.LTE(e.dcaState.price.Mul(big.NewDecimal(1 - step*0.01)))
+	}
+	if !buy {
+		return
+	}
+	amount := e.LotSize.Round(big.NewDecimal(d.Quote).Div(candle.ClosePrice))
+	if amount.Zero() {
+		log.Infof("%s skipping DCA buy sized to zero at price: %s", e.Symbol, candle.ClosePrice)
+		return
+	}
+	if e.execute(e.closeOrder(candle, techan.BUY, amount), Taker) {
+		e.dcaState.last = candle.Period.End
+		e.dcaState.price = candle.ClosePrice
+		e.dcaState.buys++
+	}
+}
+
+// RunDCA runs the backtest of d through the Engine traded by the watchdog.
+func (bt *Backtest) RunDCA(d DCA, candleC <-chan *techan.Candle) (*techan.TimeSeries, *techan.TradingRecord) {
+	e := bt.engine(nil)
+	e.DCA = &d
+	e.Start(nil, nil)
+	return bt.replay(e, candleC)
+}
+
+// closeOrder returns a market order of amount on side at the close of candle.
+func (e *Engine) closeOrder(candle *techan.Candle, side techan.OrderSide, amount big.Decimal) techan.Order {
+	return techan.Order{
+		Side:          side,
+		Security:      e.Symbol,
+		Price:         candle.ClosePrice,
+		Amount:        amount,
+		ExecutionTime: candle.Period.End,
+	}
+}
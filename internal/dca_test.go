@@ -0,0 +1,75 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/MShoaei/techan"
+	"github.com/sdcoffey/big"
+)
+
+func runDCA(d DCA, prices []float64) (*Engine, *recordingExecutor) {
+	executor := &recordingExecutor{}
+	e := &Engine{Symbol: "ETHUSDT", DCA: &d, Executor: executor}
+	e.Start(nil, nil)
+	for i, price := range prices {
+		candle := techan.NewCandle(techan.NewTimePeriod(time.Unix(int64(i*60), 0), time.Minute))
+		candle.OpenPrice, candle.MaxPrice, candle.MinPrice, candle.ClosePrice = big.NewDecimal(price), big.NewDecimal(price), big.NewDecimal(price), big.NewDecimal(price)
+		candle.Volume = big.ONE
+		e.Handle(KlineEvent(e.Symbol, "1m", candle, true))
+	}
+	return e, executor
+}
+
+func TestEngine_DCASteps(t *testing.T) {
+	d := DCA{Quote: 100, Steps: []float64{10, 20}, TakeProfit: 5, MaxBuys: 3}
+	e, executor := runDCA(d, []float64{100, 95, 90, 80, 72, 60, 91, 92})
+
+	expected := []struct {
+		side  techan.OrderSide
+		price float64
+	}{{techan.BUY, 100}, {techan.BUY, 90}, {techan.BUY, 72}, {techan.SELL, 91}, {techan.BUY, 92}}
+	if len(executor.orders) != len(expected) {
+		t.Fatalf("expected %d orders, got %+v", len(expected), executor.orders)
+	}
+	for i, order := range executor.orders {
+		if order.Side != expected[i].side || order.Price.Float() != expected[i].price {
+			t.Errorf("expected order %d to be %v at %v, got %v at %s", i, expected[i].side, expected[i].price, order.Side, order.Price)
+		}
+	}
+	if amount := executor.orders[1].Amount.String(); amount != "1.111" {
+		t.Errorf("expected the second buy to be worth 100 at 90, got %s", amount)
+	}
+	if trades := len(e.Record().Trades); trades != 1 {
+		t.Errorf("expected 1 closed trade, got %d", trades)
+	}
+	if position := e.Record().CurrentPosition(); !position.IsOpen() || position.EntranceOrder().Price.Float() != 92 {
+		t.Errorf("expected a new position entered at 92 after the take profit")
+	}
+}
+
+func TestEngine_DCASchedule(t *testing.T) {
+	e, executor := runDCA(DCA{Quote: 100, Every: 2 * time.Minute}, []float64{100, 100, 100, 100, 100})
+	if len(executor.orders) != 3 {
+		t.Fatalf("expected a buy every 2 minutes, got %d", len(executor.orders))
+	}
+	if amount := e.Record().CurrentPosition().EntranceOrder().Amount.Float(); amount != 3 {
+		t.Errorf("expected the buys to add up to 3, got %f", amount)
+	}
+}
+
+func TestDCA_Validate(t *testing.T) {
+	if err := (DCA{Quote: 100, Every: time.Hour}).Validate(); err != nil {
+		t.Error(err)
+	}
+	for _, d := range []DCA{
+		{Every: time.Hour},
+		{Quote: 100},
+		{Quote: 100, Steps: []float64{1, 0}},
+		{Quote: 100, Every: time.Hour, TakeProfit: -1},
+	} {
+		if err := d.Validate(); err == nil {
+			t.Errorf("expected an error for %+v", d)
+		}
+	}
+}
@@ -0,0 +1,494 @@
+package internal
+
+import (
+	"context"
+	"time"
+
+	"github.com/MShoaei/techan"
+	"github.com/adshao/go-binance/v2"
+	"github.com/sdcoffey/big"
+	log "github.com/sirupsen/logrus"
+)
+
+// Executor places the orders of an Engine.
+type Executor interface {
+	// Execute places order and returns it as it was filled.
+	Execute(order techan.Order) (techan.Order, error)
+}
+
+// SimulatedExecutor fills every order at its price and time. It is used to replay stored klines through an Engine.
+type SimulatedExecutor struct{}
+
+// Execute returns order as it is.
+func (SimulatedExecutor) Execute(order techan.Order) (techan.Order, error) {
+	return order, nil
+}
+
+// BinanceExecutor places the orders of an Engine as limit orders on binance. Demo orders are only tested.
+type BinanceExecutor struct {
+	Client     *binance.Client
+	SymbolInfo binance.Symbol
+	Demo       bool
+}
+
+// Execute places order as a limit order at its price.
+func (b BinanceExecutor) Execute(order techan.Order) (techan.Order, error) {
+	side := binance.SideTypeBuy
+	if order.Side == techan.SELL {
+		side = binance.SideTypeSell
+	}
+	price := order.Price.FormattedString(b.SymbolInfo.QuotePrecision)
+	service := b.Client.NewCreateOrderService().
+		Symbol(order.Security).
+		Side(side).
+		Type(binance.OrderTypeLimit).
+		Quantity(order.Amount.String()).
+		TimeInForce(binance.TimeInForceTypeGTC).
+		Price(price)
+
+	var err error
+	if b.Demo {
+		err = service.Test(context.Background())
+	} else {
+		_, err = service.Do(context.Background())
+	}
+	if err != nil {
+		log.Errorf("%s, Qty: %s, Price: %s", order.Security, order.Amount, price)
+		return order, err
+	}
+	order.ExecutionTime = time.Now()
+	return order, nil
+}
+
+// Engine is the trading core shared by the live watchdog and the backtests. It is fed the kline events of a single
+// symbol and trades Strategy, one position at a time, through Executor once the klines are final.
+// Backtests replay stored klines through an Engine with a SimulatedExecutor, so they trade exactly like the live bot.
+type Engine struct {
+	Symbol   string
+	Risk     float64
+	Leverage int
+	// MaintenanceRate is the maintenance margin rate in percent. positions are liquidated at the liquidation
+	// price of their isolated margin when a candle reaches it if Liquidate is set.
+	MaintenanceRate float64
+	// Liquidate simulates the liquidations of the exchange. it is only set by backtests, since the exchange
+	// liquidates live positions itself.
+	Liquidate bool
+	Bracket   Bracket
+	// Fees are the fees paid by the trades of the engine. the commission of a long entry is paid in the bought
+	// asset, so its exit sells the amount left after it.
+	Fees FeeModel
+	// Capital is the starting equity passed to Sizer. the positions are never worth more than the equity with
+	// leverage if it is set.
+	Capital float64
+	// Sizer sizes the positions of the engine. every position uses Risk USD of margin if it is nil.
+	Sizer Sizer
+	// LotSize rounds the amounts of the positions.
+	LotSize LotSize
+	// Scaling scales the positions in and out. the partial exits are recorded as trades of their own.
+	Scaling Scaling
+	// Fill is the model used to fill the orders of the strategy. orders are filled at the close of the signal
+	// candle if it is nil. bracket exits are always filled at their level.
+	Fill FillModel
+	// Short trades the short side of Strategy too. only the long side is traded if it is false.
+	Short bool
+	// From is the time of the first candle on which orders may be placed. the candles before it only warm up the
+	// indicators of the strategy.
+	From time.Time
+	// Strategy is the strategy traded by the engine. the DefaultStrategy is traded if it is nil.
+	Strategy MultiTimeframeStrategyFunc
+	// DCA is the dollar-cost averaging plan traded by the engine instead of Strategy if it is set.
+	DCA      *DCA
+	Executor Executor
+
+	series      *techan.TimeSeries
+	record      *techan.TradingRecord
+	higher      map[string]*HigherSeries
+	long, short techan.RuleStrategy
+	bracket     Bracket
+	stop, take  big.Decimal
+	liquidation big.Decimal
+	scale       scaleState
+	fill        FillModel
+	pending     *PendingOrder
+	dcaState    dcaState
+}
+
+// Start prepares the engine to trade after the candles of history and the higher timeframe series in higher, which
+// must be built alongside the series returned by Series. The last candle of history may still be open.
+func (e *Engine) Start(history []*techan.Candle, higher map[string]*HigherSeries) {
+	series := e.Series()
+	for _, candle := range history {
+		series.AddCandle(candle)
+	}
+	e.record = techan.NewTradingRecord()
+	e.higher = higher
+	strategy := e.Strategy
+	if strategy == nil {
+		info, _ := LookupStrategy(DefaultStrategy)
+		strategy = info.New(nil)
+	}
+	e.long, e.short = strategy(e.series, higher)
+	e.bracket = e.Bracket
+	if e.bracket.ATR == nil {
+		e.bracket.ATR = techan.NewAverageTrueRangeIndicator(e.series, 14)
+	}
+	e.fill = e.Fill
+	if e.fill == nil {
+		e.fill = CloseFill{}
+	}
+	e.stop, e.take, e.liquidation = big.ZERO, big.ZERO, big.ZERO
+	e.scale = scaleState{}
+	e.pending = nil
+	e.dcaState = dcaState{}
+}
+
+// Series returns the series of the candles handled by the engine.
+func (e *Engine) Series() *techan.TimeSeries {
+	if e.series == nil {
+		e.series = techan.NewTimeSeries()
+	}
+	return e.series
+}
+
+// Record returns the trades of the engine.
+func (e *Engine) Record() *techan.TradingRecord {
+	return e.record
+}
+
+// Handle handles a kline event. It has the signature of binance.WsKlineHandler.
+// The strategy is only evaluated once the kline is final.
+func (e *Engine) Handle(event *binance.WsKlineEvent) {
+	log.Debugln(event)
+	candle, final := e.add(event)
+	if !final || !e.ready(candle) {
+		return
+	}
+	if e.DCA != nil {
+		e.dca(candle)
+		return
+	}
+	if e.manage(candle) {
+		e.open(candle)
+	}
+}
+
+// add adds the kline of event to the series, or updates the last candle with it, and returns its candle and if the
+// kline is final. Klines older than the last candle are ignored.
+func (e *Engine) add(event *binance.WsKlineEvent) (*techan.Candle, bool) {
+	k := event.Kline
+	start := msTime(k.StartTime)
+	candle := e.series.LastCandle()
+	if candle == nil || start.After(candle.Period.Start) {
+		candle = techan.NewCandle(techan.TimePeriod{Start: start, End: msTime(k.EndTime)})
+		e.series.AddCandle(candle)
+	} else if start.Before(candle.Period.Start) {
+		return candle, false
+	}
+	candle.OpenPrice = big.NewFromString(k.Open)
+	candle.ClosePrice = big.NewFromString(k.Close)
+	candle.MaxPrice = big.NewFromString(k.High)
+	candle.MinPrice = big.NewFromString(k.Low)
+	candle.Volume = big.NewFromString(k.Volume)
+	candle.TradeCount = uint(k.TradeNum)
+	return candle, k.IsFinal
+}
+
+// ready updates the higher timeframe series with candle, which just closed, and reports if orders may be placed on it.
+func (e *Engine) ready(candle *techan.Candle) bool {
+	for _, h := range e.higher {
+		h.Update(candle)
+	}
+	return !candle.Period.Start.Before(e.From)
+}
+
+// manage fills the pending order, closes the open position or parts of it when candle reaches its liquidation price,
+// bracket or targets and places the exit the strategy calls for. It reports if a position may be opened or added to
+// on candle.
+func (e *Engine) manage(candle *techan.Candle) bool {
+	e.fillPending(candle)
+	if !e.liquidate(candle) && !e.exitBracket(candle) {
+		e.takeTargets(candle)
+	}
+	if e.pending != nil {
+		return false
+	}
+	if position := e.record.CurrentPosition(); position.IsOpen() && e.shouldExit() {
+		log.Debugf("%s exit signal at price: %f", e.Symbol, candle.ClosePrice.Float())
+		log.Debugln(e.series.LastIndex(), candle)
+		e.place(candle, exitSide(position), position.EntranceOrder().Amount, true)
+		return false
+	}
+	return true
+}
+
+// open adds to the open position or opens a new one if the strategy calls for it.
+func (e *Engine) open(candle *techan.Candle) {
+	if position := e.record.CurrentPosition(); position.IsOpen() {
+		e.scaleIn(candle, position.EntranceOrder().Side)
+		return
+	}
+	if side, ok := e.shouldEnter(); ok {
+		log.Debugf("%s %s entry signal at price: %f", e.Symbol, sideName(side), candle.ClosePrice.Float())
+		log.Debugln(e.series.LastIndex(), candle)
+		amount := e.size(candle, side)
+		if amount.Zero() {
+			log.Debugf("%s skipping %s entry sized to zero at price: %s", e.Symbol, sideName(side), candle.ClosePrice)
+			return
+		}
+		e.place(candle, side, amount, false)
+	}
+}
+
+// size returns the amount of a position entered on candle.
+func (e *Engine) size(candle *techan.Candle, side techan.OrderSide) big.Decimal {
+	sizer := e.Sizer
+	if sizer == nil {
+		sizer = FixedSizer{Margin: e.Risk}
+	}
+	ctx := SizeContext{
+		Side:     side,
+		Price:    candle.ClosePrice,
+		Equity:   e.Capital + TotalProfitAnalysis{Fees: e.Fees}.Analyze(e.record),
+		Leverage: e.Leverage,
+		ATR:      e.bracket.ATR.Calculate(e.series.LastIndex()),
+		Record:   e.record,
+		Fees:     e.Fees,
+	}
+	ctx.Stop, _ = e.bracket.Levels(e.series.LastIndex(), side, candle.ClosePrice)
+	amount := sizer.Size(ctx)
+	if e.Capital > 0 {
+		amount = big.MinSlice(amount, notional(ctx.Equity, ctx))
+	}
+	return e.LotSize.Round(amount)
+}
+
+// place places an order on candle and tries to fill it right away.
+func (e *Engine) place(candle *techan.Candle, side techan.OrderSide, amount big.Decimal, exit bool) {
+	e.pending = &PendingOrder{
+		Side:     side,
+		Security: e.Symbol,
+		Amount:   amount,
+		Price:    candle.ClosePrice,
+		Index:    e.series.LastIndex(),
+		Exit:     exit,
+	}
+	e.fillPending(candle)
+}
+
+func (e *Engine) fillPending(candle *techan.Candle) {
+	if e.pending == nil {
+		return
+	}
+	order, status := e.fill.Fill(*e.pending, candle, e.series.LastIndex())
+	switch status {
+	case Filled:
+		log.Debugf("%s filled %s at price: %f", e.Symbol, order.Amount, order.Price.Float())
+		e.pending = nil
+		e.execute(order, e.fill.Liquidity())
+	case Cancelled:
+		log.Debugf("%s cancelled order placed at index %d", e.Symbol, e.pending.Index)
+		e.pending = nil
+	}
+}
+
+// execute places order, which is filled with liquidity, through the executor and adds it to the record once it is
+// filled. It reports if the order was filled.
+func (e *Engine) execute(order techan.Order, liquidity Liquidity) bool {
+	sent := order
+	if position := e.record.CurrentPosition(); position.IsLong() && order.Side == techan.SELL {
+		// the commission of the entry was paid in the bought asset, so less of it is left to sell.
+		entry, _ := e.Fees.liquidity(position)
+		sent.Amount = e.LotSize.Round(order.Amount.Sub(order.Amount.Mul(big.NewDecimal(e.Fees.rate(entry) * 0.01))))
+		if sent.Amount.Zero() {
+			log.Errorf("%s cannot exit %s after the commission at price: %s", e.Symbol, order.Amount, order.Price)
+			return false
+		}
+	}
+	filled, err := e.Executor.Execute(sent)
+	if err != nil {
+		log.Errorf("%s %s order failed: %v", e.Symbol, sideName(order.Side), err)
+		return false
+	}
+	// the trade is recorded with the amount of the position, as the commission is accounted for by Fees.
+	filled.Amount = order.Amount
+	e.operate(filled, liquidity)
+	return true
+}
+
+// operate adds order, which was filled with liquidity, to the record and sets the bracket levels from the average
+// entry price if it opens or adds to a position. the levels are kept on partial exits.
+func (e *Engine) operate(order techan.Order, liquidity Liquidity) {
+	position := e.record.CurrentPosition()
+	adding := position.IsOpen() && order.Side == position.EntranceOrder().Side
+	trades := len(e.record.Trades)
+	opened := e.scale.operate(e.record, order)
+	e.Fees.Journal.operate(position, e.record.Trades[trades:], order, liquidity)
+	if !opened && !adding {
+		return
+	}
+	entry := e.record.CurrentPosition().EntranceOrder()
+	e.stop, e.take = e.bracket.Levels(e.series.LastIndex(), entry.Side, entry.Price)
+	e.liquidation = e.Margin().LiquidationPrice(entry.Side, entry.Price)
+	if opened && !e.stop.Zero() {
+		e.scale.risk = entry.Price.Sub(e.stop).Abs()
+	}
+}
+
+// scaleIn adds to the open position of side if Scaling allows another entry and the strategy signals one.
+func (e *Engine) scaleIn(candle *techan.Candle, side techan.OrderSide) {
+	rs := e.long
+	if side == techan.SELL {
+		rs = e.short
+	}
+	if !e.Scaling.canAdd(&e.scale, rs, e.series.LastIndex(), e.record) {
+		return
+	}
+	amount := e.size(candle, side)
+	if amount.Zero() {
+		return
+	}
+	log.Debugf("%s adding to %s position at price: %f", e.Symbol, sideName(side), candle.ClosePrice.Float())
+	e.place(candle, side, amount, false)
+}
+
+// takeTargets closes the parts of the open position whose targets candle reaches and trails the stop loss of the
+// rest.
+func (e *Engine) takeTargets(candle *techan.Candle) {
+	for {
+		position := e.record.CurrentPosition()
+		if !position.IsOpen() {
+			return
+		}
+		side := position.EntranceOrder().Side
+		level, amount, ok := e.Scaling.nextTarget(&e.scale, e.record)
+		if !ok {
+			break
+		}
+		price, hit := e.bracket.Hit(candle, side, big.ZERO, level)
+		if !hit {
+			break
+		}
+		e.scale.taken++
+		if amount = e.LotSize.Round(amount); amount.Zero() {
+			continue
+		}
+		log.Debugf("%s target %d hit at price: %f", e.Symbol, e.scale.taken, price.Float())
+		// targets are limit orders resting on the order book.
+		e.execute(techan.Order{
+			Side:          exitSide(position),
+			Security:      e.Symbol,
+			Price:         price,
+			Amount:        amount,
+			ExecutionTime: candle.Period.Start,
+		}, Maker)
+	}
+	if position := e.record.CurrentPosition(); position.IsOpen() {
+		e.stop = e.Scaling.trailStop(&e.scale, position.EntranceOrder().Side, candle.ClosePrice,
+			e.bracket.ATR.Calculate(e.series.LastIndex()), e.stop)
+	}
+}
+
+// liquidate closes the open position at its liquidation price if candle reaches it before the stop loss and the
+// engine simulates liquidations.
+func (e *Engine) liquidate(candle *techan.Candle) bool {
+	position := e.record.CurrentPosition()
+	if !e.Liquidate || !position.IsOpen() {
+		return false
+	}
+	side := position.EntranceOrder().Side
+	if !e.Margin().Reached(candle, side, e.liquidation) {
+		return false
+	}
+	if !e.stop.Zero() && ((side == techan.BUY && e.stop.GT(e.liquidation)) || (side == techan.SELL && e.stop.LT(e.liquidation))) {
+		return false
+	}
+	log.Debugf("%s liquidated at price: %f", e.Symbol, e.liquidation.Float())
+	log.Debugln(e.series.LastIndex(), candle)
+	e.pending = nil
+	if !e.execute(techan.Order{
+		Side:          exitSide(position),
+		Security:      e.Symbol,
+		Price:         e.liquidation,
+		Amount:        position.EntranceOrder().Amount,
+		ExecutionTime: candle.Period.Start,
+	}, Taker) {
+		return false
+	}
+	e.Fees.Journal.liquidate(e.record.LastTrade())
+	return true
+}
+
+// exitBracket closes the open position if candle reaches its stop loss or take profit level. The stop loss is
+// filled as a market order and the take profit as a limit order resting on the order book.
+func (e *Engine) exitBracket(candle *techan.Candle) bool {
+	position := e.record.CurrentPosition()
+	if !position.IsOpen() {
+		return false
+	}
+	side := position.EntranceOrder().Side
+	price, ok := e.bracket.Hit(candle, side, e.stop, e.take)
+	if !ok {
+		return false
+	}
+	liquidity := Maker
+	if !e.stop.Zero() && ((side == techan.BUY && price.LTE(e.stop)) || (side == techan.SELL && price.GTE(e.stop))) {
+		liquidity = Taker
+	}
+	log.Debugf("%s bracket hit at price: %f", e.Symbol, price.Float())
+	log.Debugln(e.series.LastIndex(), candle)
+	e.pending = nil
+	return e.execute(techan.Order{
+		Side:          exitSide(position),
+		Security:      e.Symbol,
+		Price:         price,
+		Amount:        position.EntranceOrder().Amount,
+		ExecutionTime: candle.Period.Start,
+	}, liquidity)
+}
+
+func (e *Engine) shouldExit() bool {
+	position := e.record.CurrentPosition()
+	return (position.IsLong() && e.long.ShouldExit(e.series.LastIndex(), e.record)) ||
+		(position.IsShort() && e.short.ShouldExit(e.series.LastIndex(), e.record))
+}
+
+func (e *Engine) shouldEnter() (techan.OrderSide, bool) {
+	switch {
+	case e.long.ShouldEnter(e.series.LastIndex(), e.record):
+		return techan.BUY, true
+	case e.Short && e.short.ShouldEnter(e.series.LastIndex(), e.record):
+		return techan.SELL, true
+	}
+	return techan.BUY, false
+}
+
+// Margin returns the margin of the positions of the engine.
+func (e *Engine) Margin() Margin {
+	return Margin{Leverage: e.Leverage, MaintenanceRate: e.MaintenanceRate}
+}
+
+// KlineEvent returns the kline event of candle as it is sent by the binance kline stream.
+func KlineEvent(symbol, interval string, candle *techan.Candle, final bool) *binance.WsKlineEvent {
+	return &binance.WsKlineEvent{
+		Event:  "kline",
+		Time:   candle.Period.End.UnixNano() / int64(time.Millisecond),
+		Symbol: symbol,
+		Kline: binance.WsKline{
+			StartTime: candle.Period.Start.UnixNano() / int64(time.Millisecond),
+			EndTime:   candle.Period.End.UnixNano() / int64(time.Millisecond),
+			Symbol:    symbol,
+			Interval:  interval,
+			Open:      candle.OpenPrice.String(),
+			Close:     candle.ClosePrice.String(),
+			High:      candle.MaxPrice.String(),
+			Low:       candle.MinPrice.String(),
+			Volume:    candle.Volume.String(),
+			TradeNum:  int64(candle.TradeCount),
+			IsFinal:   final,
+		},
+	}
+}
+
+func msTime(ms int64) time.Time {
+	return time.Unix(0, ms*int64(time.Millisecond))
+}
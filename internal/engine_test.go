@@ -0,0 +1,148 @@
+package internal
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/MShoaei/techan"
+	"github.com/sdcoffey/big"
+)
+
+type recordingExecutor struct {
+	orders []techan.Order
+}
+
+func (r *recordingExecutor) Execute(order techan.Order) (techan.Order, error) {
+	r.orders = append(r.orders, order)
+	return order, nil
+}
+
+func TestEngine_Handle(t *testing.T) {
+	executor := &recordingExecutor{}
+	e := &Engine{
+		Symbol:   "ETHUSDT",
+		Risk:     100,
+		Fees:     FlatFee(0.1),
+		Leverage: 1,
+		Strategy: func(series *techan.TimeSeries, _ map[string]*HigherSeries) (long, short techan.RuleStrategy) {
+			closePrice := techan.NewClosePriceIndicator(series)
+			long = techan.RuleStrategy{
+				EntryRule: techan.OverIndicatorRule{First: closePrice, Second: techan.NewConstantIndicator(100)},
+				ExitRule:  techan.UnderIndicatorRule{First: closePrice, Second: techan.NewConstantIndicator(100)},
+			}
+			return long, short
+		},
+		Executor: executor,
+	}
+	e.Start(nil, nil)
+
+	for i, price := range []float64{90, 110, 105, 95} {
+		candle := techan.NewCandle(techan.NewTimePeriod(time.Unix(int64(i*60), 0), time.Minute))
+		candle.OpenPrice, candle.MaxPrice, candle.MinPrice, candle.Volume = big.NewDecimal(price), big.NewDecimal(price), big.NewDecimal(price), big.ONE
+		// an open kline crossing the rules must not trade.
+		candle.ClosePrice = big.NewDecimal(200 - price)
+		e.Handle(KlineEvent(e.Symbol, "1m", candle, false))
+		candle.ClosePrice = big.NewDecimal(price)
+		e.Handle(KlineEvent(e.Symbol, "1m", candle, true))
+	}
+
+	if len(e.Series().Candles) != 4 {
+		t.Fatalf("expected 4 candles, got %d", len(e.Series().Candles))
+	}
+	if len(executor.orders) != 2 {
+		t.Fatalf("expected 2 orders, got %d", len(executor.orders))
+	}
+	if buy := executor.orders[0]; buy.Side != techan.BUY || buy.Amount.String() != "0.909" || buy.Price.Float() != 110 {
+		t.Errorf("unexpected buy order %+v", buy)
+	}
+	if sell := executor.orders[1]; sell.Side != techan.SELL || sell.Amount.String() != "0.908" || sell.Price.Float() != 95 {
+		t.Errorf("unexpected sell order %+v", sell)
+	}
+	trades := e.Record().Trades
+	if len(trades) != 1 || trades[0].ExitOrder().Amount.String() != "0.909" {
+		t.Errorf("expected one trade recorded with the entry amount, got %+v", trades)
+	}
+}
+
+func TestEngine_Liquidity(t *testing.T) {
+	fees := FeeModel{Maker: 0, Taker: 1, Journal: NewJournal()}
+	e := &Engine{
+		Symbol:   "ETHUSDT",
+		Risk:     100,
+		Leverage: 1,
+		Fees:     fees,
+		Bracket:  Bracket{StopPercent: 10},
+		Fill:     LimitFill{},
+		Strategy: func(series *techan.TimeSeries, _ map[string]*HigherSeries) (long, short techan.RuleStrategy) {
+			closePrice := techan.NewClosePriceIndicator(series)
+			long = techan.RuleStrategy{
+				EntryRule: techan.OverIndicatorRule{First: closePrice, Second: techan.NewConstantIndicator(100)},
+				ExitRule:  techan.OverIndicatorRule{First: closePrice, Second: techan.NewConstantIndicator(1000)},
+			}
+			return long, short
+		},
+		Executor: SimulatedExecutor{},
+	}
+	e.Start(nil, nil)
+
+	// the limit entry placed at 110 is filled on the third candle and the stop loss at 99 on the fourth.
+	for i, candle := range []*techan.Candle{
+		newTestCandle(90, 90, 90, 90),
+		newTestCandle(110, 110, 110, 110),
+		newTestCandle(110, 111, 105, 108),
+		newTestCandle(100, 100, 95, 96),
+	} {
+		candle.Period = techan.NewTimePeriod(time.Unix(int64(i*60), 0), time.Minute)
+		e.Handle(KlineEvent(e.Symbol, "1m", candle, true))
+	}
+
+	trades := e.Record().Trades
+	if len(trades) != 1 {
+		t.Fatalf("expected 1 trade, got %d", len(trades))
+	}
+	if entry, exit := fees.liquidity(trades[0]); entry != Maker || exit != Taker {
+		t.Errorf("expected a maker entry and a taker exit, got %d and %d", entry, exit)
+	}
+	// only the taker exit pays fees: 0.909 * 99 * 1%.
+	if got := fees.Fees(trades[0]).Float(); math.Abs(got-0.89991) > 1e-9 {
+		t.Errorf("expected fees of 0.89991, got %f", got)
+	}
+}
+
+func TestWatchdog_WatchFractional(t *testing.T) {
+	if _, _, err := (&Watchdog{Sizer: FixedFractionalSizer{Percent: 1}}).Watch(nil); err == nil {
+		t.Errorf("expected the fixed fractional sizer to be rejected")
+	}
+}
+
+func TestWatchdog_EngineDoesNotLiquidate(t *testing.T) {
+	executor := &recordingExecutor{}
+	w := &Watchdog{
+		Symbol:   "ETHUSDT",
+		Risk:     10,
+		Leverage: 10,
+		Strategy: func(*techan.TimeSeries, map[string]*HigherSeries) (long, short techan.RuleStrategy) {
+			long = techan.RuleStrategy{EntryRule: constantRule(true), ExitRule: constantRule(false)}
+			short = techan.RuleStrategy{EntryRule: constantRule(false), ExitRule: constantRule(false)}
+			return long, short
+		},
+	}
+	e := w.Engine(LotSize{}, executor)
+	e.Start(nil, nil)
+	// the long entered at 100 reaches its liquidation price of about 90 on the last candle.
+	for i, candle := range []*techan.Candle{
+		newTestCandle(100, 100, 100, 100),
+		newTestCandle(100, 100, 100, 100),
+		newTestCandle(100, 100, 80, 85),
+	} {
+		candle.Period = techan.NewTimePeriod(time.Unix(int64(i*60), 0), time.Minute)
+		e.Handle(KlineEvent(e.Symbol, "1m", candle, true))
+	}
+	if len(executor.orders) != 1 || executor.orders[0].Side != techan.BUY {
+		t.Errorf("expected only the entry to be sent to the exchange, got %+v", executor.orders)
+	}
+	if !e.Record().CurrentPosition().IsOpen() {
+		t.Errorf("expected the position to be left to the exchange")
+	}
+}
@@ -0,0 +1,208 @@
+package internal
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/MShoaei/techan"
+)
+
+// ExitPolicy decides when the members of an Ensemble close its position.
+type ExitPolicy int
+
+const (
+	// ExitAny exits when any member signals an exit.
+	ExitAny ExitPolicy = iota
+	// ExitAll exits when every member signals an exit.
+	ExitAll
+	// ExitMajority exits when the members signalling an exit have more than half of the total weight.
+	ExitMajority
+)
+
+func (e ExitPolicy) String() string {
+	switch e {
+	case ExitAny:
+		return "any"
+	case ExitAll:
+		return "all"
+	case ExitMajority:
+		return "majority"
+	}
+	return fmt.Sprintf("ExitPolicy(%d)", int(e))
+}
+
+// EnsembleMember is a strategy voting in an Ensemble. Its signals count Weight times.
+type EnsembleMember struct {
+	Strategy DynamicStrategyFunc
+	Weight   float64
+}
+
+// Ensemble is a strategy trading the signals of its members. It enters when the total weight of the members
+// signalling an entry reaches Quorum and exits according to Exit.
+type Ensemble struct {
+	Members []EnsembleMember
+	Quorum  float64
+	Exit    ExitPolicy
+	// Memory is the number of candles a signal of a member counts for, so members whose signals are a few
+	// candles apart can agree. signals only count on their own candle if it is less than 2.
+	Memory int
+}
+
+// Strategy returns the long and short strategies of the ensemble.
+func (e Ensemble) Strategy() DynamicStrategyFunc {
+	return func(series *techan.TimeSeries) (long, short techan.RuleStrategy) {
+		longVote := e.vote()
+		shortVote := e.vote()
+		for _, m := range e.Members {
+			if m.Weight == 0 {
+				continue
+			}
+			l, s := m.Strategy(series)
+			longVote.add(l, m.Weight)
+			shortVote.add(s, m.Weight)
+		}
+		return longVote.strategy(e), shortVote.strategy(e)
+	}
+}
+
+func (e Ensemble) vote() *ensembleVote {
+	return &ensembleVote{entry: voteRule{memory: e.Memory}, exit: voteRule{memory: e.Memory}}
+}
+
+// ensembleVote collects the rules of the members of an Ensemble for a side.
+type ensembleVote struct {
+	entry, exit voteRule
+	unstable    int
+}
+
+func (v *ensembleVote) add(s techan.RuleStrategy, weight float64) {
+	v.entry.rules = append(v.entry.rules, s.EntryRule)
+	v.entry.weights = append(v.entry.weights, weight)
+	v.exit.rules = append(v.exit.rules, s.ExitRule)
+	v.exit.weights = append(v.exit.weights, weight)
+	if s.UnstablePeriod > v.unstable {
+		v.unstable = s.UnstablePeriod
+	}
+}
+
+func (v *ensembleVote) strategy(e Ensemble) techan.RuleStrategy {
+	var total float64
+	for _, w := range v.exit.weights {
+		total += w
+	}
+	v.entry.passes = func(score float64) bool { return score >= e.Quorum }
+	switch e.Exit {
+	case ExitAll:
+		v.exit.passes = func(score float64) bool { return score >= total }
+	case ExitMajority:
+		v.exit.passes = func(score float64) bool { return score > total/2 }
+	default:
+		v.exit.passes = func(score float64) bool { return score > 0 }
+	}
+	return techan.RuleStrategy{EntryRule: v.entry, ExitRule: v.exit, UnstablePeriod: v.unstable}
+}
+
+// voteRule is satisfied when passes accepts the total weight of the rules satisfied in the last memory candles.
+type voteRule struct {
+	rules   []techan.Rule
+	weights []float64
+	memory  int
+	passes  func(score float64) bool
+}
+
+func (v voteRule) IsSatisfied(index int, record *techan.TradingRecord) bool {
+	var score float64
+	for i, rule := range v.rules {
+		for k := 0; k == 0 || (k < v.memory && index-k >= 0); k++ {
+			if rule.IsSatisfied(index-k, record) {
+				score += v.weights[i]
+				break
+			}
+		}
+	}
+	return v.passes(score)
+}
+
+// ensembleMembers are the registered strategies voting in the ensemble strategy.
+var ensembleMembers = []string{"bollinger-stoch", "macd", "ema", "ichimoku"}
+
+// EnsembleDefaults are the default parameters of NewEnsembleStrategy, except the parameters of its members which
+// are named member.param, e.g. macd.fast, and default to the defaults of the member.
+var EnsembleDefaults = Params{
+	"quorum":                 2,
+	"exit":                   float64(ExitAny),
+	"memory":                 1,
+	"bollinger-stoch.weight": 1,
+	"macd.weight":            1,
+	"ema.weight":             1,
+	"ichimoku.weight":        1,
+}
+
+// NewEnsembleStrategy returns the Ensemble of the bollinger-stoch, macd, ema and ichimoku strategies. The weight of
+// a member is its member.weight parameter, a weight of 0 leaves it out.
+func NewEnsembleStrategy(p Params) DynamicStrategyFunc {
+	p = EnsembleDefaults.With(p)
+	e := Ensemble{Quorum: p["quorum"], Exit: ExitPolicy(p.Int("exit")), Memory: p.Int("memory")}
+	for _, name := range ensembleMembers {
+		info, err := LookupStrategy(name)
+		if err != nil {
+			panic(err)
+		}
+		f, err := info.ParamStrategy()
+		if err != nil {
+			panic(err)
+		}
+		params := make(Params)
+		for param, value := range p {
+			if strings.HasPrefix(param, name+".") {
+				params[strings.TrimPrefix(param, name+".")] = value
+			}
+		}
+		weight := params["weight"]
+		delete(params, "weight")
+		e.Members = append(e.Members, EnsembleMember{Strategy: f(params), Weight: weight})
+	}
+	return e.Strategy()
+}
+
+// ensembleInfo returns the registry entry of the ensemble strategy. The parameters of the members must be
+// registered before it.
+func ensembleInfo() StrategyInfo {
+	info := StrategyInfo{
+		Name:        "ensemble",
+		Description: "enters when enough of the bollinger-stoch, macd, ema and ichimoku strategies agree and exits by the exit policy",
+		Defaults:    EnsembleDefaults.With(nil),
+		Schema: []ParamInfo{
+			{Name: "quorum", Description: "total weight of the members which must signal an entry. at most the total weight of the members", Positive: true},
+			{Name: "exit", Description: "0 exits when any member exits, 1 when all of them do and 2 when members with most of the weight do", Integer: true, Max: 2, NonNegative: true},
+			window("memory", "number of candles a signal of a member counts for"),
+		},
+		New:      single(NewEnsembleStrategy),
+		Validate: validateEnsemble,
+	}
+	for _, name := range ensembleMembers {
+		member, err := LookupStrategy(name)
+		if err != nil {
+			panic(err)
+		}
+		info.Schema = append(info.Schema, ParamInfo{Name: name + ".weight", Description: "weight of the votes of " + name + ". 0 leaves it out", NonNegative: true})
+		for _, param := range member.Schema {
+			info.Defaults[name+"."+param.Name] = member.Defaults[param.Name]
+			param.Name = name + "." + param.Name
+			info.Schema = append(info.Schema, param)
+		}
+	}
+	return info
+}
+
+// validateEnsemble reports if the quorum of p can never be reached by the weights of the members.
+func validateEnsemble(p Params) error {
+	var total float64
+	for _, name := range ensembleMembers {
+		total += p[name+".weight"]
+	}
+	if p["quorum"] > total {
+		return fmt.Errorf("the quorum %v is more than the total weight %v of the members", p["quorum"], total)
+	}
+	return nil
+}
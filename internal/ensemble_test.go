@@ -0,0 +1,96 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/MShoaei/techan"
+)
+
+// indexRule is satisfied at the indices it contains.
+type indexRule map[int]bool
+
+func (r indexRule) IsSatisfied(index int, record *techan.TradingRecord) bool {
+	return r[index]
+}
+
+func ruleMember(entry, exit indexRule, unstable int, weight float64) EnsembleMember {
+	return EnsembleMember{
+		Strategy: func(series *techan.TimeSeries) (long, short techan.RuleStrategy) {
+			long = techan.RuleStrategy{EntryRule: entry, ExitRule: exit, UnstablePeriod: unstable}
+			return long, long
+		},
+		Weight: weight,
+	}
+}
+
+func TestEnsemble(t *testing.T) {
+	members := []EnsembleMember{
+		ruleMember(indexRule{1: true, 3: true}, indexRule{5: true, 6: true}, 10, 1),
+		ruleMember(indexRule{1: true, 4: true}, indexRule{6: true, 7: true}, 20, 1),
+		ruleMember(indexRule{2: true}, indexRule{6: true, 7: true}, 5, 2),
+		ruleMember(indexRule{1: true, 2: true, 4: true}, indexRule{}, 50, 0),
+	}
+	record := techan.NewTradingRecord()
+	satisfied := func(rule techan.Rule) []int {
+		var indices []int
+		for i := 0; i < 10; i++ {
+			if rule.IsSatisfied(i, record) {
+				indices = append(indices, i)
+			}
+		}
+		return indices
+	}
+	equal := func(a, b []int) bool {
+		if len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if a[i] != b[i] {
+				return false
+			}
+		}
+		return true
+	}
+
+	tests := []struct {
+		name         string
+		quorum       float64
+		exit         ExitPolicy
+		memory       int
+		entry, exits []int
+	}{
+		{"any", 2, ExitAny, 1, []int{1, 2}, []int{5, 6, 7}},
+		{"all", 2, ExitAll, 1, []int{1, 2}, []int{6}},
+		{"majority", 2, ExitMajority, 1, []int{1, 2}, []int{6, 7}},
+		{"quorum", 3, ExitAny, 1, nil, []int{5, 6, 7}},
+		{"memory", 2, ExitAll, 2, []int{1, 2, 3, 4}, []int{6, 7}},
+	}
+	for _, tt := range tests {
+		e := Ensemble{Members: members, Quorum: tt.quorum, Exit: tt.exit, Memory: tt.memory}
+		long, _ := e.Strategy()(techan.NewTimeSeries())
+		if got := satisfied(long.EntryRule); !equal(got, tt.entry) {
+			t.Errorf("%s: expected entries at %v, got %v", tt.name, tt.entry, got)
+		}
+		if got := satisfied(long.ExitRule); !equal(got, tt.exits) {
+			t.Errorf("%s: expected exits at %v, got %v", tt.name, tt.exits, got)
+		}
+		if long.UnstablePeriod != 20 {
+			t.Errorf("%s: expected the unstable period of the voting members 20, got %d", tt.name, long.UnstablePeriod)
+		}
+	}
+}
+
+func TestEnsembleParams(t *testing.T) {
+	info, err := LookupStrategy("ensemble")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := info.Params(Params{"quorum": 3, "ema.weight": 0}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	for _, overrides := range []Params{{"quorum": 0}, {"quorum": -1}, {"ema.weight": -1}, {"quorum": 5}, {"quorum": 3, "ema.weight": 0, "macd.weight": 0}} {
+		if _, err := info.Params(overrides); err == nil {
+			t.Errorf("expected an error for %v", overrides)
+		}
+	}
+}
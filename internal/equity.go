@@ -0,0 +1,136 @@
+package internal
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/MShoaei/techan"
+	"github.com/sdcoffey/big"
+)
+
+// EquityPoint is the state of a backtest at the end of a candle.
+type EquityPoint struct {
+	Time time.Time `json:"time"`
+	// Realized is the net profit of the trades closed until the end of the candle.
+	Realized float64 `json:"realized"`
+	// Open is the net profit of the open position if it was closed at the close of the candle.
+	Open     float64 `json:"open"`
+	Equity   float64 `json:"equity"`
+	Drawdown float64 `json:"drawdown"`
+	// Position is long, short or empty if no position is open.
+	Position   string  `json:"position"`
+	Amount     float64 `json:"amount"`
+	EntryPrice float64 `json:"entryPrice"`
+}
+
+// EquityCurve returns the equity of the backtest which traded record on the candles of series, one point per
+// candle. The equity is the realized and the open profit after fees and the drawdown is its distance from its peak.
+// The open position is rebuilt from the fills recorded by the Journal of fees, so scale-ins only count from the
+// candle they were filled on. Every trade is taken as entered at once if no fills were recorded.
+func EquityCurve(series *techan.TimeSeries, record *techan.TradingRecord, fees FeeModel) []EquityPoint {
+	trades := record.Trades
+	if current := record.CurrentPosition(); current.IsOpen() {
+		trades = append(trades[:len(trades):len(trades)], current)
+	}
+	fills := equityFills(trades, fees.Journal)
+
+	points := make([]EquityPoint, 0, len(series.Candles))
+	realized := big.ZERO
+	next, fill := 0, 0
+	open := openPosition{amount: big.ZERO}
+	var peak float64
+	for _, candle := range series.Candles {
+		end := candle.Period.End
+		for next < len(trades) && trades[next].IsClosed() && !trades[next].ExitOrder().ExecutionTime.After(end) {
+			realized = realized.Add(fees.NetProfit(trades[next]))
+			next++
+		}
+		for fill < len(fills) && !fills[fill].order.ExecutionTime.After(end) {
+			open.apply(fills[fill])
+			fill++
+		}
+
+		point := EquityPoint{Time: end, Realized: realized.Float()}
+		if !open.amount.Zero() {
+			trade := techan.NewPosition(techan.Order{
+				Side:          open.side,
+				Security:      open.root.EntranceOrder().Security,
+				Price:         open.price,
+				Amount:        open.amount,
+				ExecutionTime: open.since,
+			}, big.ZERO, big.ZERO)
+			entry, exit := fees.liquidity(open.root)
+			point.Open = fees.openProfit(trade, candle, entry, exit).Float()
+			point.Position = sideName(open.side)
+			point.Amount = open.amount.Float()
+			point.EntryPrice = open.price.Float()
+		}
+		point.Equity = point.Realized + point.Open
+		peak = math.Max(peak, point.Equity)
+		point.Drawdown = peak - point.Equity
+		points = append(points, point)
+	}
+	return points
+}
+
+// equityFill is an order which entered or exited the position root.
+type equityFill struct {
+	order techan.Order
+	root  *techan.Position
+}
+
+// equityFills returns the entries and exits of trades in the order they were filled. The entries of a position
+// are the fills recorded by journal, or the entrance orders of its trades if there are none.
+func equityFills(trades []*techan.Position, journal *Journal) []equityFill {
+	fills := make([]equityFill, 0, 2*len(trades))
+	seen := make(map[*techan.Position]bool)
+	for _, trade := range trades {
+		root, entries := journal.entered(trade)
+		switch {
+		case len(entries) == 0:
+			fills = append(fills, equityFill{*trade.EntranceOrder(), root})
+		case !seen[root]:
+			seen[root] = true
+			for _, order := range entries {
+				fills = append(fills, equityFill{order, root})
+			}
+		}
+		if trade.IsClosed() {
+			fills = append(fills, equityFill{*trade.ExitOrder(), root})
+		}
+	}
+	// an exit and the next entry filled at the same time stay in order.
+	sort.SliceStable(fills, func(i, j int) bool {
+		return fills[i].order.ExecutionTime.Before(fills[j].order.ExecutionTime)
+	})
+	return fills
+}
+
+// openPosition is the open position of an equity curve.
+type openPosition struct {
+	side   techan.OrderSide
+	amount big.Decimal
+	price  big.Decimal
+	since  time.Time
+	root   *techan.Position
+}
+
+// apply adds the order of fill to the position if it opens or adds to it and closes its amount otherwise. The
+// position is entered at the average price of its entries.
+func (p *openPosition) apply(fill equityFill) {
+	order := fill.order
+	switch {
+	case p.amount.Zero():
+		*p = openPosition{side: order.Side, amount: order.Amount, price: order.Price, since: order.ExecutionTime, root: fill.root}
+	case order.Side == p.side:
+		amount := p.amount.Add(order.Amount)
+		p.price = p.price.Mul(p.amount).Add(order.Price.Mul(order.Amount)).Div(amount)
+		p.amount = amount
+	default:
+		p.amount = p.amount.Sub(order.Amount)
+		if p.amount.LTE(big.ZERO) {
+			*p = openPosition{amount: big.ZERO}
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/MShoaei/techan"
+	"github.com/sdcoffey/big"
+)
+
+func TestEquityCurve(t *testing.T) {
+	series := techan.NewTimeSeries()
+	for i, price := range []float64{100, 110, 90, 95} {
+		candle := techan.NewCandle(techan.NewTimePeriod(time.Unix(int64(i*60), 0), time.Minute))
+		candle.ClosePrice = big.NewDecimal(price)
+		series.AddCandle(candle)
+	}
+	record := techan.NewTradingRecord()
+	record.Operate(techan.Order{Side: techan.BUY, Price: big.NewDecimal(100), Amount: big.NewDecimal(1), ExecutionTime: series.Candles[0].Period.End})
+	record.Operate(techan.Order{Side: techan.SELL, Price: big.NewDecimal(110), Amount: big.NewDecimal(1), ExecutionTime: series.Candles[1].Period.End})
+	record.Operate(techan.Order{Side: techan.SELL, Price: big.NewDecimal(90), Amount: big.NewDecimal(1), ExecutionTime: series.Candles[2].Period.End})
+
+	expect := []EquityPoint{
+		{Equity: 0, Position: "long"},
+		{Equity: 10, Drawdown: 0},
+		{Equity: 10, Position: "short"},
+		{Equity: 5, Drawdown: 5, Position: "short"},
+	}
+	points := EquityCurve(series, record, FeeModel{})
+	if len(points) != len(expect) {
+		t.Fatalf("expected %d points, got %d", len(expect), len(points))
+	}
+	for i, point := range points {
+		if point.Equity != expect[i].Equity || point.Drawdown != expect[i].Drawdown || point.Position != expect[i].Position {
+			t.Errorf("point %d: expected %+v, got %+v", i, expect[i], point)
+		}
+	}
+}
+
+// equityRecord fills orders into a record like an Engine, recording them in the journal of fees.
+func equityRecord(fees FeeModel, orders ...techan.Order) *techan.TradingRecord {
+	record := techan.NewTradingRecord()
+	var st scaleState
+	for _, order := range orders {
+		position, trades := record.CurrentPosition(), len(record.Trades)
+		st.operate(record, order)
+		fees.Journal.operate(position, record.Trades[trades:], order, Taker)
+	}
+	return record
+}
+
+func equitySeries(prices ...float64) *techan.TimeSeries {
+	series := techan.NewTimeSeries()
+	for i, price := range prices {
+		candle := techan.NewCandle(techan.NewTimePeriod(time.Unix(int64(i*60), 0), time.Minute))
+		candle.ClosePrice = big.NewDecimal(price)
+		series.AddCandle(candle)
+	}
+	return series
+}
+
+func TestEquityCurve_ScaleIn(t *testing.T) {
+	series := equitySeries(100, 100, 120)
+	fees := FeeModel{Journal: NewJournal()}
+	record := equityRecord(fees,
+		techan.Order{Side: techan.BUY, Price: big.NewDecimal(100), Amount: big.ONE, ExecutionTime: series.Candles[0].Period.End},
+		techan.Order{Side: techan.BUY, Price: big.NewDecimal(120), Amount: big.ONE, ExecutionTime: series.Candles[2].Period.End},
+	)
+
+	// the second entry only counts from the candle it was filled on.
+	expect := []EquityPoint{
+		{Amount: 1, EntryPrice: 100, Open: 0},
+		{Amount: 1, EntryPrice: 100, Open: 0},
+		{Amount: 2, EntryPrice: 110, Open: 20},
+	}
+	for i, point := range EquityCurve(series, record, fees) {
+		if point.Amount != expect[i].Amount || point.EntryPrice != expect[i].EntryPrice || point.Open != expect[i].Open {
+			t.Errorf("point %d: expected %+v, got %+v", i, expect[i], point)
+		}
+	}
+}
+
+func TestEquityCurve_PartialExit(t *testing.T) {
+	series := equitySeries(100, 110, 120)
+	for _, fees := range []FeeModel{{Journal: NewJournal()}, {}} {
+		record := equityRecord(fees,
+			techan.Order{Side: techan.BUY, Price: big.NewDecimal(100), Amount: big.NewDecimal(2), ExecutionTime: series.Candles[0].Period.End},
+			techan.Order{Side: techan.SELL, Price: big.NewDecimal(110), Amount: big.ONE, ExecutionTime: series.Candles[1].Period.End},
+			techan.Order{Side: techan.SELL, Price: big.NewDecimal(120), Amount: big.ONE, ExecutionTime: series.Candles[2].Period.End},
+		)
+
+		// the whole position is open until the partial exit.
+		expect := []EquityPoint{
+			{Amount: 2, Realized: 0, Equity: 0},
+			{Amount: 1, Realized: 10, Equity: 20},
+			{Amount: 0, Realized: 30, Equity: 30},
+		}
+		for i, point := range EquityCurve(series, record, fees) {
+			if point.Amount != expect[i].Amount || point.Realized != expect[i].Realized || point.Equity != expect[i].Equity {
+				t.Errorf("journal %t, point %d: expected %+v, got %+v", fees.Journal != nil, i, expect[i], point)
+			}
+		}
+	}
+}
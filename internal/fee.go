@@ -0,0 +1,335 @@
+package internal
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/MShoaei/techan"
+	"github.com/sdcoffey/big"
+)
+
+// Liquidity is the side of the order book an order is filled on.
+type Liquidity int
+
+const (
+	// Taker orders are filled against the order book and pay the taker rate.
+	Taker Liquidity = iota
+	// Maker orders rest on the order book and pay the maker rate.
+	Maker
+)
+
+// VIPTiers are the maker and taker rates in percent of the binance USDⓈ-M futures VIP tiers, indexed by tier.
+var VIPTiers = [][2]float64{
+	{0.02, 0.04},
+	{0.016, 0.04},
+	{0.014, 0.035},
+	{0.012, 0.032},
+	{0.010, 0.030},
+	{0.008, 0.027},
+	{0.006, 0.025},
+	{0.004, 0.022},
+	{0.002, 0.020},
+	{0.000, 0.017},
+}
+
+// FeeModel calculates the trading fees and the funding payments of trades.
+// The opening fee of a long trade is paid in the base asset, so it reduces the amount sold by its exit.
+type FeeModel struct {
+	// Maker and Taker are the rates in percent of the order value.
+	Maker float64
+	Taker float64
+	// BNBDiscount is the discount in percent applied to both rates when fees are paid with BNB.
+	BNBDiscount float64
+	// Liquidity is the liquidity of the orders which are not recorded in Journal.
+	Liquidity Liquidity
+	// Journal records the liquidity of every order filled by the engines paying these fees. every order is
+	// filled with Liquidity if it is nil.
+	Journal *Journal
+	// Funding are the funding rates charged on open positions. no funding is paid if it is empty.
+	Funding FundingRates
+}
+
+// FlatFee returns a FeeModel charging commission percent on every order.
+func FlatFee(commission float64) FeeModel {
+	return FeeModel{Maker: commission, Taker: commission}
+}
+
+// VIPFee returns the FeeModel of the VIP tier.
+func VIPFee(tier int) (FeeModel, error) {
+	if tier < 0 || tier >= len(VIPTiers) {
+		return FeeModel{}, fmt.Errorf("invalid VIP tier: %d", tier)
+	}
+	return FeeModel{Maker: VIPTiers[tier][0], Taker: VIPTiers[tier][1]}, nil
+}
+
+// Rate returns the rate in percent paid on orders filled with Liquidity after the BNB discount.
+func (f FeeModel) Rate() float64 {
+	return f.rate(f.Liquidity)
+}
+
+// rate returns the rate in percent paid on an order filled with liquidity after the BNB discount.
+func (f FeeModel) rate(liquidity Liquidity) float64 {
+	rate := f.Taker
+	if liquidity == Maker {
+		rate = f.Maker
+	}
+	return rate * (1 - f.BNBDiscount*0.01)
+}
+
+// liquidity returns the liquidity of the entry and the exit of trade.
+func (f FeeModel) liquidity(trade *techan.Position) (entry, exit Liquidity) {
+	entry, exit = f.Liquidity, f.Liquidity
+	f.Journal.lookup(trade, &entry, &exit)
+	return entry, exit
+}
+
+// fresh returns f with an empty journal of its own if it keeps one. It is used by runs whose records are
+// discarded once they are analyzed.
+func (f FeeModel) fresh() FeeModel {
+	if f.Journal != nil {
+		f.Journal = NewJournal()
+	}
+	return f
+}
+
+// Fees returns the fees paid on the orders of a closed trade.
+func (f FeeModel) Fees(trade *techan.Position) big.Decimal {
+	return f.fees(trade, trade.ExitOrder().Price)
+}
+
+// fees returns the fees of trade if it is closed at price.
+func (f FeeModel) fees(trade *techan.Position, price big.Decimal) big.Decimal {
+	entry, exit := f.liquidity(trade)
+	return f.filledFees(trade, price, entry, exit)
+}
+
+// filledFees returns the fees of trade entered with entry liquidity if it is closed at price with exit liquidity.
+func (f FeeModel) filledFees(trade *techan.Position, price big.Decimal, entry, exit Liquidity) big.Decimal {
+	entryRate, exitRate := big.NewDecimal(f.rate(entry)*0.01), big.NewDecimal(f.rate(exit)*0.01)
+	amount := trade.EntranceOrder().Amount
+
+	if trade.IsShort() {
+		return trade.CostBasis().Mul(entryRate).Add(amount.Mul(price).Mul(exitRate))
+	}
+	openFee := amount.Mul(entryRate)
+	return openFee.Mul(price).Add(amount.Sub(openFee).Mul(price).Mul(exitRate))
+}
+
+// Journal records the liquidity of the entries and exits of trades, the fills entering positions, the positions
+// the partial exits were taken from and the trades closed by a liquidation. It is safe for concurrent use, so the
+// engines of concurrent backtests may share it.
+type Journal struct {
+	mu         sync.Mutex
+	entries    map[*techan.Position]Liquidity
+	exits      map[*techan.Position]Liquidity
+	fills      map[*techan.Position][]techan.Order
+	parents    map[*techan.Position]*techan.Position
+	liquidated map[*techan.Position]bool
+}
+
+// NewJournal returns an empty journal.
+func NewJournal() *Journal {
+	return &Journal{
+		entries:    make(map[*techan.Position]Liquidity),
+		exits:      make(map[*techan.Position]Liquidity),
+		fills:      make(map[*techan.Position][]techan.Order),
+		parents:    make(map[*techan.Position]*techan.Position),
+		liquidated: make(map[*techan.Position]bool),
+	}
+}
+
+// liquidate records that trade was closed by a liquidation.
+func (j *Journal) liquidate(trade *techan.Position) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.liquidated[trade] = true
+}
+
+// Liquidated reports if trade was closed by a liquidation.
+func (j *Journal) Liquidated(trade *techan.Position) bool {
+	if j == nil {
+		return false
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	return j.liquidated[trade]
+}
+
+// operate records order filled with liquidity, which opened or added to position if it is open and closed the
+// trades in closed otherwise. The parts of position closed by a partial exit are entered like position.
+func (j *Journal) operate(position *techan.Position, closed []*techan.Position, order techan.Order, liquidity Liquidity) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if len(closed) == 0 {
+		if !position.IsOpen() {
+			return
+		}
+		// an order adding to an open position is filled like its first entry.
+		if _, ok := j.entries[position]; !ok {
+			j.entries[position] = liquidity
+		}
+		j.fills[position] = append(j.fills[position], order)
+		return
+	}
+	for _, trade := range closed {
+		if trade != position {
+			j.parents[trade] = position
+			if entry, ok := j.entries[position]; ok {
+				j.entries[trade] = entry
+			}
+		}
+		j.exits[trade] = liquidity
+	}
+}
+
+// entered returns the position trade was taken from by a partial exit, or trade itself, and the fills which
+// entered that position. The fills are nil if they were not recorded.
+func (j *Journal) entered(trade *techan.Position) (*techan.Position, []techan.Order) {
+	if j == nil {
+		return trade, nil
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if parent, ok := j.parents[trade]; ok {
+		trade = parent
+	}
+	return trade, j.fills[trade]
+}
+
+// lookup sets entry and exit to the liquidity recorded for the entry and the exit of trade, if any.
+func (j *Journal) lookup(trade *techan.Position, entry, exit *Liquidity) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if l, ok := j.entries[trade]; ok {
+		*entry = l
+	}
+	if l, ok := j.exits[trade]; ok {
+		*exit = l
+	}
+}
+
+// FundingCost returns the funding paid by trade until it is closed. a negative cost is a funding received.
+func (f FeeModel) FundingCost(trade *techan.Position) big.Decimal {
+	return f.funding(trade, trade.ExitOrder().ExecutionTime)
+}
+
+// funding returns the funding paid by trade for the funding times before until.
+func (f FeeModel) funding(trade *techan.Position, until time.Time) big.Decimal {
+	entrance := trade.EntranceOrder()
+	cost := big.ZERO
+	for _, rate := range f.Funding.between(entrance.ExecutionTime, until) {
+		if rate.Symbol != "" && rate.Symbol != entrance.Security {
+			continue
+		}
+		price := entrance.Price
+		if rate.MarkPrice > 0 {
+			price = big.NewDecimal(rate.MarkPrice)
+		}
+		cost = cost.Add(entrance.Amount.Mul(price).Mul(big.NewDecimal(rate.Rate)))
+	}
+	if trade.IsShort() {
+		return cost.Neg()
+	}
+	return cost
+}
+
+// NetProfit returns the profit of a closed trade after paying its fees and funding.
+func (f FeeModel) NetProfit(trade *techan.Position) big.Decimal {
+	return grossProfit(trade).Sub(f.Fees(trade)).Sub(f.FundingCost(trade))
+}
+
+// OpenProfit returns the profit of an open trade after paying its fees and funding if it is closed on candle.
+func (f FeeModel) OpenProfit(trade *techan.Position, candle *techan.Candle) big.Decimal {
+	entry, exit := f.liquidity(trade)
+	return f.openProfit(trade, candle, entry, exit)
+}
+
+// openProfit returns the profit of an open trade entered with entry liquidity after paying its fees and funding if
+// it is closed on candle with exit liquidity.
+func (f FeeModel) openProfit(trade *techan.Position, candle *techan.Candle, entry, exit Liquidity) big.Decimal {
+	value := trade.EntranceOrder().Amount.Mul(candle.ClosePrice)
+	profit := value.Sub(trade.CostBasis())
+	if trade.IsShort() {
+		profit = profit.Neg()
+	}
+	return profit.Sub(f.filledFees(trade, candle.ClosePrice, entry, exit)).Sub(f.funding(trade, candle.Period.End))
+}
+
+// grossProfit returns the profit of a closed trade before fees.
+func grossProfit(trade *techan.Position) big.Decimal {
+	if trade.IsShort() {
+		return trade.CostBasis().Sub(trade.ExitValue())
+	}
+	return trade.ExitValue().Sub(trade.CostBasis())
+}
+
+// FundingRate is a single funding payment of a perpetual futures contract.
+type FundingRate struct {
+	Symbol string
+	Time   time.Time
+	// Rate is the funding rate as a fraction, e.g. 0.0001 for 0.01%.
+	Rate float64
+	// MarkPrice is the price the position is valued at. the entry price is used if it is 0.
+	MarkPrice float64
+}
+
+// FundingRates are funding rates sorted by time.
+type FundingRates []FundingRate
+
+// between returns the funding rates whose time is in [start, end).
+func (rates FundingRates) between(start, end time.Time) FundingRates {
+	i := sort.Search(len(rates), func(i int) bool { return !rates[i].Time.Before(start) })
+	j := sort.Search(len(rates), func(i int) bool { return !rates[i].Time.Before(end) })
+	if i >= j {
+		return nil
+	}
+	return rates[i:j]
+}
+
+// ReadFundingRates reads a json array of funding rates in the format of the binance funding rate history endpoint.
+func ReadFundingRates(input io.Reader) (FundingRates, error) {
+	b, err := ioutil.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	data := make([]struct {
+		Symbol      string `json:"symbol"`
+		FundingTime int64  `json:"fundingTime"`
+		FundingRate string `json:"fundingRate"`
+		MarkPrice   string `json:"markPrice"`
+	}, 0)
+	if err := json.Unmarshal(b, &data); err != nil {
+		return nil, err
+	}
+
+	rates := make(FundingRates, 0, len(data))
+	for _, d := range data {
+		rate := FundingRate{Symbol: d.Symbol, Time: time.Unix(0, d.FundingTime*int64(time.Millisecond))}
+		if rate.Rate, err = strconv.ParseFloat(d.FundingRate, 64); err != nil {
+			return nil, fmt.Errorf("invalid funding rate %q: %v", d.FundingRate, err)
+		}
+		if d.MarkPrice != "" {
+			if rate.MarkPrice, err = strconv.ParseFloat(d.MarkPrice, 64); err != nil {
+				return nil, fmt.Errorf("invalid mark price %q: %v", d.MarkPrice, err)
+			}
+		}
+		rates = append(rates, rate)
+	}
+	sort.SliceStable(rates, func(i, j int) bool { return rates[i].Time.Before(rates[j].Time) })
+	return rates, nil
+}
@@ -0,0 +1,36 @@
+package internal
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/MShoaei/techan"
+	"github.com/sdcoffey/big"
+)
+
+func TestFeeModel_NetProfit(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	record := techan.NewTradingRecord()
+	record.Operate(techan.Order{Side: techan.SELL, Security: "ETHUSDT", Price: big.NewDecimal(100), Amount: big.NewDecimal(1), ExecutionTime: start})
+	record.Operate(techan.Order{Side: techan.BUY, Security: "ETHUSDT", Price: big.NewDecimal(90), Amount: big.NewDecimal(1), ExecutionTime: start.Add(16 * time.Hour)})
+	trade := record.LastTrade()
+
+	fees := FeeModel{Maker: 0.02, Taker: 1, BNBDiscount: 10}
+	if got := fees.Fees(trade).Float(); math.Abs(got-(1.71)) > 1e-9 {
+		t.Errorf("expected fees of 1.71, got %f", got)
+	}
+
+	fees.Funding = FundingRates{
+		{Time: start, Rate: 0.01},
+		{Symbol: "BTCUSDT", Time: start.Add(8 * time.Hour), Rate: 0.01},
+		{Time: start.Add(8 * time.Hour), Rate: 0.01, MarkPrice: 95},
+		{Time: start.Add(16 * time.Hour), Rate: 0.01},
+	}
+	if got := fees.FundingCost(trade).Float(); math.Abs(got-(-1.95)) > 1e-9 {
+		t.Errorf("expected a funding of -1.95, got %f", got)
+	}
+	if got := fees.NetProfit(trade).Float(); math.Abs(got-(10.24)) > 1e-9 {
+		t.Errorf("expected a net profit of 10.24, got %f", got)
+	}
+}
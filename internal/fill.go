@@ -0,0 +1,181 @@
+package internal
+
+import (
+	"time"
+
+	"github.com/MShoaei/techan"
+	"github.com/sdcoffey/big"
+)
+
+// PendingOrder is an order placed by a backtest which is not filled yet.
+type PendingOrder struct {
+	Side     techan.OrderSide
+	Security string
+	Amount   big.Decimal
+	// Price is the close price of the candle the order was placed on.
+	Price big.Decimal
+	// Index is the index of the candle the order was placed on.
+	Index int
+	// Exit is true if the order closes the current position.
+	Exit bool
+}
+
+// FillStatus is the state of a PendingOrder after a FillModel has seen a candle.
+type FillStatus int
+
+const (
+	// Pending orders are checked again on the next candle.
+	Pending FillStatus = iota
+	// Filled orders are executed.
+	Filled
+	// Cancelled orders are dropped without being executed.
+	Cancelled
+)
+
+// FillModel decides if, when and at which price and amount the orders of a backtest are filled.
+type FillModel interface {
+	// Fill is called with a pending order for the candle it was placed on and every candle after it until the
+	// order is either filled or cancelled. index is the index of candle in the series.
+	Fill(order PendingOrder, candle *techan.Candle, index int) (techan.Order, FillStatus)
+	// Liquidity returns the liquidity the orders are filled with.
+	Liquidity() Liquidity
+}
+
+// CloseFill fills orders at the close price of the candle they were placed on.
+type CloseFill struct{}
+
+// Fill fills order at the close of the signal candle.
+func (CloseFill) Fill(order PendingOrder, candle *techan.Candle, index int) (techan.Order, FillStatus) {
+	return filledOrder(order, candle.ClosePrice, order.Amount, candle.Period.End), Filled
+}
+
+// Liquidity returns Taker since the orders are market orders.
+func (CloseFill) Liquidity() Liquidity {
+	return Taker
+}
+
+// NextOpenFill fills orders at the open price of the candle after the one they were placed on.
+type NextOpenFill struct{}
+
+// Fill fills order at the open of the candle following the signal candle.
+func (NextOpenFill) Fill(order PendingOrder, candle *techan.Candle, index int) (techan.Order, FillStatus) {
+	if index <= order.Index {
+		return techan.Order{}, Pending
+	}
+	return filledOrder(order, candle.OpenPrice, order.Amount, candle.Period.Start), Filled
+}
+
+// Liquidity returns Taker since the orders are market orders.
+func (NextOpenFill) Liquidity() Liquidity {
+	return Taker
+}
+
+// LimitFill places limit orders at the close price of the signal candle moved by Offset percent in favor of the
+// order. The order is only filled if a later candle trades through the limit price and it is cancelled if that
+// does not happen within Expiry candles. An Expiry of 0 never cancels the order.
+type LimitFill struct {
+	Offset float64
+	Expiry int
+}
+
+// Fill fills order at its limit price once a candle trades through it.
+func (l LimitFill) Fill(order PendingOrder, candle *techan.Candle, index int) (techan.Order, FillStatus) {
+	if index <= order.Index {
+		return techan.Order{}, Pending
+	}
+	if l.Expiry > 0 && index-order.Index > l.Expiry {
+		return techan.Order{}, Cancelled
+	}
+
+	offset := order.Price.Mul(big.NewDecimal(l.Offset * 0.01))
+	if order.Side == techan.BUY {
+		limit := order.Price.Sub(offset)
+		if candle.OpenPrice.LT(limit) {
+			return filledOrder(order, candle.OpenPrice, order.Amount, candle.Period.Start), Filled
+		}
+		if candle.MinPrice.LT(limit) {
+			return filledOrder(order, limit, order.Amount, candle.Period.Start), Filled
+		}
+	} else {
+		limit := order.Price.Add(offset)
+		if candle.OpenPrice.GT(limit) {
+			return filledOrder(order, candle.OpenPrice, order.Amount, candle.Period.Start), Filled
+		}
+		if candle.MaxPrice.GT(limit) {
+			return filledOrder(order, limit, order.Amount, candle.Period.Start), Filled
+		}
+	}
+	return techan.Order{}, Pending
+}
+
+// Liquidity returns Maker since the orders rest on the order book until they are filled.
+func (LimitFill) Liquidity() Liquidity {
+	return Maker
+}
+
+// Slippage moves the price of the orders filled by Model against the order by Fixed price units and Percent percent.
+type Slippage struct {
+	Model   FillModel
+	Fixed   float64
+	Percent float64
+}
+
+// Fill fills order using the wrapped model and applies the slippage to the filled price.
+func (s Slippage) Fill(order PendingOrder, candle *techan.Candle, index int) (techan.Order, FillStatus) {
+	filled, status := s.Model.Fill(order, candle, index)
+	if status != Filled {
+		return filled, status
+	}
+	slippage := filled.Price.Mul(big.NewDecimal(s.Percent * 0.01)).Add(big.NewDecimal(s.Fixed))
+	if filled.Side == techan.BUY {
+		filled.Price = filled.Price.Add(slippage)
+	} else {
+		filled.Price = filled.Price.Sub(slippage)
+	}
+	return filled, status
+}
+
+// Liquidity returns the liquidity of the wrapped model.
+func (s Slippage) Liquidity() Liquidity {
+	return s.Model.Liquidity()
+}
+
+// VolumeCap limits the amount of the entry orders filled by Model to Participation percent of the volume of the
+// candle they are filled on. Exit orders are never capped since a position can only be closed as a whole.
+type VolumeCap struct {
+	Model         FillModel
+	Participation float64
+	// LotSize rounds the capped amounts.
+	LotSize LotSize
+}
+
+// Fill fills order using the wrapped model and caps the amount of entries. An entry capped to nothing is cancelled.
+func (v VolumeCap) Fill(order PendingOrder, candle *techan.Candle, index int) (techan.Order, FillStatus) {
+	filled, status := v.Model.Fill(order, candle, index)
+	if status != Filled || order.Exit {
+		return filled, status
+	}
+	limit := candle.Volume.Mul(big.NewDecimal(v.Participation * 0.01))
+	if filled.Amount.GT(limit) {
+		filled.Amount = v.LotSize.Round(limit)
+	}
+	if filled.Amount.Zero() {
+		return techan.Order{}, Cancelled
+	}
+	return filled, status
+}
+
+// Liquidity returns the liquidity of the wrapped model.
+func (v VolumeCap) Liquidity() Liquidity {
+	return v.Model.Liquidity()
+}
+
+func filledOrder(order PendingOrder, price, amount big.Decimal, t time.Time) techan.Order {
+	return techan.Order{
+		Side:          order.Side,
+		Security:      order.Security,
+		Price:         price,
+		Amount:        amount,
+		ExecutionTime: t,
+	}
+}
@@ -0,0 +1,105 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/MShoaei/techan"
+	"github.com/sdcoffey/big"
+)
+
+func TestLimitFill_Fill(t *testing.T) {
+	order := PendingOrder{Side: techan.BUY, Amount: big.NewDecimal(1), Price: big.NewDecimal(100), Index: 5}
+	model := LimitFill{Offset: 1, Expiry: 2}
+
+	if _, status := model.Fill(order, newTestCandle(100, 101, 98, 100), 5); status != Pending {
+		t.Errorf("expected the signal candle to never fill, got %v", status)
+	}
+	if _, status := model.Fill(order, newTestCandle(100, 101, 99, 100), 6); status != Pending {
+		t.Errorf("expected a candle touching the limit to not fill, got %v", status)
+	}
+	filled, status := model.Fill(order, newTestCandle(100, 101, 98, 100), 7)
+	if status != Filled || filled.Price.Float() != 99 {
+		t.Errorf("expected a fill at 99, got %v at %s", status, filled.Price)
+	}
+	if _, status := model.Fill(order, newTestCandle(100, 101, 98, 100), 8); status != Cancelled {
+		t.Errorf("expected the order to expire, got %v", status)
+	}
+}
+
+func TestSlippage_Fill(t *testing.T) {
+	model := Slippage{Model: NextOpenFill{}, Percent: 1, Fixed: 0.5}
+	order := PendingOrder{Side: techan.SELL, Amount: big.NewDecimal(1), Price: big.NewDecimal(100), Index: 0}
+	filled, status := model.Fill(order, newTestCandle(200, 201, 199, 200), 1)
+	if status != Filled || filled.Price.Float() != 197.5 {
+		t.Errorf("expected a fill at 197.5, got %v at %s", status, filled.Price)
+	}
+}
+
+func TestNextOpenFill_Fill(t *testing.T) {
+	order := PendingOrder{Side: techan.BUY, Amount: big.NewDecimal(2), Price: big.NewDecimal(100), Index: 3}
+	signal := newTestCandle(95, 101, 94, 100)
+	if _, status := (NextOpenFill{}).Fill(order, signal, 3); status != Pending {
+		t.Errorf("expected the signal candle to never fill, got %v", status)
+	}
+	next := newTestCandle(102, 104, 101, 103)
+	filled, status := NextOpenFill{}.Fill(order, next, 4)
+	if status != Filled || filled.Price.Float() != 102 || filled.Amount.Float() != 2 {
+		t.Errorf("expected a fill of 2 at 102, got %v of %s at %s", status, filled.Amount, filled.Price)
+	}
+	if !filled.ExecutionTime.Equal(next.Period.Start) {
+		t.Errorf("expected the fill at the start of the candle, got %s", filled.ExecutionTime)
+	}
+}
+
+func TestVolumeCap_Fill(t *testing.T) {
+	model := VolumeCap{Model: CloseFill{}, Participation: 10}
+	candle := newTestCandle(100, 101, 99, 100)
+	candle.Volume = big.NewDecimal(25)
+
+	tests := []struct {
+		name   string
+		order  PendingOrder
+		status FillStatus
+		expect float64
+	}{
+		{"under the cap", PendingOrder{Side: techan.BUY, Amount: big.NewDecimal(2)}, Filled, 2},
+		{"capped entry", PendingOrder{Side: techan.BUY, Amount: big.NewDecimal(5)}, Filled, 2.5},
+		{"uncapped exit", PendingOrder{Side: techan.SELL, Amount: big.NewDecimal(5), Exit: true}, Filled, 5},
+	}
+	for _, tt := range tests {
+		filled, status := model.Fill(tt.order, candle, 0)
+		if status != tt.status || filled.Amount.Float() != tt.expect {
+			t.Errorf("%s: expected %v of %f, got %v of %s", tt.name, tt.status, tt.expect, status, filled.Amount)
+		}
+	}
+
+	candle.Volume = big.NewDecimal(0.001)
+	if _, status := model.Fill(PendingOrder{Side: techan.BUY, Amount: big.NewDecimal(1)}, candle, 0); status != Cancelled {
+		t.Errorf("expected an entry capped to nothing to be cancelled, got %v", status)
+	}
+	if _, status := (VolumeCap{Model: NextOpenFill{}, Participation: 10}).Fill(PendingOrder{Amount: big.NewDecimal(1)}, candle, 0); status != Pending {
+		t.Errorf("expected the status of the wrapped model, got %v", status)
+	}
+}
+
+func TestVolumeCap_FillLotSize(t *testing.T) {
+	model := VolumeCap{Model: CloseFill{}, Participation: 10, LotSize: LotSize{Step: 0.1, Min: 0.2}}
+	candle := newTestCandle(100, 101, 99, 100)
+
+	tests := []struct {
+		volume float64
+		status FillStatus
+		expect float64
+	}{
+		{25.67, Filled, 2.5},
+		{9.99, Filled, 0.9},
+		{1.5, Cancelled, 0},
+	}
+	for _, tt := range tests {
+		candle.Volume = big.NewDecimal(tt.volume)
+		filled, status := model.Fill(PendingOrder{Side: techan.BUY, Amount: big.NewDecimal(5)}, candle, 0)
+		if status != tt.status || (status == Filled && filled.Amount.Float() != tt.expect) {
+			t.Errorf("volume %f: expected %v of %f, got %v of %s", tt.volume, tt.status, tt.expect, status, filled.Amount)
+		}
+	}
+}
@@ -0,0 +1,485 @@
+package internal
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/MShoaei/techan"
+	"github.com/adshao/go-binance/v2"
+	"github.com/sdcoffey/big"
+	log "github.com/sirupsen/logrus"
+)
+
+// GridSpacing is how the levels of a GridStrategy are spaced.
+type GridSpacing int
+
+const (
+	// ArithmeticGrid spaces the levels by the same price difference.
+	ArithmeticGrid GridSpacing = iota
+	// GeometricGrid spaces the levels by the same price ratio.
+	GeometricGrid
+)
+
+// ParseGridSpacing parses arithmetic or geometric.
+func ParseGridSpacing(s string) (GridSpacing, error) {
+	switch s {
+	case "arithmetic":
+		return ArithmeticGrid, nil
+	case "geometric":
+		return GeometricGrid, nil
+	}
+	return 0, fmt.Errorf("invalid grid spacing %q. one of arithmetic or geometric", s)
+}
+
+// GridStrategy is a grid trading strategy. It rests a buy order at every level under the price and sells what every
+// buy filled at the next level up, then buys at the level again.
+type GridStrategy struct {
+	Lower, Upper float64
+	// Levels is the number of price levels from Lower to Upper, both included.
+	Levels  int
+	Spacing GridSpacing
+	// Amount is the quantity of every order. if it is zero, every order is worth Quote at its price instead.
+	Amount float64
+	Quote  float64
+}
+
+// Prices returns the levels of the grid from the lowest, rounded to tick.
+func (g GridStrategy) Prices(tick TickSize) ([]float64, error) {
+	switch {
+	case g.Lower <= 0 || g.Upper <= g.Lower:
+		return nil, fmt.Errorf("invalid grid range %v to %v", g.Lower, g.Upper)
+	case g.Levels < 2:
+		return nil, fmt.Errorf("a grid needs at least 2 levels, got %d", g.Levels)
+	case (g.Amount > 0) == (g.Quote > 0):
+		return nil, fmt.Errorf("exactly one of the amount and the quote size of the grid must be set")
+	}
+	prices := make([]float64, g.Levels)
+	for i := range prices {
+		x := float64(i) / float64(g.Levels-1)
+		if g.Spacing == GeometricGrid {
+			prices[i] = g.Lower * math.Pow(g.Upper/g.Lower, x)
+		} else {
+			prices[i] = g.Lower + (g.Upper-g.Lower)*x
+		}
+		prices[i] = tick.Round(prices[i])
+		if i > 0 && prices[i] <= prices[i-1] {
+			return nil, fmt.Errorf("the levels of the grid are closer than the tick size %v", tick.Step)
+		}
+	}
+	return prices, nil
+}
+
+// TickSize are the price limits of a symbol. The zero value does not round.
+type TickSize struct {
+	Step float64
+	Min  float64
+	Max  float64
+}
+
+// NewTickSize returns the TickSize of a binance price filter.
+func NewTickSize(filter *binance.PriceFilter) (TickSize, error) {
+	var ts TickSize
+	if filter == nil {
+		return ts, nil
+	}
+	for _, v := range []struct {
+		value  string
+		target *float64
+	}{{filter.TickSize, &ts.Step}, {filter.MinPrice, &ts.Min}, {filter.MaxPrice, &ts.Max}} {
+		if _, err := fmt.Sscan(v.value, v.target); err != nil {
+			return ts, fmt.Errorf("invalid price filter %+v: %v", *filter, err)
+		}
+	}
+	return ts, nil
+}
+
+// Round rounds price to the nearest multiple of the tick size within the price limits.
+func (ts TickSize) Round(price float64) float64 {
+	if ts.Max > 0 {
+		price = math.Min(price, ts.Max)
+	}
+	price = math.Max(price, ts.Min)
+	if ts.Step <= 0 {
+		return price
+	}
+	rounded, _ := strconv.ParseFloat(strconv.FormatFloat(math.Round(price/ts.Step)*ts.Step, 'f', decimals(ts.Step), 64), 64)
+	return rounded
+}
+
+// ErrOrderClosed is wrapped by the errors of GridExchange.Filled for orders which were closed without being filled,
+// e.g. cancelled, rejected or expired ones.
+var ErrOrderClosed = errors.New("order closed without being filled")
+
+// GridExchange places and tracks the resting orders of a GridEngine.
+type GridExchange interface {
+	// Place rests a limit order and returns its id.
+	Place(order techan.Order) (string, error)
+	// Filled returns the order id as it was filled, or false if it is still resting. candle is the candle which
+	// just closed. The error wraps ErrOrderClosed if the order will never be filled.
+	Filled(id string, candle *techan.Candle) (techan.Order, bool, error)
+	// Cancel cancels the order id.
+	Cancel(id string) error
+}
+
+// SimulatedGridExchange fills resting orders against the highs and lows of the candles. Orders whose price was
+// crossed by the open are filled at the open.
+type SimulatedGridExchange struct {
+	orders map[string]techan.Order
+	next   int
+}
+
+// Place rests order.
+func (s *SimulatedGridExchange) Place(order techan.Order) (string, error) {
+	if s.orders == nil {
+		s.orders = make(map[string]techan.Order)
+	}
+	s.next++
+	id := strconv.Itoa(s.next)
+	s.orders[id] = order
+	return id, nil
+}
+
+// Filled fills the order id if candle reached its price.
+func (s *SimulatedGridExchange) Filled(id string, candle *techan.Candle) (techan.Order, bool, error) {
+	order, ok := s.orders[id]
+	if !ok {
+		return order, false, fmt.Errorf("unknown order %s: %w", id, ErrOrderClosed)
+	}
+	switch {
+	case order.Side == techan.BUY && candle.MinPrice.LTE(order.Price):
+		if candle.OpenPrice.LT(order.Price) {
+			order.Price = candle.OpenPrice
+		}
+	case order.Side == techan.SELL && candle.MaxPrice.GTE(order.Price):
+		if candle.OpenPrice.GT(order.Price) {
+			order.Price = candle.OpenPrice
+		}
+	default:
+		return order, false, nil
+	}
+	delete(s.orders, id)
+	order.ExecutionTime = candle.Period.End
+	return order, true, nil
+}
+
+// Cancel removes the order id.
+func (s *SimulatedGridExchange) Cancel(id string) error {
+	delete(s.orders, id)
+	return nil
+}
+
+// BinanceGridExchange rests the orders of a GridEngine as limit orders on binance. Demo orders are only tested and
+// filled by a SimulatedGridExchange.
+type BinanceGridExchange struct {
+	Client *binance.Client
+	Symbol string
+	Demo   bool
+
+	demo SimulatedGridExchange
+}
+
+// Place places order as a good till cancelled limit order.
+func (b *BinanceGridExchange) Place(order techan.Order) (string, error) {
+	side := binance.SideTypeBuy
+	if order.Side == techan.SELL {
+		side = binance.SideTypeSell
+	}
+	service := b.Client.NewCreateOrderService().
+		Symbol(b.Symbol).
+		Side(side).
+		Type(binance.OrderTypeLimit).
+		Quantity(formatDecimal(order.Amount)).
+		TimeInForce(binance.TimeInForceTypeGTC).
+		Price(formatDecimal(order.Price))
+	if b.Demo {
+		if err := service.Test(context.Background()); err != nil {
+			return "", err
+		}
+		return b.demo.Place(order)
+	}
+	res, err := service.Do(context.Background())
+	if err != nil {
+		log.Errorf("%s, Qty: %s, Price: %s", b.Symbol, order.Amount, order.Price)
+		return "", err
+	}
+	return strconv.FormatInt(res.OrderID, 10), nil
+}
+
+// formatDecimal formats d without an exponent.
+func formatDecimal(d big.Decimal) string {
+	return strconv.FormatFloat(d.Float(), 'f', -1, 64)
+}
+
+// Filled queries the status of the order id.
+func (b *BinanceGridExchange) Filled(id string, candle *techan.Candle) (techan.Order, bool, error) {
+	if b.Demo {
+		return b.demo.Filled(id, candle)
+	}
+	orderID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return techan.Order{}, false, err
+	}
+	res, err := b.Client.NewGetOrderService().Symbol(b.Symbol).OrderID(orderID).Do(context.Background())
+	if err != nil {
+		return techan.Order{}, false, err
+	}
+	switch res.Status {
+	case binance.OrderStatusTypeFilled:
+	case binance.OrderStatusTypeCanceled, binance.OrderStatusTypeRejected, binance.OrderStatusTypeExpired:
+		return techan.Order{}, false, fmt.Errorf("order %s is %s: %w", id, res.Status, ErrOrderClosed)
+	default:
+		return techan.Order{}, false, nil
+	}
+	order := techan.Order{
+		Side:          techan.BUY,
+		Security:      b.Symbol,
+		Price:         big.NewFromString(res.Price),
+		Amount:        big.NewFromString(res.ExecutedQuantity),
+		ExecutionTime: time.Unix(0, res.UpdateTime*int64(time.Millisecond)),
+	}
+	if res.Side == binance.SideTypeSell {
+		order.Side = techan.SELL
+	}
+	return order, true, nil
+}
+
+// Cancel cancels the order id.
+func (b *BinanceGridExchange) Cancel(id string) error {
+	if b.Demo {
+		return b.demo.Cancel(id)
+	}
+	orderID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return err
+	}
+	_, err = b.Client.NewCancelOrderService().Symbol(b.Symbol).OrderID(orderID).Do(context.Background())
+	return err
+}
+
+// GridTrade is a buy of a grid level sold at the next level up.
+type GridTrade struct {
+	Level      int       `json:"level"`
+	BuyTime    time.Time `json:"buyTime"`
+	BuyPrice   float64   `json:"buyPrice"`
+	SellTime   time.Time `json:"sellTime"`
+	SellPrice  float64   `json:"sellPrice"`
+	Amount     float64   `json:"amount"`
+	Commission float64   `json:"commission"`
+	NetProfit  float64   `json:"netProfit"`
+}
+
+// GridReport sums up the trades of a GridEngine. Open are the buys which are not sold yet and OpenProfit is their
+// profit at the last close.
+type GridReport struct {
+	Trades     []GridTrade `json:"trades"`
+	Profit     float64     `json:"profit"`
+	Commission float64     `json:"commission"`
+	NetProfit  float64     `json:"netProfit"`
+	Open       int         `json:"open"`
+	OpenAmount float64     `json:"openAmount"`
+	OpenProfit float64     `json:"openProfit"`
+}
+
+// gridCell is the part of a grid between two levels. It either waits to buy at its lower level or holds what it
+// bought and waits to sell it at its upper level.
+type gridCell struct {
+	buy, sell big.Decimal
+	amount    big.Decimal
+	holding   bool
+	order     string
+	bought    techan.Order
+}
+
+// GridEngine trades a GridStrategy through Exchange. It is fed the closed candles of its symbol, so backtests trade
+// exactly like the live grid.
+type GridEngine struct {
+	Symbol   string
+	Grid     GridStrategy
+	LotSize  LotSize
+	TickSize TickSize
+	// Fees are charged at their maker rate on every fill.
+	Fees     FeeModel
+	Exchange GridExchange
+
+	cells  []*gridCell
+	trades []GridTrade
+	last   *techan.Candle
+}
+
+// Start rests a buy order at every level under the close of candle.
+func (e *GridEngine) Start(candle *techan.Candle) error {
+	prices, err := e.Grid.Prices(e.TickSize)
+	if err != nil {
+		return err
+	}
+	e.cells = make([]*gridCell, 0, len(prices)-1)
+	for i := 0; i < len(prices)-1; i++ {
+		amount := big.NewDecimal(e.Grid.Amount)
+		if e.Grid.Amount == 0 {
+			amount = big.NewDecimal(e.Grid.Quote / prices[i])
+		}
+		amount = e.LotSize.Round(amount)
+		if amount.EQ(big.ZERO) || e.sellAmount(amount).Zero() {
+			return fmt.Errorf("the size of level %v is under the lot size of %s", prices[i], e.Symbol)
+		}
+		e.cells = append(e.cells, &gridCell{buy: big.NewDecimal(prices[i]), sell: big.NewDecimal(prices[i+1]), amount: amount})
+	}
+	e.last = candle
+	return e.place(candle)
+}
+
+// Update checks which resting orders were filled by candle and rests the orders replacing them. Orders rested on
+// a candle can only be filled by the candles after it. An order closed without being filled is rested again and
+// an order whose status can not be checked is checked again on the next candle.
+func (e *GridEngine) Update(candle *techan.Candle) error {
+	e.last = candle
+	for i, cell := range e.cells {
+		if cell.order == "" {
+			continue
+		}
+		order, filled, err := e.Exchange.Filled(cell.order, candle)
+		if err != nil {
+			log.Errorf("%s grid order %s of level %d: %v", e.Symbol, cell.order, i, err)
+			if errors.Is(err, ErrOrderClosed) {
+				cell.order = ""
+			}
+			continue
+		}
+		if !filled {
+			continue
+		}
+		cell.order = ""
+		if !cell.holding {
+			cell.holding = true
+			cell.bought = order
+			log.Debugf("%s grid bought %s at %s", e.Symbol, order.Amount, order.Price)
+			continue
+		}
+		cell.holding = false
+		e.trades = append(e.trades, e.trade(i, cell.bought, order))
+		log.Debugf("%s grid sold %s at %s", e.Symbol, order.Amount, order.Price)
+	}
+	return e.place(candle)
+}
+
+// Handle updates the engine with the kline of event once it is final. It has the signature of
+// binance.WsKlineHandler.
+func (e *GridEngine) Handle(event *binance.WsKlineEvent) {
+	k := event.Kline
+	if !k.IsFinal {
+		return
+	}
+	candle := &techan.Candle{
+		Period:     techan.TimePeriod{Start: msTime(k.StartTime), End: msTime(k.EndTime)},
+		OpenPrice:  big.NewFromString(k.Open),
+		ClosePrice: big.NewFromString(k.Close),
+		MaxPrice:   big.NewFromString(k.High),
+		MinPrice:   big.NewFromString(k.Low),
+		Volume:     big.NewFromString(k.Volume),
+		TradeCount: uint(k.TradeNum),
+	}
+	if err := e.Update(candle); err != nil {
+		log.Error(err)
+	}
+}
+
+// place rests the orders of the cells without one. buys are only rested under the close of candle.
+func (e *GridEngine) place(candle *techan.Candle) error {
+	for _, cell := range e.cells {
+		if cell.order != "" {
+			continue
+		}
+		order := techan.Order{Side: techan.BUY, Security: e.Symbol, Price: cell.buy, Amount: cell.amount, ExecutionTime: candle.Period.End}
+		switch {
+		case cell.holding:
+			order.Side, order.Price, order.Amount = techan.SELL, cell.sell, e.sellAmount(cell.bought.Amount)
+		case cell.buy.GTE(candle.ClosePrice):
+			continue
+		}
+		id, err := e.Exchange.Place(order)
+		if err != nil {
+			return err
+		}
+		cell.order = id
+	}
+	return nil
+}
+
+// Stop cancels every resting order.
+func (e *GridEngine) Stop() error {
+	for _, cell := range e.cells {
+		if cell.order == "" {
+			continue
+		}
+		if err := e.Exchange.Cancel(cell.order); err != nil {
+			return err
+		}
+		cell.order = ""
+	}
+	return nil
+}
+
+// sellAmount returns the amount left to sell of bought after its commission was paid in the bought asset, rounded
+// to the lot size.
+func (e *GridEngine) sellAmount(bought big.Decimal) big.Decimal {
+	return e.LotSize.Round(bought.Sub(bought.Mul(big.NewDecimal(e.Fees.Rate() * 0.01))))
+}
+
+func (e *GridEngine) trade(level int, buy, sell techan.Order) GridTrade {
+	rate := e.Fees.Rate() * 0.01
+	commission := (buy.Price.Float()*buy.Amount.Float() + sell.Price.Float()*sell.Amount.Float()) * rate
+	profit := (sell.Price.Float() - buy.Price.Float()) * sell.Amount.Float()
+	return GridTrade{
+		Level:      level,
+		BuyTime:    buy.ExecutionTime,
+		BuyPrice:   buy.Price.Float(),
+		SellTime:   sell.ExecutionTime,
+		SellPrice:  sell.Price.Float(),
+		Amount:     sell.Amount.Float(),
+		Commission: commission,
+		NetProfit:  profit - commission,
+	}
+}
+
+// Report returns the trades of the engine and its open buys at the last candle.
+func (e *GridEngine) Report() GridReport {
+	r := GridReport{Trades: e.trades}
+	for _, t := range e.trades {
+		r.Profit += t.NetProfit + t.Commission
+		r.Commission += t.Commission
+		r.NetProfit += t.NetProfit
+	}
+	rate := e.Fees.Rate() * 0.01
+	for _, cell := range e.cells {
+		if !cell.holding {
+			continue
+		}
+		amount, price := cell.bought.Amount.Float(), cell.bought.Price.Float()
+		r.Open++
+		r.OpenAmount += amount
+		r.OpenProfit += (e.last.ClosePrice.Float()-price)*amount - price*amount*rate
+	}
+	return r
+}
+
+// BacktestGrid trades g on candles through a GridEngine filling its orders with a SimulatedGridExchange. The grid
+// starts at the close of the first candle.
+func BacktestGrid(g GridStrategy, candles []*techan.Candle, lotSize LotSize, tickSize TickSize, fees FeeModel) (GridReport, error) {
+	if len(candles) < 2 {
+		return GridReport{}, fmt.Errorf("a grid backtest needs at least 2 candles, got %d", len(candles))
+	}
+	e := GridEngine{Grid: g, LotSize: lotSize, TickSize: tickSize, Fees: fees, Exchange: &SimulatedGridExchange{}}
+	if err := e.Start(candles[0]); err != nil {
+		return GridReport{}, err
+	}
+	for _, candle := range candles[1:] {
+		if err := e.Update(candle); err != nil {
+			return GridReport{}, err
+		}
+	}
+	return e.Report(), nil
+}
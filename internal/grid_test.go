@@ -0,0 +1,136 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/MShoaei/techan"
+)
+
+func TestGridStrategy_Prices(t *testing.T) {
+	tests := []struct {
+		grid     GridStrategy
+		tick     TickSize
+		expected []float64
+	}{
+		{GridStrategy{Lower: 90, Upper: 110, Levels: 3, Amount: 1}, TickSize{}, []float64{90, 100, 110}},
+		{GridStrategy{Lower: 100, Upper: 400, Levels: 3, Spacing: GeometricGrid, Amount: 1}, TickSize{}, []float64{100, 200, 400}},
+		{GridStrategy{Lower: 1, Upper: 2, Levels: 4, Quote: 10}, TickSize{Step: 0.1}, []float64{1, 1.3, 1.7, 2}},
+	}
+	for _, tt := range tests {
+		prices, err := tt.grid.Prices(tt.tick)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(prices) != len(tt.expected) {
+			t.Fatalf("expected prices %v, got %v", tt.expected, prices)
+		}
+		for i := range prices {
+			if math.Abs(prices[i]-tt.expected[i]) > 1e-9 {
+				t.Errorf("expected prices %v, got %v", tt.expected, prices)
+				break
+			}
+		}
+	}
+
+	for _, g := range []GridStrategy{
+		{Lower: 110, Upper: 90, Levels: 3, Amount: 1},
+		{Lower: 90, Upper: 110, Levels: 1, Amount: 1},
+		{Lower: 90, Upper: 110, Levels: 3},
+		{Lower: 90, Upper: 110, Levels: 3, Amount: 1, Quote: 100},
+		{Lower: 90, Upper: 91, Levels: 10, Amount: 1},
+	} {
+		if _, err := g.Prices(TickSize{Step: 0.5}); err == nil {
+			t.Errorf("expected an error for %+v", g)
+		}
+	}
+}
+
+func TestBacktestGrid(t *testing.T) {
+	candles := []*techan.Candle{
+		newTestCandle(104, 106, 103, 105),
+		// the buy at 100 is filled. the sell at 110 rested on this candle is not filled by its high.
+		newTestCandle(105, 111, 99, 101),
+		newTestCandle(101, 112, 100, 111),
+		// both buys are filled at the open of the gap.
+		newTestCandle(85, 86, 80, 82),
+	}
+	g := GridStrategy{Lower: 90, Upper: 110, Levels: 3, Amount: 1}
+	r, err := BacktestGrid(g, candles, LotSize{}, TickSize{}, FeeModel{Maker: 0.1, Liquidity: Maker})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.Trades) != 1 {
+		t.Fatalf("expected 1 trade, got %+v", r.Trades)
+	}
+	trade := r.Trades[0]
+	if trade.Level != 1 || trade.BuyPrice != 100 || trade.SellPrice != 110 {
+		t.Errorf("expected level 1 bought at 100 and sold at 110, got %+v", trade)
+	}
+	// the sell is left with 0.999 after the commission of the buy.
+	if trade.Amount != 0.999 || math.Abs(r.Commission-0.20989) > 1e-9 || math.Abs(r.NetProfit-9.78011) > 1e-9 {
+		t.Errorf("expected 0.999 sold with commission 0.20989 and net profit 9.78011, got %f, %f and %f", trade.Amount, r.Commission, r.NetProfit)
+	}
+	if r.Open != 2 || r.OpenAmount != 2 || math.Abs(r.OpenProfit+6.17) > 1e-9 {
+		t.Errorf("expected 2 open buys at 85 losing 6.17, got %d of %f losing %f", r.Open, r.OpenAmount, -r.OpenProfit)
+	}
+
+	if _, err := BacktestGrid(g, candles, LotSize{Step: 1, Min: 2}, TickSize{}, FeeModel{}); err == nil {
+		t.Error("expected an error for a size under the lot size")
+	}
+}
+
+// flakyGridExchange fails to check the status of the first order it is asked about with err and counts the
+// orders placed.
+type flakyGridExchange struct {
+	SimulatedGridExchange
+	err    error
+	failed bool
+	placed int
+}
+
+func (f *flakyGridExchange) Place(order techan.Order) (string, error) {
+	f.placed++
+	return f.SimulatedGridExchange.Place(order)
+}
+
+func (f *flakyGridExchange) Filled(id string, candle *techan.Candle) (techan.Order, bool, error) {
+	if !f.failed {
+		f.failed = true
+		return techan.Order{}, false, f.err
+	}
+	return f.SimulatedGridExchange.Filled(id, candle)
+}
+
+func TestGridEngine_UpdateError(t *testing.T) {
+	tests := []struct {
+		err    error
+		placed int
+	}{
+		// the buy at 90 is still resting, so it is checked again instead of being placed twice.
+		{errors.New("timeout"), 2},
+		// the buy at 90 was cancelled, so it is rested again.
+		{fmt.Errorf("order 1 is CANCELED: %w", ErrOrderClosed), 3},
+	}
+	for _, tt := range tests {
+		exchange := &flakyGridExchange{err: tt.err}
+		e := GridEngine{Grid: GridStrategy{Lower: 90, Upper: 110, Levels: 3, Amount: 1}, Exchange: exchange}
+		if err := e.Start(newTestCandle(104, 106, 103, 105)); err != nil {
+			t.Fatal(err)
+		}
+		if err := e.Update(newTestCandle(105, 106, 101, 102)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if exchange.placed != tt.placed {
+			t.Errorf("%v: expected %d orders placed, got %d", tt.err, tt.placed, exchange.placed)
+		}
+		if err := e.Update(newTestCandle(102, 103, 89, 95)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if r := e.Report(); r.Open != 2 {
+			t.Errorf("%v: expected both buys to be filled, got %d open buys", tt.err, r.Open)
+		}
+	}
+}
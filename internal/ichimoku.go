@@ -107,3 +107,22 @@ func (m minimumIndicator) Calculate(index int) big.Decimal {
 	}
 	return m.ind2.Calculate(index)
 }
+
+type maximumIndicator struct {
+	ind1 techan.Indicator
+	ind2 techan.Indicator
+}
+
+func NewMaximumIndicator(ind1, ind2 techan.Indicator) techan.Indicator {
+	return maximumIndicator{
+		ind1: ind1,
+		ind2: ind2,
+	}
+}
+
+func (m maximumIndicator) Calculate(index int) big.Decimal {
+	if m.ind1.Calculate(index).GT(m.ind2.Calculate(index)) {
+		return m.ind1.Calculate(index)
+	}
+	return m.ind2.Calculate(index)
+}
@@ -0,0 +1,132 @@
+package internal
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/adshao/go-binance/v2"
+)
+
+// ReadKlines reads klines stored in any of the supported formats, detected from the content of input:
+// a json array of klines as written by the fetch command, or the csv files and zip archives of them published by
+// binance at data.binance.vision.
+func ReadKlines(input io.Reader) ([]*binance.Kline, error) {
+	b, err := ioutil.ReadAll(input)
+	if err != nil {
+		return nil, err
+	}
+	switch trimmed := bytes.TrimSpace(b); {
+	case bytes.HasPrefix(trimmed, []byte("[")):
+		klines := make([]*binance.Kline, 0)
+		if err := json.Unmarshal(trimmed, &klines); err != nil {
+			return nil, err
+		}
+		return klines, nil
+	case bytes.HasPrefix(b, []byte("PK\x03\x04")):
+		return readKlineZip(b)
+	}
+	return readKlineCSV(bytes.NewReader(b))
+}
+
+// readKlineZip reads the csv files of a zip archive in the order of their names.
+func readKlineZip(b []byte) ([]*binance.Kline, error) {
+	archive, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		return nil, err
+	}
+	files := make([]*zip.File, 0, len(archive.File))
+	for _, file := range archive.File {
+		if strings.HasSuffix(strings.ToLower(file.Name), ".csv") {
+			files = append(files, file)
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("zip archive has no csv file")
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name < files[j].Name })
+
+	var klines []*binance.Kline
+	for _, file := range files {
+		r, err := file.Open()
+		if err != nil {
+			return nil, err
+		}
+		k, err := readKlineCSV(r)
+		r.Close()
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", file.Name, err)
+		}
+		klines = append(klines, k...)
+	}
+	sort.SliceStable(klines, func(i, j int) bool { return klines[i].OpenTime < klines[j].OpenTime })
+	return klines, nil
+}
+
+// readKlineCSV reads klines in the column order of the binance archives. A header row is skipped and timestamps
+// in microseconds, used by the newer spot archives, are converted to milliseconds.
+func readKlineCSV(input io.Reader) ([]*binance.Kline, error) {
+	r := csv.NewReader(input)
+	r.FieldsPerRecord = -1
+	r.ReuseRecord = true
+
+	klines := make([]*binance.Kline, 0)
+	for line := 1; ; line++ {
+		record, err := r.Read()
+		if err == io.EOF {
+			return klines, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) < 9 {
+			return nil, fmt.Errorf("line %d: expected at least 9 columns, got %d", line, len(record))
+		}
+		openTime, err := strconv.ParseInt(record[0], 10, 64)
+		if err != nil {
+			if line == 1 {
+				continue
+			}
+			return nil, fmt.Errorf("line %d: invalid open time %q", line, record[0])
+		}
+		closeTime, err := strconv.ParseInt(record[6], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid close time %q", line, record[6])
+		}
+		tradeNum, err := strconv.ParseInt(record[8], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid number of trades %q", line, record[8])
+		}
+		kline := &binance.Kline{
+			OpenTime:         millis(openTime),
+			Open:             record[1],
+			High:             record[2],
+			Low:              record[3],
+			Close:            record[4],
+			Volume:           record[5],
+			CloseTime:        millis(closeTime),
+			QuoteAssetVolume: record[7],
+			TradeNum:         tradeNum,
+		}
+		if len(record) > 10 {
+			kline.TakerBuyBaseAssetVolume = record[9]
+			kline.TakerBuyQuoteAssetVolume = record[10]
+		}
+		klines = append(klines, kline)
+	}
+}
+
+// millis converts a timestamp in microseconds to milliseconds. Timestamps in milliseconds are returned as is.
+func millis(timestamp int64) int64 {
+	if timestamp > 1e14 {
+		return timestamp / 1000
+	}
+	return timestamp
+}
@@ -0,0 +1,55 @@
+package internal
+
+import (
+	"archive/zip"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestReadKlines(t *testing.T) {
+	const header = "open_time,open,high,low,close,volume,close_time,quote_volume,count,taker_buy_volume,taker_buy_quote_volume,ignore\n"
+	const first = "1600000000000,100,101,99,100.5,10,1600001799999,1000,5,4,400,0\n"
+	// newer spot archives use microseconds.
+	const second = "1600001800000000,100.5,102,100,101,12,1600003599999999,1200,6,5,500,0\n"
+
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	for name, content := range map[string]string{"b.csv": second, "a.csv": first, "checksum.txt": "x"} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = w.Write([]byte(content))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, input := range map[string]string{
+		"json": `[{"openTime":1600000000000,"open":"100","close":"100.5","closeTime":1600001799999,"tradeNum":5},` +
+			`{"openTime":1600001800000,"open":"100.5","close":"101","closeTime":1600003599999,"tradeNum":6}]`,
+		"csv": header + first + second,
+		"zip": archive.String(),
+	} {
+		klines, err := ReadKlines(strings.NewReader(input))
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		if len(klines) != 2 {
+			t.Errorf("%s: expected 2 klines, got %d", name, len(klines))
+			continue
+		}
+		if klines[0].OpenTime != 1600000000000 || klines[1].OpenTime != 1600001800000 || klines[1].CloseTime != 1600003599999 {
+			t.Errorf("%s: unexpected times %d, %d, %d", name, klines[0].OpenTime, klines[1].OpenTime, klines[1].CloseTime)
+		}
+		if klines[1].Close != "101" || klines[1].TradeNum != 6 {
+			t.Errorf("%s: unexpected kline %+v", name, *klines[1])
+		}
+	}
+
+	if _, err := ReadKlines(strings.NewReader("1600000000000,100\n")); err == nil {
+		t.Errorf("expected an error for a short row")
+	}
+}
@@ -0,0 +1,76 @@
+package internal
+
+import (
+	"github.com/MShoaei/techan"
+	"github.com/sdcoffey/big"
+)
+
+// Margin describes the isolated margin of leveraged positions. Every position is backed by its value divided by
+// Leverage and is liquidated when its loss leaves less than the maintenance margin.
+type Margin struct {
+	Leverage int
+	// MaintenanceRate is the maintenance margin rate in percent of the value of a position.
+	MaintenanceRate float64
+}
+
+// LiquidationPrice returns the price a position of side entered at entry is liquidated at. It is zero if the
+// position can not be liquidated.
+func (m Margin) LiquidationPrice(side techan.OrderSide, entry big.Decimal) big.Decimal {
+	leverage := float64(m.Leverage)
+	if leverage < 1 {
+		leverage = 1
+	}
+	rate := m.MaintenanceRate * 0.01
+	if side == techan.BUY {
+		if leverage == 1 {
+			return big.ZERO
+		}
+		return entry.Mul(big.NewDecimal((1 - 1/leverage) / (1 - rate)))
+	}
+	return entry.Mul(big.NewDecimal((1 + 1/leverage) / (1 + rate)))
+}
+
+// Reached reports if candle reaches the liquidation price of a position of side.
+func (m Margin) Reached(candle *techan.Candle, side techan.OrderSide, liquidation big.Decimal) bool {
+	if liquidation.Zero() {
+		return false
+	}
+	if side == techan.BUY {
+		return candle.MinPrice.LTE(liquidation)
+	}
+	return candle.MaxPrice.GTE(liquidation)
+}
+
+// LiquidationsAnalysis is the number of trades closed by a liquidation.
+type LiquidationsAnalysis struct {
+	// Journal holds the liquidations recorded by the engine which traded the record.
+	Journal *Journal
+}
+
+// Analyze returns the number of liquidated trades.
+func (la LiquidationsAnalysis) Analyze(record *techan.TradingRecord) float64 {
+	var count float64
+	for _, trade := range record.Trades {
+		if la.Journal.Liquidated(trade) {
+			count++
+		}
+	}
+	return count
+}
+
+// LiquidationLossAnalysis is the net loss of the trades closed by a liquidation.
+type LiquidationLossAnalysis struct {
+	// Fees are the fees of the record. its Journal holds the liquidations of the record.
+	Fees FeeModel
+}
+
+// Analyze returns the net profit of the liquidated trades, which is negative.
+func (la LiquidationLossAnalysis) Analyze(record *techan.TradingRecord) float64 {
+	var loss float64
+	for _, trade := range record.Trades {
+		if la.Fees.Journal.Liquidated(trade) {
+			loss += la.Fees.NetProfit(trade).Float()
+		}
+	}
+	return loss
+}
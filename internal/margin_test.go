@@ -0,0 +1,71 @@
+package internal
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/MShoaei/techan"
+	"github.com/sdcoffey/big"
+)
+
+type constantRule bool
+
+func (c constantRule) IsSatisfied(int, *techan.TradingRecord) bool {
+	return bool(c)
+}
+
+func TestMargin_LiquidationPrice(t *testing.T) {
+	m := Margin{Leverage: 10, MaintenanceRate: 0.5}
+	for _, tt := range []struct {
+		side   techan.OrderSide
+		expect float64
+	}{
+		{techan.BUY, 100 * 0.9 / 0.995},
+		{techan.SELL, 100 * 1.1 / 1.005},
+	} {
+		if actual := m.LiquidationPrice(tt.side, big.NewDecimal(100)).Float(); math.Abs(actual-tt.expect) > 1e-9 {
+			t.Errorf("%s: expected %f, got %f", sideName(tt.side), tt.expect, actual)
+		}
+	}
+	if !(Margin{Leverage: 1}).LiquidationPrice(techan.BUY, big.NewDecimal(100)).Zero() {
+		t.Errorf("expected an unleveraged long to never be liquidated")
+	}
+}
+
+func TestBacktest_Liquidation(t *testing.T) {
+	var candles []*techan.Candle
+	for i, c := range [][4]float64{{100, 100, 100, 100}, {100, 101, 95, 96}, {96, 97, 85, 90}, {90, 92, 88, 91}} {
+		candle := techan.NewCandle(techan.NewTimePeriod(time.Unix(int64(i*60), 0), time.Minute))
+		candle.OpenPrice, candle.MaxPrice, candle.MinPrice, candle.ClosePrice = big.NewDecimal(c[0]), big.NewDecimal(c[1]), big.NewDecimal(c[2]), big.NewDecimal(c[3])
+		candles = append(candles, candle)
+	}
+	bt := &Backtest{Symbol: "ETHUSDT", Risk: 10, Leverage: 10, MaintenanceRate: 0.5, Fees: FeeModel{Journal: NewJournal()}}
+	_, record := bt.Run(func(series *techan.TimeSeries) (long, short techan.RuleStrategy) {
+		long = techan.RuleStrategy{EntryRule: constantRule(true), ExitRule: constantRule(false)}
+		short = techan.RuleStrategy{EntryRule: constantRule(false), ExitRule: constantRule(false)}
+		return long, short
+	}, CandleChannel(candles[:3]))
+
+	if len(record.Trades) != 1 {
+		t.Fatalf("expected 1 liquidated trade, got %d", len(record.Trades))
+	}
+	trade := record.Trades[0]
+	if expect := bt.Margin().LiquidationPrice(techan.BUY, trade.EntranceOrder().Price); !trade.ExitOrder().Price.EQ(expect) {
+		t.Errorf("expected the trade to exit at %s, got %s", expect, trade.ExitOrder().Price)
+	}
+	if count := (LiquidationsAnalysis{Journal: bt.Fees.Journal}).Analyze(record); count != 1 {
+		t.Errorf("expected 1 liquidation, got %f", count)
+	}
+	if loss := (LiquidationLossAnalysis{Fees: bt.Fees}).Analyze(record); loss > -9 || loss < -10 {
+		t.Errorf("expected to lose most of the margin, got %f", loss)
+	}
+
+	// a trade closed at the liquidation price by the strategy is not a liquidation.
+	closed := techan.NewTradingRecord()
+	closed.Operate(*trade.EntranceOrder())
+	closed.Operate(*trade.ExitOrder())
+	if count := (LiquidationsAnalysis{Journal: bt.Fees.Journal}).Analyze(closed); count != 0 {
+		t.Errorf("expected no liquidation, got %f", count)
+	}
+}
@@ -0,0 +1,64 @@
+package internal
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/MShoaei/techan"
+)
+
+// Metrics summarizes the analyses of a trading record.
+type Metrics struct {
+	Trades       int     `json:"trades"`
+	WinRate      float64 `json:"winRate"`
+	Profit       float64 `json:"profit"`
+	Commission   float64 `json:"commission"`
+	Funding      float64 `json:"funding"`
+	NetProfit    float64 `json:"netProfit"`
+	MaxDrawdown  float64 `json:"maxDrawdown"`
+	ProfitFactor float64 `json:"profitFactor"`
+}
+
+// NewMetrics analyzes record paying fees on every trade.
+func NewMetrics(record *techan.TradingRecord, fees FeeModel) Metrics {
+	m := Metrics{
+		Trades:       int(techan.NumTradesAnalysis{}.Analyze(record)),
+		Profit:       techan.TotalProfitAnalysis{}.Analyze(record),
+		Commission:   CommissionAnalysis{Fees: fees}.Analyze(record),
+		Funding:      FundingAnalysis{Fees: fees}.Analyze(record),
+		MaxDrawdown:  MaxDrawdownAnalysis{Fees: fees}.Analyze(record),
+		ProfitFactor: ProfitFactorAnalysis{Fees: fees}.Analyze(record),
+	}
+	m.NetProfit = m.Profit - m.Commission - m.Funding
+	if m.Trades > 0 {
+		m.WinRate = ProfitableTradesAnalysis{Fees: fees}.Analyze(record) / float64(m.Trades) * 100
+	}
+	return m
+}
+
+// Objectives are the names accepted by Metrics.Score.
+var Objectives = []string{"profit", "winrate", "drawdown", "profitfactor"}
+
+// Score returns the value of the metric named by objective. a higher score is always better,
+// so the drawdown is returned negated and a profitable record without losing trades has the highest profit factor.
+// A record without trades has the lowest drawdown score, since it has no drawdown only because it never traded.
+func (m Metrics) Score(objective string) (float64, error) {
+	switch objective {
+	case "profit":
+		return m.NetProfit, nil
+	case "winrate":
+		return m.WinRate, nil
+	case "drawdown":
+		if m.Trades == 0 {
+			return -math.MaxFloat64, nil
+		}
+		return -m.MaxDrawdown, nil
+	case "profitfactor":
+		// the profit factor is 0 both without winning and without losing trades.
+		if m.ProfitFactor == 0 && m.NetProfit > 0 {
+			return math.MaxFloat64, nil
+		}
+		return m.ProfitFactor, nil
+	}
+	return 0, fmt.Errorf("invalid objective: %s", objective)
+}
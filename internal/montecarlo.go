@@ -0,0 +1,126 @@
+package internal
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+
+	"github.com/MShoaei/techan"
+)
+
+// MonteCarlo simulates alternative histories of a trading record by shuffling or resampling its closed trades.
+// It shows how much of the result of a backtest depends on the order and the selection of the trades.
+type MonteCarlo struct {
+	Iterations int
+	Seed       int64
+	Fees       FeeModel
+	// Resample draws the trades with replacement instead of shuffling them. shuffling never changes the final
+	// profit, only the path to it.
+	Resample bool
+}
+
+// Distribution describes the values of a metric over all iterations of a MonteCarlo simulation.
+type Distribution struct {
+	Mean float64 `json:"mean"`
+	Min  float64 `json:"min"`
+	P5   float64 `json:"p5"`
+	P25  float64 `json:"p25"`
+	P50  float64 `json:"p50"`
+	P75  float64 `json:"p75"`
+	P95  float64 `json:"p95"`
+	Max  float64 `json:"max"`
+}
+
+// MonteCarloReport is the outcome of a MonteCarlo simulation.
+type MonteCarloReport struct {
+	Iterations  int          `json:"iterations"`
+	Trades      int          `json:"trades"`
+	FinalProfit Distribution `json:"finalProfit"`
+	MaxDrawdown Distribution `json:"maxDrawdown"`
+	LoseStreak  Distribution `json:"loseStreak"`
+}
+
+// Run runs the simulation on the closed trades of record.
+func (mc MonteCarlo) Run(record *techan.TradingRecord) MonteCarloReport {
+	profits := make([]float64, 0, len(record.Trades))
+	for _, trade := range record.Trades {
+		if trade.IsClosed() {
+			profits = append(profits, mc.Fees.NetProfit(trade).Float())
+		}
+	}
+	report := MonteCarloReport{Iterations: mc.Iterations, Trades: len(profits)}
+	if len(profits) == 0 || mc.Iterations <= 0 {
+		return report
+	}
+
+	rng := rand.New(rand.NewSource(mc.Seed))
+	finals := make([]float64, mc.Iterations)
+	drawdowns := make([]float64, mc.Iterations)
+	streaks := make([]float64, mc.Iterations)
+	sample := make([]float64, len(profits))
+	for i := 0; i < mc.Iterations; i++ {
+		if mc.Resample {
+			for j := range sample {
+				sample[j] = profits[rng.Intn(len(profits))]
+			}
+		} else {
+			copy(sample, profits)
+			rng.Shuffle(len(sample), func(a, b int) {
+				sample[a], sample[b] = sample[b], sample[a]
+			})
+		}
+		finals[i], drawdowns[i], streaks[i] = simulatePath(sample)
+	}
+
+	report.FinalProfit = newDistribution(finals)
+	report.MaxDrawdown = newDistribution(drawdowns)
+	report.LoseStreak = newDistribution(streaks)
+	return report
+}
+
+// simulatePath returns the final profit, the maximum drawdown and the longest losing streak of trades taken in order.
+func simulatePath(profits []float64) (final, drawdown, loseStreak float64) {
+	var equity, peak float64
+	streak := 0
+	for _, profit := range profits {
+		equity += profit
+		peak = math.Max(peak, equity)
+		drawdown = math.Max(drawdown, peak-equity)
+		if profit > 0 {
+			streak = 0
+			continue
+		}
+		streak++
+		loseStreak = math.Max(loseStreak, float64(streak))
+	}
+	return equity, drawdown, loseStreak
+}
+
+func newDistribution(values []float64) Distribution {
+	sort.Float64s(values)
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return Distribution{
+		Mean: sum / float64(len(values)),
+		Min:  values[0],
+		P5:   percentile(values, 5),
+		P25:  percentile(values, 25),
+		P50:  percentile(values, 50),
+		P75:  percentile(values, 75),
+		P95:  percentile(values, 95),
+		Max:  values[len(values)-1],
+	}
+}
+
+// percentile returns the p-th percentile of sorted values using linear interpolation between the closest ranks.
+func percentile(sorted []float64, p float64) float64 {
+	if len(sorted) == 1 {
+		return sorted[0]
+	}
+	rank := p / 100 * float64(len(sorted)-1)
+	lower := int(math.Floor(rank))
+	upper := int(math.Ceil(rank))
+	return sorted[lower] + (sorted[upper]-sorted[lower])*(rank-float64(lower))
+}
@@ -0,0 +1,93 @@
+package internal
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/MShoaei/techan"
+	"github.com/sdcoffey/big"
+)
+
+// profitRecord returns a record of long trades of a single unit with the given profits.
+func profitRecord(profits ...float64) *techan.TradingRecord {
+	record := techan.NewTradingRecord()
+	start := time.Unix(0, 0)
+	for i, profit := range profits {
+		record.Operate(techan.Order{Side: techan.BUY, Price: big.NewDecimal(100), Amount: big.ONE, ExecutionTime: start.Add(time.Duration(2*i) * time.Minute)})
+		record.Operate(techan.Order{Side: techan.SELL, Price: big.NewDecimal(100 + profit), Amount: big.ONE, ExecutionTime: start.Add(time.Duration(2*i+1) * time.Minute)})
+	}
+	return record
+}
+
+func TestPercentile(t *testing.T) {
+	sorted := []float64{1, 2, 3, 4, 5}
+	for _, tt := range []struct{ p, expect float64 }{{0, 1}, {5, 1.2}, {25, 2}, {50, 3}, {95, 4.8}, {100, 5}} {
+		if got := percentile(sorted, tt.p); math.Abs(got-tt.expect) > 1e-9 {
+			t.Errorf("p%.0f: expected %f, got %f", tt.p, tt.expect, got)
+		}
+	}
+	if got := percentile([]float64{7}, 50); got != 7 {
+		t.Errorf("expected a single value to be every percentile, got %f", got)
+	}
+}
+
+func TestSimulatePath(t *testing.T) {
+	final, drawdown, streak := simulatePath([]float64{10, -5, -5, 20, -30})
+	if final != -10 || drawdown != 30 || streak != 2 {
+		t.Errorf("expected -10/30/2, got %f/%f/%f", final, drawdown, streak)
+	}
+}
+
+func TestMonteCarlo_Run(t *testing.T) {
+	record := profitRecord(10, -5, 20, -15, 5)
+	record.Operate(techan.Order{Side: techan.BUY, Price: big.NewDecimal(100), Amount: big.ONE, ExecutionTime: time.Unix(3600, 0)})
+
+	t.Run("shuffle", func(t *testing.T) {
+		mc := MonteCarlo{Iterations: 200, Seed: 1, Fees: FlatFee(0)}
+		report := mc.Run(record)
+		if report.Trades != 5 || report.Iterations != 200 {
+			t.Fatalf("expected 200 iterations of 5 closed trades, got %d of %d", report.Iterations, report.Trades)
+		}
+		if report.FinalProfit.Min != 15 || report.FinalProfit.Max != 15 {
+			t.Errorf("expected shuffling to keep the final profit at 15, got %f to %f", report.FinalProfit.Min, report.FinalProfit.Max)
+		}
+		// the loss of 15 is always a drawdown on its own and the worst order loses 20 in a row.
+		if report.MaxDrawdown.Min != 15 || report.MaxDrawdown.Max != 20 {
+			t.Errorf("expected drawdowns between 15 and 20, got %f to %f", report.MaxDrawdown.Min, report.MaxDrawdown.Max)
+		}
+		if report.LoseStreak.Min != 1 || report.LoseStreak.Max != 2 {
+			t.Errorf("expected losing streaks between 1 and 2, got %f to %f", report.LoseStreak.Min, report.LoseStreak.Max)
+		}
+		if !reflect.DeepEqual(report, mc.Run(record)) {
+			t.Errorf("expected the same seed to give the same report")
+		}
+	})
+
+	t.Run("resample", func(t *testing.T) {
+		mc := MonteCarlo{Iterations: 200, Seed: 1, Fees: FlatFee(0), Resample: true}
+		report := mc.Run(record)
+		if report.FinalProfit.Min < -75 || report.FinalProfit.Max > 100 || report.FinalProfit.Min == report.FinalProfit.Max {
+			t.Errorf("expected resampled final profits to vary between -75 and 100, got %f to %f", report.FinalProfit.Min, report.FinalProfit.Max)
+		}
+		d := report.FinalProfit
+		if !(d.Min <= d.P5 && d.P5 <= d.P25 && d.P25 <= d.P50 && d.P50 <= d.P75 && d.P75 <= d.P95 && d.P95 <= d.Max) {
+			t.Errorf("expected ordered percentiles, got %+v", d)
+		}
+		if !reflect.DeepEqual(report, mc.Run(record)) {
+			t.Errorf("expected the same seed to give the same report")
+		}
+		mc.Seed = 2
+		if reflect.DeepEqual(report, mc.Run(record)) {
+			t.Errorf("expected another seed to give another report")
+		}
+	})
+
+	t.Run("empty", func(t *testing.T) {
+		report := MonteCarlo{Iterations: 10, Fees: FlatFee(0)}.Run(techan.NewTradingRecord())
+		if report.Trades != 0 || report.FinalProfit != (Distribution{}) {
+			t.Errorf("expected an empty report, got %+v", report)
+		}
+	})
+}
@@ -0,0 +1,144 @@
+package internal
+
+import (
+	"fmt"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/MShoaei/techan"
+)
+
+// Grid holds the values to test for each parameter of a strategy.
+type Grid map[string][]float64
+
+// ParseRange parses the values of a grid parameter. s is either a range in the
+// form of start:end:step, a comma separated list of values or a single value.
+func ParseRange(s string) ([]float64, error) {
+	if parts := strings.Split(s, ":"); len(parts) == 3 {
+		bounds := make([]float64, 3)
+		for i, part := range parts {
+			v, err := strconv.ParseFloat(part, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid range %q: %v", s, err)
+			}
+			bounds[i] = v
+		}
+		start, end, step := bounds[0], bounds[1], bounds[2]
+		if step <= 0 || end < start {
+			return nil, fmt.Errorf("invalid range %q", s)
+		}
+		values := make([]float64, 0)
+		for i := 0; start+float64(i)*step <= end+step*1e-9; i++ {
+			values = append(values, start+float64(i)*step)
+		}
+		return values, nil
+	}
+
+	values := make([]float64, 0)
+	for _, part := range strings.Split(s, ",") {
+		v, err := strconv.ParseFloat(strings.TrimSpace(part), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value %q: %v", part, err)
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// Combinations returns every combination of the parameter values in the grid.
+func (g Grid) Combinations() []Params {
+	names := make([]string, 0, len(g))
+	for name := range g {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	combinations := []Params{{}}
+	for _, name := range names {
+		next := make([]Params, 0, len(combinations)*len(g[name]))
+		for _, params := range combinations {
+			for _, value := range g[name] {
+				next = append(next, params.With(Params{name: value}))
+			}
+		}
+		combinations = next
+	}
+	return combinations
+}
+
+// OptimizeResult is the outcome of a backtest using Params.
+type OptimizeResult struct {
+	Params  Params  `json:"params"`
+	Metrics Metrics `json:"metrics"`
+}
+
+// Optimizer runs a backtest for every combination of parameters in a grid.
+type Optimizer struct {
+	// Backtest is used as the template of every backtest run by the optimizer.
+	Backtest Backtest
+	// Workers is the number of backtests run concurrently. it defaults to the number of CPUs.
+	Workers int
+}
+
+// Run backtests the strategy created by f for every combination of parameters in grid against candles.
+// The results are returned in the same order as grid.Combinations.
+func (o Optimizer) Run(f ParamStrategyFunc, grid Grid, candles []*techan.Candle) []OptimizeResult {
+	combinations := grid.Combinations()
+	results := make([]OptimizeResult, len(combinations))
+
+	workers := o.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				bt := o.Backtest
+				bt.Fees = bt.Fees.fresh()
+				_, record := bt.Run(f(combinations[job]), CandleChannel(candles))
+				results[job] = OptimizeResult{
+					Params:  combinations[job],
+					Metrics: NewMetrics(record, bt.Fees),
+				}
+			}
+		}()
+	}
+	for i := range combinations {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return results
+}
+
+// RankResults sorts results from the best to the worst score of objective.
+func RankResults(results []OptimizeResult, objective string) error {
+	if _, err := (Metrics{}).Score(objective); err != nil {
+		return err
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		a, _ := results[i].Metrics.Score(objective)
+		b, _ := results[j].Metrics.Score(objective)
+		return a > b
+	})
+	return nil
+}
+
+// CandleChannel returns a channel which yields candles in order and is closed afterwards.
+func CandleChannel(candles []*techan.Candle) <-chan *techan.Candle {
+	candleC := make(chan *techan.Candle)
+	go func() {
+		defer close(candleC)
+		for _, candle := range candles {
+			candleC <- candle
+		}
+	}()
+	return candleC
+}
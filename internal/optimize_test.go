@@ -0,0 +1,80 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseRange(t *testing.T) {
+	tests := []struct {
+		in     string
+		expect []float64
+	}{
+		{"10:30:10", []float64{10, 20, 30}},
+		{"0.5:1.5:0.5", []float64{0.5, 1, 1.5}},
+		{"1,3, 5", []float64{1, 3, 5}},
+		{"7", []float64{7}},
+	}
+	for _, tt := range tests {
+		got, err := ParseRange(tt.in)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, tt.expect) {
+			t.Errorf("%s: expected %v, got %v", tt.in, tt.expect, got)
+		}
+	}
+	if _, err := ParseRange("30:10:10"); err == nil {
+		t.Errorf("expected an error for a decreasing range")
+	}
+}
+
+func TestGrid_Combinations(t *testing.T) {
+	grid := Grid{"fast": {10, 20}, "slow": {100, 200, 300}}
+	combinations := grid.Combinations()
+	if len(combinations) != 6 {
+		t.Fatalf("expected 6 combinations, got %d", len(combinations))
+	}
+	if combinations[0]["fast"] != 10 || combinations[0]["slow"] != 100 {
+		t.Errorf("unexpected first combination %v", combinations[0])
+	}
+	if combinations[5]["fast"] != 20 || combinations[5]["slow"] != 300 {
+		t.Errorf("unexpected last combination %v", combinations[5])
+	}
+}
+
+func TestRankResults_ProfitFactor(t *testing.T) {
+	results := []OptimizeResult{
+		{Params: Params{"x": 1}, Metrics: Metrics{Trades: 2, NetProfit: -5}},
+		{Params: Params{"x": 2}, Metrics: Metrics{Trades: 3, NetProfit: 10, ProfitFactor: 2}},
+		{Params: Params{"x": 3}, Metrics: Metrics{Trades: 2, NetProfit: 4}},
+	}
+	if err := RankResults(results, "profitfactor"); err != nil {
+		t.Fatal(err)
+	}
+	var ranked []float64
+	for _, result := range results {
+		ranked = append(ranked, result.Params["x"])
+	}
+	if !reflect.DeepEqual(ranked, []float64{3, 2, 1}) {
+		t.Errorf("expected the record without losses to rank first, got %v", ranked)
+	}
+}
+
+func TestRankResults_Drawdown(t *testing.T) {
+	results := []OptimizeResult{
+		{Params: Params{"x": 1}},
+		{Params: Params{"x": 2}, Metrics: Metrics{Trades: 3, MaxDrawdown: 20}},
+		{Params: Params{"x": 3}, Metrics: Metrics{Trades: 2, MaxDrawdown: 5}},
+	}
+	if err := RankResults(results, "drawdown"); err != nil {
+		t.Fatal(err)
+	}
+	var ranked []float64
+	for _, result := range results {
+		ranked = append(ranked, result.Params["x"])
+	}
+	if !reflect.DeepEqual(ranked, []float64{3, 2, 1}) {
+		t.Errorf("expected the record without trades to rank last, got %v", ranked)
+	}
+}
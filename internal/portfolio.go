@@ -0,0 +1,258 @@
+package internal
+
+import (
+	"math"
+	"sort"
+	"time"
+
+	"github.com/MShoaei/techan"
+	"github.com/sdcoffey/big"
+)
+
+// Portfolio backtests a strategy on several symbols which share a single cash balance.
+// Every position locks Risk of the cash as margin, the same way Backtest sizes its positions, and is liquidated
+// when its loss leaves no margin.
+type Portfolio struct {
+	Capital  float64
+	Risk     float64
+	Leverage int
+	Fees     FeeModel
+	Bracket  Bracket
+	// MaxPositions is the maximum number of positions open at the same time. 0 means no limit.
+	MaxPositions int
+	// MaxAllocation is the maximum margin of a single position in percent of the equity. 0 means no limit.
+	MaxAllocation float64
+	// Allocation overrides MaxAllocation for individual symbols.
+	Allocation map[string]float64
+}
+
+// PortfolioSymbol holds the candles of a symbol in a portfolio.
+type PortfolioSymbol struct {
+	Symbol  string
+	Candles []*techan.Candle
+}
+
+// PortfolioPoint is the state of a portfolio at the end of a candle.
+type PortfolioPoint struct {
+	Time      time.Time `json:"time"`
+	Cash      float64   `json:"cash"`
+	Equity    float64   `json:"equity"`
+	Exposure  float64   `json:"exposure"`
+	Positions int       `json:"positions"`
+}
+
+// SymbolContribution is the part of the profit of a portfolio made by a single symbol.
+type SymbolContribution struct {
+	Symbol    string  `json:"symbol"`
+	Trades    int     `json:"trades"`
+	NetProfit float64 `json:"netProfit"`
+	OpenPL    float64 `json:"openPL"`
+	// Contribution is NetProfit and OpenPL in percent of the starting capital.
+	Contribution float64 `json:"contribution"`
+	// Skipped is the number of entry signals skipped because of the limits of the portfolio.
+	Skipped int `json:"skipped"`
+}
+
+// PortfolioReport is the outcome of a portfolio backtest.
+type PortfolioReport struct {
+	Capital         float64                          `json:"capital"`
+	FinalEquity     float64                          `json:"finalEquity"`
+	Return          float64                          `json:"return"`
+	MaxDrawdown     float64                          `json:"maxDrawdown"`
+	MaxExposure     float64                          `json:"maxExposure"`
+	AverageExposure float64                          `json:"averageExposure"`
+	Symbols         []SymbolContribution             `json:"symbols"`
+	Equity          []PortfolioPoint                 `json:"equity"`
+	Records         map[string]*techan.TradingRecord `json:"-"`
+}
+
+type portfolioSlot struct {
+	engine  *Engine
+	candles []*techan.Candle
+	next    int
+	margin  float64
+	skipped int
+	// candle is the candle of the current step and entering reports if the slot may enter on it.
+	candle   *techan.Candle
+	entering bool
+}
+
+// portfolioSizer sizes the entries of a slot with the margin the portfolio allows them, which is nothing once its
+// cash is spent or MaxPositions positions are open.
+type portfolioSizer struct {
+	p     Portfolio
+	slot  *portfolioSlot
+	slots []*portfolioSlot
+	cash  *float64
+}
+
+// Size returns the amount worth the margin of the entry with leverage.
+func (s portfolioSizer) Size(ctx SizeContext) big.Decimal {
+	margin := math.Min(s.p.margin(s.slot.engine.Symbol, s.p.equity(*s.cash, s.slots)), *s.cash)
+	// the cash is negative when the fees of a liquidated position took more than the rest of its margin.
+	if (s.p.MaxPositions > 0 && s.p.openPositions(s.slots) >= s.p.MaxPositions) || margin <= 0 {
+		s.slot.skipped++
+		return big.ZERO
+	}
+	amount := CalculateAmount(big.NewDecimal(margin), ctx.Price, big.NewFromInt(s.p.Leverage))
+	if amount.Zero() {
+		s.slot.skipped++
+	}
+	return amount
+}
+
+// Run runs the portfolio backtest of the strategy created by f. The candles of all symbols are aligned by their
+// start time and on every step the exits of all symbols are processed before any entry, so the capital freed by a
+// closed position can be used by another symbol on the same candle.
+func (p Portfolio) Run(f DynamicStrategyFunc, symbols []PortfolioSymbol) PortfolioReport {
+	cash := p.Capital
+	slots := make([]*portfolioSlot, len(symbols))
+	times := make([]time.Time, 0)
+	seen := make(map[int64]bool)
+	for i, s := range symbols {
+		bt := &Backtest{Symbol: s.Symbol, Risk: p.Risk, Leverage: p.Leverage, Bracket: p.Bracket, Fees: p.Fees}
+		slots[i] = &portfolioSlot{candles: s.Candles}
+		slots[i].engine = bt.engine(func(series *techan.TimeSeries, _ map[string]*HigherSeries) (long, short techan.RuleStrategy) {
+			return f(series)
+		})
+		slots[i].engine.Sizer = portfolioSizer{p: p, slot: slots[i], slots: slots, cash: &cash}
+		slots[i].engine.Start(nil, nil)
+		for _, candle := range s.Candles {
+			if !seen[candle.Period.Start.UnixNano()] {
+				seen[candle.Period.Start.UnixNano()] = true
+				times = append(times, candle.Period.Start)
+			}
+		}
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+
+	report := PortfolioReport{Capital: p.Capital, Equity: make([]PortfolioPoint, 0, len(times))}
+	for _, t := range times {
+		stepping := make([]*portfolioSlot, 0, len(slots))
+		for _, slot := range slots {
+			if slot.next < len(slot.candles) && slot.candles[slot.next].Period.Start.Equal(t) {
+				stepping = append(stepping, slot)
+			}
+		}
+
+		for _, slot := range stepping {
+			e := slot.engine
+			slot.candle, _ = e.add(KlineEvent(e.Symbol, "", slot.candles[slot.next], true))
+			slot.next++
+			slot.entering = e.ready(slot.candle) && e.manage(slot.candle)
+			if slot.margin > 0 && !e.record.CurrentPosition().IsOpen() {
+				cash += slot.margin + p.Fees.NetProfit(e.record.LastTrade()).Float()
+				slot.margin = 0
+			}
+		}
+
+		for _, slot := range stepping {
+			e := slot.engine
+			if !slot.entering || e.record.CurrentPosition().IsOpen() {
+				continue
+			}
+			e.open(slot.candle)
+			if position := e.record.CurrentPosition(); position.IsOpen() {
+				entry := position.EntranceOrder()
+				slot.margin = entry.Amount.Mul(entry.Price).Float() / float64(p.Leverage)
+				cash -= slot.margin
+			}
+		}
+
+		report.Equity = append(report.Equity, PortfolioPoint{
+			Time:      t,
+			Cash:      cash,
+			Equity:    p.equity(cash, slots),
+			Exposure:  p.exposure(cash, slots),
+			Positions: p.openPositions(slots),
+		})
+	}
+
+	report.Records = make(map[string]*techan.TradingRecord, len(slots))
+	var peak, exposure float64
+	for _, point := range report.Equity {
+		peak = math.Max(peak, point.Equity)
+		if peak > 0 {
+			report.MaxDrawdown = math.Max(report.MaxDrawdown, (peak-point.Equity)/peak*100)
+		}
+		report.MaxExposure = math.Max(report.MaxExposure, point.Exposure)
+		exposure += point.Exposure
+	}
+	if len(report.Equity) > 0 {
+		report.AverageExposure = exposure / float64(len(report.Equity))
+	}
+	report.FinalEquity = p.equity(cash, slots)
+	if p.Capital > 0 {
+		report.Return = (report.FinalEquity - p.Capital) / p.Capital * 100
+	}
+	for _, slot := range slots {
+		e := slot.engine
+		report.Records[e.Symbol] = e.record
+		contribution := SymbolContribution{
+			Symbol:    e.Symbol,
+			Trades:    len(e.record.Trades),
+			NetProfit: TotalProfitAnalysis{Fees: p.Fees}.Analyze(e.record),
+			OpenPL:    slot.openPL(p.Fees),
+			Skipped:   slot.skipped,
+		}
+		if p.Capital > 0 {
+			contribution.Contribution = (contribution.NetProfit + contribution.OpenPL) / p.Capital * 100
+		}
+		report.Symbols = append(report.Symbols, contribution)
+	}
+	return report
+}
+
+// margin returns the margin of a new position of symbol when the portfolio is worth equity.
+func (p Portfolio) margin(symbol string, equity float64) float64 {
+	margin := p.Risk
+	limit, ok := p.Allocation[symbol]
+	if !ok {
+		limit = p.MaxAllocation
+	}
+	if limit > 0 {
+		margin = math.Min(margin, equity*limit*0.01)
+	}
+	return margin
+}
+
+func (p Portfolio) equity(cash float64, slots []*portfolioSlot) float64 {
+	equity := cash
+	for _, slot := range slots {
+		equity += slot.margin + slot.openPL(p.Fees)
+	}
+	return equity
+}
+
+// exposure returns the value of the open positions divided by the equity.
+func (p Portfolio) exposure(cash float64, slots []*portfolioSlot) float64 {
+	equity := p.equity(cash, slots)
+	if equity <= 0 {
+		return 0
+	}
+	var value float64
+	for _, slot := range slots {
+		position := slot.engine.record.CurrentPosition()
+		if position.IsOpen() {
+			value += position.EntranceOrder().Amount.Mul(slot.engine.series.LastCandle().ClosePrice).Float()
+		}
+	}
+	return value / equity
+}
+
+func (p Portfolio) openPositions(slots []*portfolioSlot) int {
+	open := 0
+	for _, slot := range slots {
+		if slot.engine.record.CurrentPosition().IsOpen() {
+			open++
+		}
+	}
+	return open
+}
+
+func (slot *portfolioSlot) openPL(fees FeeModel) float64 {
+	if !slot.engine.record.CurrentPosition().IsOpen() {
+		return 0
+	}
+	return OpenPLAnalysis{LastCandle: slot.engine.series.LastCandle(), Fees: fees}.Analyze(slot.engine.record)
+}
@@ -0,0 +1,100 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/MShoaei/techan"
+	"github.com/sdcoffey/big"
+)
+
+// portfolioSymbol returns a symbol with a candle at every minute from start with the given close prices.
+func portfolioSymbol(symbol string, start int, prices ...float64) PortfolioSymbol {
+	s := PortfolioSymbol{Symbol: symbol}
+	for i, price := range prices {
+		candle := techan.NewCandle(techan.NewTimePeriod(time.Unix(int64((start+i)*60), 0), time.Minute))
+		p := big.NewDecimal(price)
+		candle.OpenPrice, candle.MaxPrice, candle.MinPrice, candle.ClosePrice = p, p, p, p
+		s.Candles = append(s.Candles, candle)
+	}
+	return s
+}
+
+// indexStrategy enters long on the second candle of every symbol and exits at the indices of exit.
+func indexStrategy(exit indexRule) DynamicStrategyFunc {
+	return func(series *techan.TimeSeries) (long, short techan.RuleStrategy) {
+		long = techan.RuleStrategy{EntryRule: indexRule{1: true}, ExitRule: exit}
+		short = techan.RuleStrategy{EntryRule: constantRule(false), ExitRule: constantRule(false)}
+		return long, short
+	}
+}
+
+func TestPortfolio_Run(t *testing.T) {
+	amount := func(report PortfolioReport, symbol string) float64 {
+		position := report.Records[symbol].CurrentPosition()
+		if !position.IsOpen() {
+			return 0
+		}
+		return position.EntranceOrder().Amount.Float()
+	}
+
+	t.Run("shared cash", func(t *testing.T) {
+		p := Portfolio{Capital: 100, Risk: 60, Leverage: 1, Fees: FlatFee(0)}
+		report := p.Run(indexStrategy(indexRule{}), []PortfolioSymbol{
+			portfolioSymbol("A", 0, 10, 10),
+			portfolioSymbol("B", 0, 10, 10),
+		})
+		// B only gets the 40 left by A.
+		if amount(report, "A") != 6 || amount(report, "B") != 4 {
+			t.Errorf("expected amounts of 6 and 4, got %f and %f", amount(report, "A"), amount(report, "B"))
+		}
+		if last := report.Equity[len(report.Equity)-1]; last.Cash != 0 || last.Equity != 100 || last.Positions != 2 {
+			t.Errorf("expected all cash to be locked in 2 positions, got %+v", last)
+		}
+	})
+
+	t.Run("max positions", func(t *testing.T) {
+		p := Portfolio{Capital: 100, Risk: 10, Leverage: 1, Fees: FlatFee(0), MaxPositions: 1}
+		report := p.Run(indexStrategy(indexRule{}), []PortfolioSymbol{
+			portfolioSymbol("A", 0, 10, 10),
+			portfolioSymbol("B", 0, 10, 10),
+		})
+		if amount(report, "A") != 1 || amount(report, "B") != 0 {
+			t.Errorf("expected only A to be open, got amounts %f and %f", amount(report, "A"), amount(report, "B"))
+		}
+		if report.Symbols[1].Skipped != 1 {
+			t.Errorf("expected the entry of B to be skipped, got %d", report.Symbols[1].Skipped)
+		}
+	})
+
+	t.Run("exhausted cash", func(t *testing.T) {
+		p := Portfolio{Capital: 100, Risk: 50, Leverage: 1, Fees: FlatFee(0)}
+		report := p.Run(indexStrategy(indexRule{}), []PortfolioSymbol{
+			portfolioSymbol("A", 0, 10, 10),
+			portfolioSymbol("B", 0, 10, 10),
+			portfolioSymbol("C", 0, 10, 10),
+		})
+		if amount(report, "C") != 0 || report.Symbols[2].Skipped != 1 {
+			t.Errorf("expected the entry of C to be skipped, got amount %f", amount(report, "C"))
+		}
+	})
+
+	t.Run("negative cash", func(t *testing.T) {
+		// A is liquidated with a leverage of 10 and its fees take more than the rest of its margin, so no cash is
+		// left when B wants to enter.
+		p := Portfolio{Capital: 100, Risk: 100, Leverage: 10, Fees: FlatFee(1)}
+		report := p.Run(indexStrategy(indexRule{}), []PortfolioSymbol{
+			portfolioSymbol("A", 0, 100, 100, 100, 80),
+			portfolioSymbol("B", 2, 100, 100),
+		})
+		if len(report.Records["A"].Trades) != 1 {
+			t.Fatalf("expected A to be liquidated")
+		}
+		if last := report.Equity[len(report.Equity)-1]; last.Cash >= 0 {
+			t.Fatalf("expected a negative cash, got %f", last.Cash)
+		}
+		if report.Records["B"].CurrentPosition().IsOpen() || report.Symbols[1].Skipped != 1 {
+			t.Errorf("expected the entry of B to be skipped")
+		}
+	})
+}
@@ -0,0 +1,237 @@
+package internal
+
+import (
+	"fmt"
+	"math"
+	"sync"
+
+	"github.com/MShoaei/techan"
+)
+
+// DefaultStrategy is the name of the strategy traded by the engine when it is not given one.
+const DefaultStrategy = "ema"
+
+// ParamInfo describes a parameter of a registered strategy. Min and Max bound its value unless they are zero.
+// Positive and NonNegative bound it by zero instead.
+type ParamInfo struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description"`
+	Integer     bool    `json:"integer"`
+	Min         float64 `json:"min"`
+	Max         float64 `json:"max"`
+	Positive    bool    `json:"positive"`
+	NonNegative bool    `json:"nonNegative"`
+}
+
+// StrategyInfo describes a strategy registered by RegisterStrategy. Exactly one of New and Static must be set.
+type StrategyInfo struct {
+	Name        string
+	Description string
+	Defaults    Params
+	Schema      []ParamInfo
+	// Timeframes are the names of the higher timeframe series the strategy needs.
+	Timeframes []string
+	// New creates the strategy using the given parameters. parameters which are not set use their default value.
+	New func(Params) MultiTimeframeStrategyFunc
+	// Static creates a strategy which only exits through the bracket. it has no parameters.
+	Static StaticStrategyFunc
+	// Validate reports if a combination of parameters, which are each within their bounds, is invalid. it is
+	// optional.
+	Validate func(Params) error
+}
+
+var registry = struct {
+	sync.RWMutex
+	names      []string
+	strategies map[string]StrategyInfo
+}{strategies: make(map[string]StrategyInfo)}
+
+// RegisterStrategy makes a strategy available by its name. It panics if the name is already registered.
+func RegisterStrategy(info StrategyInfo) {
+	registry.Lock()
+	defer registry.Unlock()
+	if info.Name == "" || (info.New == nil) == (info.Static == nil) {
+		panic("internal: invalid strategy " + info.Name)
+	}
+	if _, ok := registry.strategies[info.Name]; ok {
+		panic("internal: strategy " + info.Name + " registered twice")
+	}
+	registry.names = append(registry.names, info.Name)
+	registry.strategies[info.Name] = info
+}
+
+// LookupStrategy returns the strategy registered as name.
+func LookupStrategy(name string) (StrategyInfo, error) {
+	registry.RLock()
+	defer registry.RUnlock()
+	info, ok := registry.strategies[name]
+	if !ok {
+		return info, fmt.Errorf("unknown strategy %q", name)
+	}
+	return info, nil
+}
+
+// Strategies returns the registered strategies in the order they were registered.
+func Strategies() []StrategyInfo {
+	registry.RLock()
+	defer registry.RUnlock()
+	strategies := make([]StrategyInfo, 0, len(registry.names))
+	for _, name := range registry.names {
+		strategies = append(strategies, registry.strategies[name])
+	}
+	return strategies
+}
+
+// Params returns the defaults of s with overrides replacing them. It fails if a parameter is not in the schema of
+// s or is out of its bounds.
+func (s StrategyInfo) Params(overrides Params) (Params, error) {
+	for name, value := range overrides {
+		param, ok := s.param(name)
+		if !ok {
+			return nil, fmt.Errorf("strategy %s has no parameter %q", s.Name, name)
+		}
+		switch {
+		case param.Integer && value != math.Trunc(value):
+			return nil, fmt.Errorf("parameter %s must be an integer, got %v", name, value)
+		case param.Min != 0 && value < param.Min:
+			return nil, fmt.Errorf("parameter %s must be at least %v, got %v", name, param.Min, value)
+		case param.Max != 0 && value > param.Max:
+			return nil, fmt.Errorf("parameter %s must be at most %v, got %v", name, param.Max, value)
+		case param.Positive && value <= 0:
+			return nil, fmt.Errorf("parameter %s must be positive, got %v", name, value)
+		case param.NonNegative && value < 0:
+			return nil, fmt.Errorf("parameter %s can not be negative, got %v", name, value)
+		}
+	}
+	params := s.Defaults.With(overrides)
+	if s.Validate != nil {
+		if err := s.Validate(params); err != nil {
+			return nil, err
+		}
+	}
+	return params, nil
+}
+
+func (s StrategyInfo) param(name string) (ParamInfo, bool) {
+	for _, param := range s.Schema {
+		if param.Name == name {
+			return param, true
+		}
+	}
+	return ParamInfo{}, false
+}
+
+// ParamStrategy returns the constructor of s used by the optimizer, the walk-forward analysis and the portfolio
+// backtest, which only trade a single timeframe.
+func (s StrategyInfo) ParamStrategy() (ParamStrategyFunc, error) {
+	if s.Static != nil || len(s.Schema) == 0 {
+		return nil, fmt.Errorf("strategy %s has no parameters", s.Name)
+	}
+	if len(s.Timeframes) > 0 {
+		return nil, fmt.Errorf("strategy %s needs higher timeframes", s.Name)
+	}
+	return func(p Params) DynamicStrategyFunc {
+		f := s.New(p)
+		return func(series *techan.TimeSeries) (long, short techan.RuleStrategy) {
+			return f(series, nil)
+		}
+	}, nil
+}
+
+// EngineStrategy returns s using p traded by an Engine with the higher timeframe series named by timeframes.
+// Strategies which only exit through the bracket can not be traded by an Engine.
+func (s StrategyInfo) EngineStrategy(p Params, timeframes []string) (MultiTimeframeStrategyFunc, error) {
+	if s.Static != nil {
+		return nil, fmt.Errorf("strategy %s can not be traded by the engine", s.Name)
+	}
+	for _, name := range s.Timeframes {
+		found := false
+		for _, timeframe := range timeframes {
+			found = found || timeframe == name
+		}
+		if !found {
+			return nil, fmt.Errorf("strategy %s needs a %s timeframe", s.Name, name)
+		}
+	}
+	return s.New(p), nil
+}
+
+// single registers a strategy of a single timeframe.
+func single(f ParamStrategyFunc) func(Params) MultiTimeframeStrategyFunc {
+	return func(p Params) MultiTimeframeStrategyFunc {
+		return SingleTimeframe(f(p))
+	}
+}
+
+// window is the schema of a window parameter of an indicator.
+func window(name, description string) ParamInfo {
+	return ParamInfo{Name: name, Description: description, Integer: true, Min: 1}
+}
+
+func init() {
+	RegisterStrategy(StrategyInfo{
+		Name:        "bollinger-stoch",
+		Description: "enters when the close crosses back into the bollinger bands while the slow stochastic is oversold or overbought",
+		Defaults:    BollingerStochDefaults,
+		Schema: []ParamInfo{
+			window("bb_window", "window of the bollinger bands"),
+			{Name: "bb_sigma", Description: "width of the bollinger bands in standard deviations", Min: 0.1},
+			window("stoch_window", "window of the stochastic oscillator"),
+			window("stoch_smooth", "window of the slow stochastic"),
+			{Name: "oversold", Description: "stochastic level under which longs are entered", Max: 100},
+			{Name: "overbought", Description: "stochastic level over which shorts are entered", Max: 100},
+		},
+		New: single(NewBollingerStochStrategy),
+	})
+	RegisterStrategy(StrategyInfo{
+		Name:        "macd",
+		Description: "trades the crosses of the MACD histogram over zero",
+		Defaults:    MACDDefaults,
+		Schema: []ParamInfo{
+			window("fast", "window of the fast EMA"),
+			window("slow", "window of the slow EMA"),
+			window("signal", "window of the signal line"),
+		},
+		New: single(NewMACDStrategy),
+	})
+	RegisterStrategy(StrategyInfo{
+		Name:        "ema",
+		Description: "enters when the close and the fast EMA are on the same side of the slow EMA and exits when the close crosses the slow EMA",
+		Defaults:    EMADefaults,
+		Schema: []ParamInfo{
+			window("fast", "window of the fast EMA"),
+			window("slow", "window of the slow EMA. also the unstable period"),
+		},
+		New: single(NewEMAStrategy),
+	})
+	RegisterStrategy(StrategyInfo{
+		Name:        "ichimoku",
+		Description: "enters when the close, the lagging span and the lines agree with the direction of the Ichimoku cloud",
+		Defaults:    IchimokuDefaults,
+		Schema: []ParamInfo{
+			window("conversion", "window of the conversion line"),
+			window("base", "window of the base line"),
+			window("span_b", "window of the leading span B"),
+			window("displacement", "number of candles the spans are displaced by"),
+		},
+		New: single(NewIchimokuStrategy),
+	})
+	RegisterStrategy(StrategyInfo{
+		Name:        "ema-stoch-atr",
+		Description: "enters on stochastic RSI crosses in the direction of aligned 8, 14 and 50 EMAs. positions are only closed by the bracket",
+		Static:      CreateEMAStochATRStrategy,
+	})
+	RegisterStrategy(StrategyInfo{
+		Name:        "ema-trend",
+		Description: "the ema strategy only entering in the direction of the EMA trend of the higher timeframe series named trend",
+		Defaults:    EMATrendDefaults,
+		Schema: []ParamInfo{
+			window("fast", "window of the fast EMA"),
+			window("slow", "window of the slow EMA. also the unstable period"),
+			window("trend", "window of the EMA of the trend series"),
+		},
+		Timeframes: []string{"trend"},
+		New:        NewEMATrendStrategy,
+	})
+	RegisterStrategy(ensembleInfo())
+}
@@ -0,0 +1,76 @@
+package internal
+
+import (
+	"testing"
+)
+
+func TestStrategies(t *testing.T) {
+	var names []string
+	for _, info := range Strategies() {
+		names = append(names, info.Name)
+		for _, param := range info.Schema {
+			if _, ok := info.Defaults[param.Name]; !ok {
+				t.Errorf("strategy %s has no default for parameter %s", info.Name, param.Name)
+			}
+		}
+	}
+	// the numbers of the strategies are their position, so the order must not change.
+	expected := []string{"bollinger-stoch", "macd", "ema", "ichimoku", "ema-stoch-atr", "ema-trend", "ensemble"}
+	if len(names) != len(expected) {
+		t.Fatalf("expected strategies %v, got %v", expected, names)
+	}
+	for i := range expected {
+		if names[i] != expected[i] {
+			t.Fatalf("expected strategies %v, got %v", expected, names)
+		}
+	}
+	if _, err := LookupStrategy(DefaultStrategy); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LookupStrategy("unknown"); err == nil {
+		t.Error("expected an error looking up an unknown strategy")
+	}
+}
+
+func TestStrategyParams(t *testing.T) {
+	info, err := LookupStrategy("ema")
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := info.Params(Params{"fast": 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p["fast"] != 10 || p["slow"] != EMADefaults["slow"] {
+		t.Errorf("expected fast 10 and the default slow, got %v", p)
+	}
+	for _, overrides := range []Params{{"fast": 10.5}, {"fast": 0}, {"unknown": 1}} {
+		if _, err := info.Params(overrides); err == nil {
+			t.Errorf("expected an error for %v", overrides)
+		}
+	}
+}
+
+func TestStrategyConstructors(t *testing.T) {
+	static, _ := LookupStrategy("ema-stoch-atr")
+	trend, _ := LookupStrategy("ema-trend")
+	ema, _ := LookupStrategy("ema")
+	if _, err := static.ParamStrategy(); err == nil {
+		t.Error("expected an error optimizing a static strategy")
+	}
+	if _, err := trend.ParamStrategy(); err == nil {
+		t.Error("expected an error optimizing a strategy which needs higher timeframes")
+	}
+	if _, err := ema.ParamStrategy(); err != nil {
+		t.Error(err)
+	}
+	if _, err := static.EngineStrategy(nil, nil); err == nil {
+		t.Error("expected an error trading a static strategy")
+	}
+	if _, err := trend.EngineStrategy(nil, nil); err == nil {
+		t.Error("expected an error trading ema-trend without a trend timeframe")
+	}
+	if _, err := trend.EngineStrategy(nil, []string{"trend"}); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,130 @@
+package internal
+
+import (
+	"math"
+	"time"
+
+	"github.com/MShoaei/techan"
+	"github.com/adshao/go-binance/v2"
+	"github.com/sdcoffey/big"
+)
+
+// Clock is a simulated clock which runs Speed times faster than the wall clock from the time it is started at.
+// A clock with a zero Speed does not wait at all.
+type Clock struct {
+	Speed float64
+
+	start time.Time
+	wall  time.Time
+}
+
+// NewClock returns a clock starting at start.
+func NewClock(start time.Time, speed float64) *Clock {
+	return &Clock{Speed: speed, start: start, wall: time.Now()}
+}
+
+// Now returns the simulated time.
+func (c *Clock) Now() time.Time {
+	if c.Speed <= 0 {
+		return c.start
+	}
+	return c.start.Add(time.Duration(float64(time.Since(c.wall)) * c.Speed))
+}
+
+// SleepUntil waits until the simulated time reaches t. It returns false if stopC is closed or receives first.
+func (c *Clock) SleepUntil(t time.Time, stopC <-chan struct{}) bool {
+	if c.Speed <= 0 {
+		c.start = t
+		select {
+		case <-stopC:
+			return false
+		default:
+			return true
+		}
+	}
+	timer := time.NewTimer(time.Duration(float64(t.Sub(c.Now())) / c.Speed))
+	defer timer.Stop()
+	select {
+	case <-stopC:
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// Replay sends stored candles to a kline handler the way the binance kline stream does, paced by Clock.
+// Every candle is preceded by Updates non-final updates synthesized from its prices.
+type Replay struct {
+	Symbol   string
+	Interval string
+	Candles  []*techan.Candle
+	Updates  int
+	Clock    *Clock
+}
+
+// Run sends the klines of the replay to handler. It returns false if stopC stopped the replay early.
+func (r Replay) Run(handler binance.WsKlineHandler, stopC <-chan struct{}) bool {
+	for _, candle := range r.Candles {
+		updates := PartialCandles(candle, r.Updates)
+		duration := candle.Period.End.Sub(candle.Period.Start)
+		for i, update := range updates {
+			at := candle.Period.Start.Add(duration * time.Duration(i+1) / time.Duration(len(updates)))
+			if !r.Clock.SleepUntil(at, stopC) {
+				return false
+			}
+			event := KlineEvent(r.Symbol, r.Interval, update, i == len(updates)-1)
+			event.Time = at.UnixNano() / int64(time.Millisecond)
+			handler(event)
+		}
+	}
+	return true
+}
+
+// PartialCandles returns n snapshots of candle while it is still open followed by candle itself. The price moves
+// from the open to the low and then the high before the close on bullish candles, and to the high first on bearish
+// ones.
+func PartialCandles(candle *techan.Candle, n int) []*techan.Candle {
+	open, close := candle.OpenPrice.Float(), candle.ClosePrice.Float()
+	path := []float64{open, candle.MinPrice.Float(), candle.MaxPrice.Float(), close}
+	if close < open {
+		path[1], path[2] = path[2], path[1]
+	}
+	var length float64
+	for i := 1; i < len(path); i++ {
+		length += math.Abs(path[i] - path[i-1])
+	}
+
+	candles := make([]*techan.Candle, 0, n+1)
+	for k := 1; k <= n; k++ {
+		fraction := float64(k) / float64(n+1)
+		price, high, low := walk(path, length*fraction)
+		candles = append(candles, &techan.Candle{
+			Period:     candle.Period,
+			OpenPrice:  candle.OpenPrice,
+			ClosePrice: big.NewDecimal(price),
+			MaxPrice:   big.NewDecimal(high),
+			MinPrice:   big.NewDecimal(low),
+			Volume:     candle.Volume.Mul(big.NewDecimal(fraction)),
+			TradeCount: uint(float64(candle.TradeCount) * fraction),
+		})
+	}
+	return append(candles, candle)
+}
+
+// walk returns the price after moving distance along path and the highest and lowest prices on the way.
+func walk(path []float64, distance float64) (price, high, low float64) {
+	price, high, low = path[0], path[0], path[0]
+	for i := 1; i < len(path); i++ {
+		step := math.Abs(path[i] - path[i-1])
+		if distance <= step {
+			if step > 0 {
+				price += (path[i] - path[i-1]) * distance / step
+			}
+			return price, math.Max(high, price), math.Min(low, price)
+		}
+		distance -= step
+		price = path[i]
+		high, low = math.Max(high, price), math.Min(low, price)
+	}
+	return price, high, low
+}
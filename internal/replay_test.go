@@ -0,0 +1,41 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/MShoaei/techan"
+	"github.com/sdcoffey/big"
+)
+
+func TestPartialCandles(t *testing.T) {
+	candle := techan.NewCandle(techan.NewTimePeriod(time.Unix(0, 0), time.Minute))
+	candle.OpenPrice = big.NewDecimal(100)
+	candle.MinPrice = big.NewDecimal(90)
+	candle.MaxPrice = big.NewDecimal(120)
+	candle.ClosePrice = big.NewDecimal(110)
+	candle.Volume = big.NewDecimal(10)
+
+	// the path is 100 -> 90 -> 120 -> 110, 50 long and walked 12.5 at a time.
+	expect := []struct{ close, high, low float64 }{
+		{92.5, 100, 90},
+		{105, 105, 90},
+		{117.5, 117.5, 90},
+		{110, 120, 90},
+	}
+	candles := PartialCandles(candle, 3)
+	if len(candles) != len(expect) {
+		t.Fatalf("expected %d candles, got %d", len(expect), len(candles))
+	}
+	if candles[3] != candle {
+		t.Errorf("expected the last candle to be the final one")
+	}
+	for i, c := range candles {
+		if c.ClosePrice.Float() != expect[i].close || c.MaxPrice.Float() != expect[i].high || c.MinPrice.Float() != expect[i].low {
+			t.Errorf("candle %d: expected %+v, got close %s high %s low %s", i, expect[i], c.ClosePrice, c.MaxPrice, c.MinPrice)
+		}
+	}
+	if candles[0].Volume.Float() != 2.5 {
+		t.Errorf("expected the volume to grow with the candle, got %s", candles[0].Volume)
+	}
+}
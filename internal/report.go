@@ -0,0 +1,343 @@
+package internal
+
+import (
+	"fmt"
+	"html"
+	"html/template"
+	"io"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/MShoaei/techan"
+)
+
+// Overlay is an indicator drawn as a line over the candles of an HTMLReport.
+type Overlay struct {
+	Name      string
+	Color     string
+	Indicator techan.Indicator
+}
+
+// Cloud is the area between two indicators, drawn green where A is above B and red otherwise like the Ichimoku cloud.
+type Cloud struct {
+	Name string
+	A, B techan.Indicator
+}
+
+// NewIchimokuCloud returns the cloud between the leading spans of the Ichimoku indicator using the parameters of
+// NewIchimokuStrategy. the spans are displaced forward, so the cloud of a candle is calculated on an earlier one.
+func NewIchimokuCloud(series *techan.TimeSeries, p Params) Cloud {
+	p = IchimokuDefaults.With(p)
+	conv := NewConversionLineIndicator(series, p.Int("conversion"))
+	base := NewBaseLineIndicator(series, p.Int("base"))
+	spanA := NewLeadingSpanAIndicator(conv.(conversionLineIndicator), base.(baseLineIndicator))
+	spanB := NewLeadingSpanBIndicator(series, p.Int("span_b"))
+	return Cloud{
+		Name: "Ichimoku cloud",
+		A:    NewDispositionIndicator(spanA, -p.Int("displacement")),
+		B:    NewDispositionIndicator(spanB, -p.Int("displacement")),
+	}
+}
+
+// HTMLReport renders a backtest as a single html file which needs no network access to be viewed.
+type HTMLReport struct {
+	Title    string
+	Series   *techan.TimeSeries
+	Record   *techan.TradingRecord
+	Fees     FeeModel
+	Overlays []Overlay
+	Clouds   []Cloud
+}
+
+// ReportMetric is a row of the metrics table of an HTMLReport.
+type ReportMetric struct {
+	Name  string
+	Value string
+}
+
+const (
+	reportCandleWidth  = 6
+	reportPriceHeight  = 420
+	reportEquityHeight = 180
+	reportMargin       = 60
+)
+
+var reportTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 20px; color: #222; }
+.chart { overflow-x: auto; border: 1px solid #ddd; margin-bottom: 20px; }
+table { border-collapse: collapse; margin-bottom: 20px; }
+td, th { border: 1px solid #ddd; padding: 4px 10px; text-align: right; }
+th { background: #f4f4f4; }
+td:first-child { text-align: left; }
+.legend span { margin-right: 16px; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<div class="legend">{{range .Overlays}}<span style="color: {{.Color}}">&#9644; {{.Name}}</span>{{end}}{{range .Clouds}}<span style="color: #4caf50">&#9632; {{.Name}}</span>{{end}}</div>
+<div class="chart">{{.Price}}</div>
+<h2>Equity</h2>
+<div class="chart">{{.Equity}}</div>
+<h2>Metrics</h2>
+<table>
+{{range .Metrics}}<tr><td>{{.Name}}</td><td>{{.Value}}</td></tr>
+{{end}}</table>
+<h2>Trades</h2>
+<table>
+<tr><th>Side</th><th>Entry time</th><th>Entry price</th><th>Exit time</th><th>Exit price</th><th>Amount</th><th>Net profit</th></tr>
+{{range .Trades}}<tr>{{range .}}<td>{{.}}</td>{{end}}</tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// Write writes the report to w.
+func (r HTMLReport) Write(w io.Writer) error {
+	data := struct {
+		Title    string
+		Overlays []Overlay
+		Clouds   []Cloud
+		Price    template.HTML
+		Equity   template.HTML
+		Metrics  []ReportMetric
+		Trades   [][]string
+	}{
+		Title:    r.Title,
+		Overlays: r.Overlays,
+		Clouds:   r.Clouds,
+		Price:    template.HTML(r.priceChart()),
+		Equity:   template.HTML(r.equityChart()),
+		Metrics:  r.Metrics(),
+		Trades:   r.trades(),
+	}
+	return reportTemplate.Execute(w, data)
+}
+
+// Metrics returns the results of the analyses of the record.
+func (r HTMLReport) Metrics() []ReportMetric {
+	record := r.Record
+	trades := techan.NumTradesAnalysis{}.Analyze(record)
+	profitable := ProfitableTradesAnalysis{Fees: r.Fees}.Analyze(record)
+	winRate := 0.0
+	if trades > 0 {
+		winRate = profitable / trades * 100
+	}
+	var lastCandle *techan.Candle
+	if len(r.Series.Candles) > 0 {
+		lastCandle = r.Series.LastCandle()
+	}
+	openPL := 0.0
+	if lastCandle != nil {
+		openPL = OpenPLAnalysis{LastCandle: lastCandle, Fees: r.Fees}.Analyze(record)
+	}
+	f := func(v float64) string { return fmt.Sprintf("%.4f", v) }
+	return []ReportMetric{
+		{"Total profit", f(techan.TotalProfitAnalysis{}.Analyze(record))},
+		{"Commission", f(CommissionAnalysis{Fees: r.Fees}.Analyze(record))},
+		{"Funding", f(FundingAnalysis{Fees: r.Fees}.Analyze(record))},
+		{"Net profit", f(TotalProfitAnalysis{Fees: r.Fees}.Analyze(record))},
+		{"PNL", f(openPL)},
+		{"Max drawdown", f(MaxDrawdownAnalysis{Fees: r.Fees}.Analyze(record))},
+		{"Total trades", fmt.Sprint(int(trades))},
+		{"Profitable trades", fmt.Sprint(int(profitable))},
+		{"Win rate", f(winRate) + "%"},
+		{"Win streak", fmt.Sprint(int(WinStreakAnalysis{Fees: r.Fees}.Analyze(record)))},
+		{"Lose streak", fmt.Sprint(int(LoseStreakAnalysis{Fees: r.Fees}.Analyze(record)))},
+		{"Max win", f(MaxWinAnalysis{Fees: r.Fees}.Analyze(record))},
+		{"Max loss", f(MaxLossAnalysis{Fees: r.Fees}.Analyze(record))},
+		{"Average win", f(AverageWinAnalysis{Fees: r.Fees}.Analyze(record))},
+		{"Average loss", f(AverageLossAnalysis{Fees: r.Fees}.Analyze(record))},
+	}
+}
+
+func (r HTMLReport) trades() [][]string {
+	rows := make([][]string, 0, len(r.Record.Trades))
+	for _, trade := range r.Record.Trades {
+		side := "long"
+		if trade.IsShort() {
+			side = "short"
+		}
+		rows = append(rows, []string{
+			side,
+			trade.EntranceOrder().ExecutionTime.UTC().Format(time.RFC822),
+			trade.EntranceOrder().Price.String(),
+			trade.ExitOrder().ExecutionTime.UTC().Format(time.RFC822),
+			trade.ExitOrder().Price.String(),
+			trade.EntranceOrder().Amount.String(),
+			fmt.Sprintf("%.4f", r.Fees.NetProfit(trade).Float()),
+		})
+	}
+	return rows
+}
+
+// chartWidth returns the width of the plot area of the charts.
+func (r HTMLReport) chartWidth() float64 {
+	return math.Max(800, float64(len(r.Series.Candles)*reportCandleWidth))
+}
+
+// x returns the horizontal center of the candle at index.
+func (r HTMLReport) x(index int) float64 {
+	return reportMargin + (float64(index)+0.5)*r.chartWidth()/math.Max(1, float64(len(r.Series.Candles)))
+}
+
+// candleIndex returns the index of the candle during which t happened.
+func (r HTMLReport) candleIndex(t time.Time) int {
+	candles := r.Series.Candles
+	i := sort.Search(len(candles), func(i int) bool { return !candles[i].Period.End.Before(t) })
+	if i == len(candles) {
+		return len(candles) - 1
+	}
+	return i
+}
+
+func (r HTMLReport) priceChart() string {
+	candles := r.Series.Candles
+	if len(candles) == 0 {
+		return ""
+	}
+	low, high := math.Inf(1), math.Inf(-1)
+	for _, candle := range candles {
+		low = math.Min(low, candle.MinPrice.Float())
+		high = math.Max(high, candle.MaxPrice.Float())
+	}
+	y := scale(low, high, reportPriceHeight)
+	step := r.chartWidth() / float64(len(candles))
+	body := math.Max(1, step*0.6)
+
+	var b strings.Builder
+	r.svgStart(&b, reportPriceHeight)
+	fmt.Fprintf(&b, `<defs><clipPath id="plot"><rect x="%d" y="0" width="%.0f" height="%d"/></clipPath></defs>`,
+		reportMargin, r.chartWidth(), reportPriceHeight+20)
+	axis(&b, low, high, y, r.chartWidth())
+	b.WriteString(`<g clip-path="url(#plot)">`)
+	for _, cloud := range r.Clouds {
+		for i := 1; i < len(candles); i++ {
+			a0, b0 := cloud.A.Calculate(i-1).Float(), cloud.B.Calculate(i-1).Float()
+			a1, b1 := cloud.A.Calculate(i).Float(), cloud.B.Calculate(i).Float()
+			if a0 == 0 || b0 == 0 || a1 == 0 || b1 == 0 {
+				continue
+			}
+			color := "#4caf50"
+			if a1 < b1 {
+				color = "#f44336"
+			}
+			fmt.Fprintf(&b, `<polygon points="%.1f,%.1f %.1f,%.1f %.1f,%.1f %.1f,%.1f" fill="%s" fill-opacity="0.2"/>`,
+				r.x(i-1), y(a0), r.x(i), y(a1), r.x(i), y(b1), r.x(i-1), y(b0), color)
+		}
+	}
+	for i, candle := range candles {
+		color := "#26a69a"
+		if candle.ClosePrice.LT(candle.OpenPrice) {
+			color = "#ef5350"
+		}
+		open, close := y(candle.OpenPrice.Float()), y(candle.ClosePrice.Float())
+		fmt.Fprintf(&b, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="%s"/>`,
+			r.x(i), y(candle.MaxPrice.Float()), r.x(i), y(candle.MinPrice.Float()), color)
+		fmt.Fprintf(&b, `<rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%s"/>`,
+			r.x(i)-body/2, math.Min(open, close), body, math.Max(1, math.Abs(open-close)), color)
+	}
+	for _, overlay := range r.Overlays {
+		values := make([]float64, len(candles))
+		for i := range candles {
+			values[i] = overlay.Indicator.Calculate(i).Float()
+		}
+		b.WriteString(r.path(values, y, overlay.Color))
+	}
+	for _, trade := range append(r.Record.Trades[:len(r.Record.Trades):len(r.Record.Trades)], r.Record.CurrentPosition()) {
+		if trade.IsNew() {
+			continue
+		}
+		entrance := trade.EntranceOrder()
+		ex, ey := r.x(r.candleIndex(entrance.ExecutionTime)), y(entrance.Price.Float())
+		if trade.IsShort() {
+			fmt.Fprintf(&b, `<polygon points="%.1f,%.1f %.1f,%.1f %.1f,%.1f" fill="#d50000"><title>short %s @ %s</title></polygon>`,
+				ex, ey, ex-5, ey-9, ex+5, ey-9, entrance.Amount, entrance.Price)
+		} else {
+			fmt.Fprintf(&b, `<polygon points="%.1f,%.1f %.1f,%.1f %.1f,%.1f" fill="#00c853"><title>long %s @ %s</title></polygon>`,
+				ex, ey, ex-5, ey+9, ex+5, ey+9, entrance.Amount, entrance.Price)
+		}
+		if !trade.IsClosed() {
+			continue
+		}
+		exit := trade.ExitOrder()
+		xx, xy := r.x(r.candleIndex(exit.ExecutionTime)), y(exit.Price.Float())
+		fmt.Fprintf(&b, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="#555" stroke-dasharray="3,3"/>`, ex, ey, xx, xy)
+		fmt.Fprintf(&b, `<circle cx="%.1f" cy="%.1f" r="4" fill="#fff" stroke="#000"><title>exit %s @ %s, net profit %.4f</title></circle>`,
+			xx, xy, exit.Amount, exit.Price, r.Fees.NetProfit(trade).Float())
+	}
+	b.WriteString(`</g></svg>`)
+	return b.String()
+}
+
+func (r HTMLReport) equityChart() string {
+	points := EquityCurve(r.Series, r.Record, r.Fees)
+	if len(points) == 0 {
+		return ""
+	}
+	equity := make([]float64, len(points))
+	low, high := 0.0, 0.0
+	for i, point := range points {
+		equity[i] = point.Equity
+		low = math.Min(low, point.Equity)
+		high = math.Max(high, point.Equity)
+	}
+	y := scale(low, high, reportEquityHeight)
+
+	var b strings.Builder
+	r.svgStart(&b, reportEquityHeight)
+	axis(&b, low, high, y, r.chartWidth())
+	fmt.Fprintf(&b, `<line x1="%d" y1="%.1f" x2="%.1f" y2="%.1f" stroke="#999"/>`, reportMargin, y(0), reportMargin+r.chartWidth(), y(0))
+	b.WriteString(r.path(equity, y, "#1e88e5"))
+	b.WriteString(`</svg>`)
+	return b.String()
+}
+
+func (r HTMLReport) svgStart(b *strings.Builder, height float64) {
+	width := r.chartWidth()
+	fmt.Fprintf(b, `<svg xmlns="http://www.w3.org/2000/svg" width="%.0f" height="%.0f">`, width+2*reportMargin, height+40)
+}
+
+// path returns an svg path through values. zero values are skipped since indicators return zero while unstable.
+func (r HTMLReport) path(values []float64, y func(float64) float64, color string) string {
+	var d strings.Builder
+	move := true
+	for i, v := range values {
+		if v == 0 || math.IsNaN(v) || math.IsInf(v, 0) {
+			move = true
+			continue
+		}
+		command := "L"
+		if move {
+			command = "M"
+			move = false
+		}
+		fmt.Fprintf(&d, "%s%.1f,%.1f", command, r.x(i), y(v))
+	}
+	return fmt.Sprintf(`<path d="%s" fill="none" stroke="%s" stroke-width="1.2"/>`, d.String(), html.EscapeString(color))
+}
+
+// scale returns a function mapping values between low and high to the vertical coordinate of a chart.
+func scale(low, high, height float64) func(float64) float64 {
+	if high == low {
+		high, low = high+1, low-1
+	}
+	return func(v float64) float64 {
+		return 10 + (high-v)/(high-low)*height
+	}
+}
+
+// axis draws horizontal grid lines labeled with their value.
+func axis(b *strings.Builder, low, high float64, y func(float64) float64, width float64) {
+	for i := 0; i <= 4; i++ {
+		v := low + (high-low)*float64(i)/4
+		fmt.Fprintf(b, `<line x1="%d" y1="%.1f" x2="%.1f" y2="%.1f" stroke="#eee"/>`, reportMargin, y(v), reportMargin+width, y(v))
+		fmt.Fprintf(b, `<text x="%d" y="%.1f" font-size="10" text-anchor="end">%.2f</text>`, reportMargin-4, y(v)+3, v)
+	}
+}
@@ -0,0 +1,98 @@
+package internal
+
+import (
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MShoaei/techan"
+	"github.com/sdcoffey/big"
+)
+
+func TestHTMLReport_Metrics(t *testing.T) {
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	series := techan.NewTimeSeries()
+	for i, price := range []float64{100, 110, 120} {
+		candle := newTestCandle(price, price, price, price)
+		candle.Period = techan.NewTimePeriod(start.Add(time.Duration(i)*time.Minute), time.Minute)
+		series.AddCandle(candle)
+	}
+	record := techan.NewTradingRecord()
+	record.Operate(techan.Order{Side: techan.BUY, Price: big.NewDecimal(100), Amount: big.ONE, ExecutionTime: start})
+	record.Operate(techan.Order{Side: techan.SELL, Price: big.NewDecimal(110), Amount: big.ONE, ExecutionTime: start.Add(time.Minute)})
+	r := HTMLReport{Title: "test", Series: series, Record: record}
+
+	metrics := make(map[string]string)
+	for _, m := range r.Metrics() {
+		metrics[m.Name] = m.Value
+	}
+	if metrics["Net profit"] != "10.0000" || metrics["Total trades"] != "1" || metrics["Win rate"] != "100.0000%" {
+		t.Errorf("unexpected metrics %v", metrics)
+	}
+
+	trades := r.trades()
+	if len(trades) != 1 {
+		t.Fatalf("expected 1 trade row, got %d", len(trades))
+	}
+	if row := trades[0]; row[0] != "long" || row[2] != "100" || row[4] != "110" || row[5] != "1" || row[6] != "10.0000" {
+		t.Errorf("unexpected trade row %v", row)
+	}
+	checkWellFormed(t, r)
+}
+
+func TestHTMLReport_WriteEmpty(t *testing.T) {
+	r := HTMLReport{Title: "empty", Series: techan.NewTimeSeries(), Record: techan.NewTradingRecord()}
+	if len(r.trades()) != 0 {
+		t.Errorf("expected no trade rows")
+	}
+	for _, m := range r.Metrics() {
+		if m.Name == "Total trades" && m.Value != "0" {
+			t.Errorf("expected 0 trades, got %s", m.Value)
+		}
+	}
+	checkWellFormed(t, r)
+}
+
+// checkWellFormed fails t if the output of r does not close every element it opens.
+func checkWellFormed(t *testing.T, r HTMLReport) {
+	t.Helper()
+	var b bytes.Buffer
+	if err := r.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	void := make(map[string]bool)
+	for _, name := range xml.HTMLAutoClose {
+		void[name] = true
+	}
+	// raw tokens are used since the decoder closes mismatched elements itself otherwise.
+	d := xml.NewDecoder(strings.NewReader(b.String()))
+	d.Strict = false
+	d.Entity = xml.HTMLEntity
+	var open []string
+	for {
+		token, err := d.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("invalid report: %v", err)
+		}
+		switch token := token.(type) {
+		case xml.StartElement:
+			if !void[token.Name.Local] {
+				open = append(open, token.Name.Local)
+			}
+		case xml.EndElement:
+			if len(open) == 0 || open[len(open)-1] != token.Name.Local {
+				t.Fatalf("unexpected </%s> with open elements %v", token.Name.Local, open)
+			}
+			open = open[:len(open)-1]
+		}
+	}
+	if len(open) != 0 {
+		t.Errorf("unclosed elements %v", open)
+	}
+}
@@ -0,0 +1,266 @@
+package internal
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/MShoaei/techan"
+)
+
+// Run is a backtest kept in a RunStore.
+type Run struct {
+	ID       string    `json:"id"`
+	Time     time.Time `json:"time"`
+	Strategy string    `json:"strategy"`
+	Symbol   string    `json:"symbol"`
+	// Params are the values of the flags of the backtest by name.
+	Params map[string]string `json:"params"`
+	Data   RunData           `json:"data"`
+	Fees   RunFees           `json:"fees"`
+	// Metrics are the metrics of all the trades of the backtest.
+	Metrics Metrics    `json:"metrics"`
+	Trades  []RunTrade `json:"trades"`
+}
+
+// RunData identifies the klines a run was backtested on.
+type RunData struct {
+	Path   string `json:"path"`
+	SHA256 string `json:"sha256"`
+}
+
+// RunFees describes the fee model of a run.
+type RunFees struct {
+	Maker       float64 `json:"maker"`
+	Taker       float64 `json:"taker"`
+	BNBDiscount float64 `json:"bnbDiscount"`
+	Liquidity   string  `json:"liquidity"`
+	// FundingRates is the number of funding rates charged on open positions.
+	FundingRates int `json:"fundingRates"`
+}
+
+// RunTrade is a closed trade of a run.
+type RunTrade struct {
+	Side       string    `json:"side"`
+	EntryTime  time.Time `json:"entryTime"`
+	EntryPrice float64   `json:"entryPrice"`
+	ExitTime   time.Time `json:"exitTime"`
+	ExitPrice  float64   `json:"exitPrice"`
+	Amount     float64   `json:"amount"`
+	NetProfit  float64   `json:"netProfit"`
+}
+
+// key identifies the trade among the trades of another run of the same data.
+func (t RunTrade) key() string {
+	return fmt.Sprintf("%s %d %d", t.Side, t.EntryTime.UnixNano(), t.ExitTime.UnixNano())
+}
+
+// NewRun returns the run of the backtest of strategy on symbol which made record paying fees.
+func NewRun(strategy string, symbol string, params map[string]string, data RunData, record *techan.TradingRecord, fees FeeModel) Run {
+	liquidity := "taker"
+	switch {
+	case fees.Journal != nil:
+		liquidity = "per order"
+	case fees.Liquidity == Maker:
+		liquidity = "maker"
+	}
+	run := Run{
+		Time:     time.Now().UTC(),
+		Strategy: strategy,
+		Symbol:   symbol,
+		Params:   params,
+		Data:     data,
+		Fees: RunFees{
+			Maker:        fees.Maker,
+			Taker:        fees.Taker,
+			BNBDiscount:  fees.BNBDiscount,
+			Liquidity:    liquidity,
+			FundingRates: len(fees.Funding),
+		},
+		Metrics: NewMetrics(record, fees),
+		Trades:  make([]RunTrade, 0, len(record.Trades)),
+	}
+	for _, trade := range record.Trades {
+		if !trade.IsClosed() {
+			continue
+		}
+		entry, exit := trade.EntranceOrder(), trade.ExitOrder()
+		run.Trades = append(run.Trades, RunTrade{
+			Side:       sideName(entry.Side),
+			EntryTime:  entry.ExecutionTime.UTC(),
+			EntryPrice: entry.Price.Float(),
+			ExitTime:   exit.ExecutionTime.UTC(),
+			ExitPrice:  exit.Price.Float(),
+			Amount:     entry.Amount.Float(),
+			NetProfit:  fees.NetProfit(trade).Float(),
+		})
+	}
+	return run
+}
+
+// HashData returns the data of the klines stored at path.
+func HashData(path string) (RunData, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return RunData{}, err
+	}
+	defer file.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, file); err != nil {
+		return RunData{}, err
+	}
+	return RunData{Path: path, SHA256: hex.EncodeToString(h.Sum(nil))}, nil
+}
+
+// RunStore keeps runs as json files in Dir.
+type RunStore struct {
+	Dir string
+}
+
+// Save stores run and sets its ID, which is the time of the run.
+func (s RunStore) Save(run *Run) error {
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return err
+	}
+	id := run.Time.UTC().Format("20060102-150405")
+	run.ID = id
+	for n := 2; ; n++ {
+		if _, err := os.Stat(s.path(run.ID)); os.IsNotExist(err) {
+			break
+		}
+		run.ID = fmt.Sprintf("%s-%d", id, n)
+	}
+	b, err := json.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(s.path(run.ID), b, 0644)
+}
+
+// List returns every stored run from the oldest to the newest.
+func (s RunStore) List() ([]Run, error) {
+	paths, err := filepath.Glob(filepath.Join(s.Dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	runs := make([]Run, 0, len(paths))
+	for _, path := range paths {
+		run, err := s.read(path)
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	sort.SliceStable(runs, func(i, j int) bool { return runs[i].Time.Before(runs[j].Time) })
+	return runs, nil
+}
+
+// Load returns the run with id, or the only run whose ID starts with it.
+func (s RunStore) Load(id string) (Run, error) {
+	if _, err := os.Stat(s.path(id)); err == nil {
+		return s.read(s.path(id))
+	}
+	paths, err := filepath.Glob(filepath.Join(s.Dir, "*.json"))
+	if err != nil {
+		return Run{}, err
+	}
+	var matches []string
+	for _, path := range paths {
+		if strings.HasPrefix(filepath.Base(path), id) {
+			matches = append(matches, path)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return Run{}, fmt.Errorf("run %s not found", id)
+	case 1:
+		return s.read(matches[0])
+	}
+	return Run{}, fmt.Errorf("run %s is ambiguous. it matches %d runs", id, len(matches))
+}
+
+func (s RunStore) path(id string) string {
+	return filepath.Join(s.Dir, id+".json")
+}
+
+func (s RunStore) read(path string) (Run, error) {
+	var run Run
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return run, err
+	}
+	if err := json.Unmarshal(b, &run); err != nil {
+		return run, fmt.Errorf("%s: %v", path, err)
+	}
+	return run, nil
+}
+
+// ParamChange is a parameter which differs between two runs. A missing parameter is empty.
+type ParamChange struct {
+	Name string
+	A, B string
+}
+
+// RunDiff compares two runs.
+type RunDiff struct {
+	A, B Run
+	// Params are the parameters which differ, sorted by name.
+	Params []ParamChange
+	// SameData reports if both runs were backtested on the same klines.
+	SameData bool
+	// OnlyA and OnlyB are the trades which only one of the runs made. Common is the number of trades both made.
+	OnlyA, OnlyB []RunTrade
+	Common       int
+}
+
+// DiffRuns compares run a with run b. Trades are matched by their side and their entry and exit times.
+func DiffRuns(a, b Run) RunDiff {
+	d := RunDiff{A: a, B: b, SameData: a.Data.SHA256 == b.Data.SHA256}
+
+	names := make(map[string]bool)
+	for name := range a.Params {
+		names[name] = true
+	}
+	for name := range b.Params {
+		names[name] = true
+	}
+	for name := range names {
+		if a.Params[name] != b.Params[name] {
+			d.Params = append(d.Params, ParamChange{Name: name, A: a.Params[name], B: b.Params[name]})
+		}
+	}
+	sort.Slice(d.Params, func(i, j int) bool { return d.Params[i].Name < d.Params[j].Name })
+
+	inB := make(map[string]int, len(b.Trades))
+	for _, trade := range b.Trades {
+		inB[trade.key()]++
+	}
+	for _, trade := range a.Trades {
+		if inB[trade.key()] > 0 {
+			inB[trade.key()]--
+			d.Common++
+			continue
+		}
+		d.OnlyA = append(d.OnlyA, trade)
+	}
+	inA := make(map[string]int, len(a.Trades))
+	for _, trade := range a.Trades {
+		inA[trade.key()]++
+	}
+	for _, trade := range b.Trades {
+		if inA[trade.key()] > 0 {
+			inA[trade.key()]--
+			continue
+		}
+		d.OnlyB = append(d.OnlyB, trade)
+	}
+	return d
+}
@@ -0,0 +1,72 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/MShoaei/techan"
+	"github.com/sdcoffey/big"
+)
+
+func TestRunStore(t *testing.T) {
+	start := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	trade := func(record *techan.TradingRecord, side techan.OrderSide, entry, exit int, exitPrice float64) {
+		exitSide := techan.SELL
+		if side == techan.SELL {
+			exitSide = techan.BUY
+		}
+		record.Operate(techan.Order{Side: side, Price: big.NewDecimal(100), Amount: big.ONE, ExecutionTime: start.Add(time.Duration(entry) * time.Hour)})
+		record.Operate(techan.Order{Side: exitSide, Price: big.NewDecimal(exitPrice), Amount: big.ONE, ExecutionTime: start.Add(time.Duration(exit) * time.Hour)})
+	}
+	a, b := techan.NewTradingRecord(), techan.NewTradingRecord()
+	trade(a, techan.BUY, 0, 1, 110)
+	trade(a, techan.SELL, 2, 3, 90)
+	trade(b, techan.BUY, 0, 1, 110)
+	trade(b, techan.BUY, 4, 5, 105)
+
+	data := RunData{Path: "klines.json", SHA256: "abc"}
+	store := RunStore{Dir: t.TempDir()}
+	runA := NewRun("ema", "ETHUSDT", map[string]string{"sl": "0", "tp": "0"}, data, a, FlatFee(0))
+	runB := NewRun("ema", "ETHUSDT", map[string]string{"sl": "2", "tp": "0"}, data, b, FlatFee(0))
+	runB.Time = runA.Time
+	for _, run := range []*Run{&runA, &runB} {
+		if err := store.Save(run); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if runA.ID == runB.ID {
+		t.Fatalf("expected runs saved at the same time to have different IDs, got %s", runA.ID)
+	}
+
+	runs, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 {
+		t.Fatalf("expected 2 runs, got %d", len(runs))
+	}
+	loaded, err := store.Load(runB.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.Metrics != runB.Metrics || len(loaded.Trades) != 2 {
+		t.Errorf("expected the loaded run to equal the saved one, got %+v", loaded)
+	}
+	if _, err := store.Load(runA.ID[:8]); err == nil {
+		t.Error("expected an ambiguous prefix to fail")
+	}
+
+	d := DiffRuns(runA, loaded)
+	if !d.SameData {
+		t.Error("expected the runs to use the same data")
+	}
+	if len(d.Params) != 1 || d.Params[0] != (ParamChange{Name: "sl", A: "0", B: "2"}) {
+		t.Errorf("expected only sl to change, got %+v", d.Params)
+	}
+	if d.Common != 1 || len(d.OnlyA) != 1 || len(d.OnlyB) != 1 {
+		t.Fatalf("expected 1 common trade and 1 trade only in each run, got %d, %d and %d", d.Common, len(d.OnlyA), len(d.OnlyB))
+	}
+	if d.OnlyA[0].Side != "short" || d.OnlyB[0].NetProfit != 5 {
+		t.Errorf("unexpected trades %+v and %+v", d.OnlyA[0], d.OnlyB[0])
+	}
+}
@@ -0,0 +1,150 @@
+package internal
+
+import (
+	"fmt"
+
+	"github.com/MShoaei/techan"
+	"github.com/sdcoffey/big"
+)
+
+// Target is a partial take profit of a position. It closes Percent percent of the amount entered when the price
+// moves R times the stop loss distance of the position in its favor, or Gain percent of its average entry price
+// if R is not set.
+type Target struct {
+	R       float64
+	Gain    float64
+	Percent float64
+}
+
+// Scaling describes how positions are scaled in and out. The zero value enters and exits positions at once.
+type Scaling struct {
+	// Entries is the maximum number of entries of a position. Entry signals of the side of an open position add to
+	// it until it is reached.
+	Entries int
+	// Targets are the partial take profits of a position in the order they are taken. R targets need a stop loss.
+	Targets []Target
+	// TrailATR trails the stop loss of the rest of a position TrailATR times the ATR behind the close once its
+	// first target is taken.
+	TrailATR float64
+}
+
+// Validate reports if the targets can not be taken by positions which have a stop loss only if hasStop is true.
+func (s Scaling) Validate(hasStop bool) error {
+	for _, target := range s.Targets {
+		if target.R > 0 && !hasStop {
+			return fmt.Errorf("the %vR target needs a stop loss", target.R)
+		}
+	}
+	return nil
+}
+
+// ScaleIn adds order to the open position of record. The position keeps the time of its first entry and is
+// entered at the average price of its entries.
+func ScaleIn(record *techan.TradingRecord, order techan.Order) {
+	position := record.CurrentPosition()
+	entry := *position.EntranceOrder()
+	amount := entry.Amount.Add(order.Amount)
+	entry.Price = entry.Price.Mul(entry.Amount).Add(order.Price.Mul(order.Amount)).Div(amount)
+	entry.Amount = amount
+	position.Enter(entry)
+}
+
+// PartialExit closes the amount of order of the open position of record. The closed part is added to the trades
+// of record as a trade of its own entered at the average entry price and the rest stays open. The position is
+// closed if order is worth all of it.
+func PartialExit(record *techan.TradingRecord, order techan.Order) {
+	position := record.CurrentPosition()
+	entry := *position.EntranceOrder()
+	if order.Amount.GTE(entry.Amount) {
+		order.Amount = entry.Amount
+		record.Operate(order)
+		return
+	}
+
+	leg := entry
+	leg.Amount = order.Amount
+	trade := techan.NewPosition(leg, big.ZERO, big.ZERO)
+	trade.Exit(order)
+	record.Trades = append(record.Trades, trade)
+
+	entry.Amount = entry.Amount.Sub(order.Amount)
+	position.Enter(entry)
+}
+
+// scaleState is the scaling of the open position of a record.
+type scaleState struct {
+	entries int
+	entered big.Decimal
+	// risk is the stop loss distance of the first entry. it is zero without a stop loss.
+	risk big.Decimal
+	// taken is the number of targets taken.
+	taken int
+}
+
+// operate adds order to record, scaling the open position in or out, and reports if it opened a new position.
+func (st *scaleState) operate(record *techan.TradingRecord, order techan.Order) bool {
+	position := record.CurrentPosition()
+	switch {
+	case position.IsOpen() && order.Side == position.EntranceOrder().Side:
+		ScaleIn(record, order)
+		st.entries++
+		st.entered = st.entered.Add(order.Amount)
+		return false
+	case position.IsOpen():
+		PartialExit(record, order)
+		return false
+	}
+	record.Operate(order)
+	*st = scaleState{entries: 1, entered: order.Amount, risk: big.ZERO}
+	return record.CurrentPosition().IsOpen()
+}
+
+// canAdd reports if the entry rule of rs calls for adding to the open position of record.
+func (s Scaling) canAdd(st *scaleState, rs techan.RuleStrategy, index int, record *techan.TradingRecord) bool {
+	return st.entries < s.Entries && index > rs.UnstablePeriod && rs.EntryRule.IsSatisfied(index, record)
+}
+
+// nextTarget returns the price of the next target of the open position of record and the amount it closes.
+func (s Scaling) nextTarget(st *scaleState, record *techan.TradingRecord) (level, amount big.Decimal, ok bool) {
+	if st.taken >= len(s.Targets) {
+		return big.ZERO, big.ZERO, false
+	}
+	target := s.Targets[st.taken]
+	entry := record.CurrentPosition().EntranceOrder()
+	distance := big.ZERO
+	switch {
+	case target.R > 0:
+		distance = st.risk.Mul(big.NewDecimal(target.R))
+	case target.Gain > 0:
+		distance = entry.Price.Mul(big.NewDecimal(target.Gain * 0.01))
+	}
+	if distance.Zero() {
+		return big.ZERO, big.ZERO, false
+	}
+	level = entry.Price.Add(distance)
+	if entry.Side == techan.SELL {
+		level = entry.Price.Sub(distance)
+	}
+	return level, st.entered.Mul(big.NewDecimal(target.Percent * 0.01)), true
+}
+
+// trailStop moves the trailing stop of the open position of side behind close once a target is taken and
+// returns it. It returns stop if the position is not trailed.
+func (s Scaling) trailStop(st *scaleState, side techan.OrderSide, close, atr, stop big.Decimal) big.Decimal {
+	if s.TrailATR <= 0 || st.taken == 0 || atr.NaN() {
+		return stop
+	}
+	distance := atr.Mul(big.NewDecimal(s.TrailATR))
+	if side == techan.BUY {
+		level := close.Sub(distance)
+		if stop.Zero() || level.GT(stop) {
+			return level
+		}
+		return stop
+	}
+	level := close.Add(distance)
+	if stop.Zero() || level.LT(stop) {
+		return level
+	}
+	return stop
+}
@@ -0,0 +1,86 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/MShoaei/techan"
+	"github.com/sdcoffey/big"
+)
+
+func TestScaleInPartialExit(t *testing.T) {
+	at := func(minute int) time.Time { return time.Unix(int64(minute*60), 0) }
+	record := techan.NewTradingRecord()
+	record.Operate(techan.Order{Side: techan.BUY, Price: big.NewDecimal(100), Amount: big.NewDecimal(1), ExecutionTime: at(0)})
+	ScaleIn(record, techan.Order{Side: techan.BUY, Price: big.NewDecimal(130), Amount: big.NewDecimal(2), ExecutionTime: at(1)})
+
+	entry := record.CurrentPosition().EntranceOrder()
+	if entry.Price.Float() != 120 || entry.Amount.Float() != 3 || !entry.ExecutionTime.Equal(at(0)) {
+		t.Fatalf("expected 3 entered at 120 at the first entry, got %s at %s at %v", entry.Amount, entry.Price, entry.ExecutionTime)
+	}
+
+	PartialExit(record, techan.Order{Side: techan.SELL, Price: big.NewDecimal(140), Amount: big.NewDecimal(1), ExecutionTime: at(2)})
+	if !record.CurrentPosition().IsOpen() || record.CurrentPosition().EntranceOrder().Amount.Float() != 2 {
+		t.Fatalf("expected 2 to stay open")
+	}
+	// the last exit is worth more than the rest and only closes it.
+	PartialExit(record, techan.Order{Side: techan.SELL, Price: big.NewDecimal(110), Amount: big.NewDecimal(3), ExecutionTime: at(3)})
+	if !record.CurrentPosition().IsNew() {
+		t.Fatalf("expected the position to be closed")
+	}
+
+	expect := []float64{20, -20}
+	if len(record.Trades) != len(expect) {
+		t.Fatalf("expected %d trades, got %d", len(expect), len(record.Trades))
+	}
+	for i, trade := range record.Trades {
+		if profit := grossProfit(trade).Float(); profit != expect[i] {
+			t.Errorf("trade %d: expected profit %f, got %f", i, expect[i], profit)
+		}
+	}
+}
+
+func TestBacktest_Targets(t *testing.T) {
+	var candles []*techan.Candle
+	for i, c := range [][4]float64{{100, 100, 100, 100}, {100, 100, 100, 100}, {100, 106, 99, 104}, {104, 104, 90, 92}} {
+		candle := techan.NewCandle(techan.NewTimePeriod(time.Unix(int64(i*60), 0), time.Minute))
+		candle.OpenPrice, candle.MaxPrice, candle.MinPrice, candle.ClosePrice = big.NewDecimal(c[0]), big.NewDecimal(c[1]), big.NewDecimal(c[2]), big.NewDecimal(c[3])
+		candles = append(candles, candle)
+	}
+	bt := &Backtest{
+		Symbol:   "ETHUSDT",
+		Risk:     100,
+		Leverage: 1,
+		Bracket:  Bracket{StopPercent: 5},
+		Scaling:  Scaling{Targets: []Target{{R: 1, Percent: 50}}},
+	}
+	_, record := bt.Run(func(series *techan.TimeSeries) (long, short techan.RuleStrategy) {
+		long = techan.RuleStrategy{EntryRule: constantRule(true), ExitRule: constantRule(false)}
+		short = techan.RuleStrategy{EntryRule: constantRule(false), ExitRule: constantRule(false)}
+		return long, short
+	}, CandleChannel(candles))
+
+	// 1 is entered at 100, half of it is taken at 105 and the rest is stopped at 95.
+	if len(record.Trades) != 2 {
+		t.Fatalf("expected 2 trades, got %d", len(record.Trades))
+	}
+	for i, expect := range []struct{ amount, exit float64 }{{0.5, 105}, {0.5, 95}} {
+		trade := record.Trades[i]
+		if trade.EntranceOrder().Amount.Float() != expect.amount || trade.ExitOrder().Price.Float() != expect.exit {
+			t.Errorf("trade %d: expected %f exited at %f, got %s at %s", i, expect.amount, expect.exit, trade.EntranceOrder().Amount, trade.ExitOrder().Price)
+		}
+	}
+}
+
+func TestScaling_Validate(t *testing.T) {
+	s := Scaling{Targets: []Target{{Gain: 2, Percent: 50}, {R: 1, Percent: 50}}}
+	if err := s.Validate(false); err == nil {
+		t.Errorf("expected an R target without a stop loss to be rejected")
+	}
+	if err := s.Validate(true); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := (Scaling{Targets: []Target{{Gain: 2, Percent: 50}}}).Validate(false); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,198 @@
+package internal
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/MShoaei/techan"
+	"github.com/adshao/go-binance/v2"
+	"github.com/sdcoffey/big"
+)
+
+// SizeContext is the state of an account when the amount of a new position is calculated.
+type SizeContext struct {
+	Side  techan.OrderSide
+	Price big.Decimal
+	// Equity is the starting capital and the net profit of the closed trades.
+	Equity   float64
+	Leverage int
+	// Stop is the stop loss level of the position. it is zero if the position has no stop loss.
+	Stop big.Decimal
+	// ATR is the average true range on the entry candle.
+	ATR    big.Decimal
+	Record *techan.TradingRecord
+	Fees   FeeModel
+}
+
+// Sizer calculates the amount of new positions. A zero amount skips the entry.
+type Sizer interface {
+	Size(ctx SizeContext) big.Decimal
+}
+
+// FixedSizer uses Margin USD of margin for every position regardless of the equity.
+type FixedSizer struct {
+	Margin float64
+}
+
+// Size returns the amount worth Margin with leverage.
+func (s FixedSizer) Size(ctx SizeContext) big.Decimal {
+	return notional(s.Margin, ctx)
+}
+
+// EquitySizer uses Percent percent of the equity as the margin of every position, so the positions grow and shrink
+// with the profit of the account.
+type EquitySizer struct {
+	Percent float64
+}
+
+// Size returns the amount worth Percent of the equity with leverage.
+func (s EquitySizer) Size(ctx SizeContext) big.Decimal {
+	return notional(ctx.Equity*s.Percent*0.01, ctx)
+}
+
+// FixedFractionalSizer sizes positions to lose Percent percent of the equity if their stop loss is hit.
+// Entries without a stop loss are skipped.
+type FixedFractionalSizer struct {
+	Percent float64
+}
+
+// Size returns the amount which loses Percent of the equity at the stop loss.
+func (s FixedFractionalSizer) Size(ctx SizeContext) big.Decimal {
+	if ctx.Stop.NaN() || ctx.Stop.Zero() {
+		return big.ZERO
+	}
+	distance := ctx.Price.Sub(ctx.Stop).Abs()
+	if distance.Zero() {
+		return big.ZERO
+	}
+	return big.NewDecimal(ctx.Equity * s.Percent * 0.01).Div(distance)
+}
+
+// VolatilitySizer sizes positions so a move of Multiplier ATR changes the equity by Percent percent.
+type VolatilitySizer struct {
+	Percent    float64
+	Multiplier float64
+}
+
+// Size returns the amount which changes the equity by Percent on a move of Multiplier ATR.
+func (s VolatilitySizer) Size(ctx SizeContext) big.Decimal {
+	if ctx.ATR.NaN() {
+		return big.ZERO
+	}
+	multiplier := s.Multiplier
+	if multiplier <= 0 {
+		multiplier = 1
+	}
+	move := ctx.ATR.Mul(big.NewDecimal(multiplier))
+	if move.LTE(big.ZERO) {
+		return big.ZERO
+	}
+	return big.NewDecimal(ctx.Equity * s.Percent * 0.01).Div(move)
+}
+
+// KellySizer uses Fraction of the Kelly criterion of the closed trades, capped to Cap percent, as the margin in
+// percent of the equity. Percent percent is used until MinTrades trades are closed.
+type KellySizer struct {
+	Fraction  float64
+	Cap       float64
+	MinTrades int
+	Percent   float64
+}
+
+// Size returns the amount worth the Kelly fraction of the equity with leverage.
+func (s KellySizer) Size(ctx SizeContext) big.Decimal {
+	trades := ctx.Record.Trades
+	if len(trades) < s.MinTrades || len(trades) == 0 {
+		return notional(ctx.Equity*s.Percent*0.01, ctx)
+	}
+
+	var wins, win, loss float64
+	for _, trade := range trades {
+		profit := ctx.Fees.NetProfit(trade).Float()
+		if profit > 0 {
+			wins++
+			win += profit
+		} else {
+			loss -= profit
+		}
+	}
+	winRate := wins / float64(len(trades))
+	if wins == float64(len(trades)) || loss == 0 {
+		return notional(ctx.Equity*s.Cap*0.01, ctx)
+	}
+	if wins == 0 {
+		return big.ZERO
+	}
+	payoff := (win / wins) / (loss / (float64(len(trades)) - wins))
+	kelly := winRate - (1-winRate)/payoff
+	if kelly <= 0 {
+		return big.ZERO
+	}
+	fraction := s.Fraction
+	if fraction <= 0 {
+		fraction = 1
+	}
+	return notional(ctx.Equity*math.Min(kelly*fraction*100, s.Cap)*0.01, ctx)
+}
+
+// notional returns the amount of a position using margin USD of margin.
+func notional(margin float64, ctx SizeContext) big.Decimal {
+	if margin <= 0 || ctx.Price.Zero() {
+		return big.ZERO
+	}
+	return big.NewDecimal(margin).Mul(big.NewFromInt(ctx.Leverage)).Div(ctx.Price)
+}
+
+// LotSize are the quantity limits of a symbol. The zero value rounds down to 3 decimals without limits.
+type LotSize struct {
+	Step float64
+	Min  float64
+	Max  float64
+}
+
+// NewLotSize returns the LotSize of a binance lot size filter.
+func NewLotSize(filter *binance.LotSizeFilter) (LotSize, error) {
+	var ls LotSize
+	if filter == nil {
+		return ls, nil
+	}
+	for _, v := range []struct {
+		value  string
+		target *float64
+	}{{filter.StepSize, &ls.Step}, {filter.MinQuantity, &ls.Min}, {filter.MaxQuantity, &ls.Max}} {
+		if _, err := fmt.Sscan(v.value, v.target); err != nil {
+			return ls, fmt.Errorf("invalid lot size filter %+v: %v", *filter, err)
+		}
+	}
+	return ls, nil
+}
+
+// Round rounds amount down to a multiple of the step size. Amounts under the minimum are rounded to zero and
+// amounts over the maximum are capped.
+func (ls LotSize) Round(amount big.Decimal) big.Decimal {
+	step := ls.Step
+	if step <= 0 {
+		step = 0.001
+	}
+	value := amount.Float()
+	if ls.Max > 0 {
+		value = math.Min(value, ls.Max)
+	}
+	// the small epsilon keeps amounts which are already a multiple of step from being rounded a step down.
+	steps := math.Floor(value/step + 1e-9)
+	rounded := big.NewFromString(big.NewDecimal(steps).Mul(big.NewDecimal(step)).FormattedString(decimals(step)))
+	if rounded.Float() < ls.Min || rounded.LTE(big.ZERO) {
+		return big.ZERO
+	}
+	return rounded
+}
+
+// decimals returns the number of decimals of step.
+func decimals(step float64) int {
+	n := 0
+	for n < 10 && math.Abs(step-math.Round(step)) > 1e-12 {
+		step *= 10
+		n++
+	}
+	return n
+}
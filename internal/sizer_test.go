@@ -0,0 +1,55 @@
+package internal
+
+import (
+	"testing"
+
+	"github.com/MShoaei/techan"
+	"github.com/adshao/go-binance/v2"
+	"github.com/sdcoffey/big"
+)
+
+func TestLotSize_Round(t *testing.T) {
+	ls, err := NewLotSize(&binance.LotSizeFilter{StepSize: "0.01000000", MinQuantity: "0.05000000", MaxQuantity: "10.00000000"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[float64]float64{
+		1.239: 1.23,
+		0.3:   0.3,
+		0.049: 0,
+		25:    10,
+	}
+	for amount, expect := range cases {
+		if got := ls.Round(big.NewDecimal(amount)).Float(); got != expect {
+			t.Errorf("round %f: expected %f, got %f", amount, expect, got)
+		}
+	}
+}
+
+func TestSizers(t *testing.T) {
+	ctx := SizeContext{
+		Side:     techan.BUY,
+		Price:    big.NewDecimal(100),
+		Equity:   1000,
+		Leverage: 2,
+		Stop:     big.NewDecimal(95),
+		ATR:      big.NewDecimal(4),
+		Record:   techan.NewTradingRecord(),
+	}
+	cases := []struct {
+		name   string
+		sizer  Sizer
+		expect float64
+	}{
+		{"fixed", FixedSizer{Margin: 50}, 1},
+		{"equity", EquitySizer{Percent: 10}, 2},
+		{"fractional", FixedFractionalSizer{Percent: 1}, 2},
+		{"volatility", VolatilitySizer{Percent: 1, Multiplier: 2.5}, 1},
+		{"kelly without trades", KellySizer{Percent: 5, MinTrades: 10, Cap: 25}, 1},
+	}
+	for _, c := range cases {
+		if got := c.sizer.Size(ctx).Float(); got != c.expect {
+			t.Errorf("%s: expected %f, got %f", c.name, c.expect, got)
+		}
+	}
+}
@@ -0,0 +1,446 @@
+package internal
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/MShoaei/techan"
+	"gopkg.in/yaml.v2"
+)
+
+// StrategySpec is a strategy described in YAML or JSON instead of Go. It is compiled into a
+// MultiTimeframeStrategyFunc by Compile. e.g.
+//
+//	name: ema-cross
+//	unstable: 200
+//	timeframes:
+//	  trend: 4h
+//	indicators:
+//	  fast: {type: ema, window: 50}
+//	  slow: {type: ema, window: 200}
+//	  trend_close: {type: close, timeframe: trend}
+//	  trend_ema: {type: ema, input: trend_close, window: 50, timeframe: trend}
+//	long:
+//	  entry:
+//	    and:
+//	      - over: [close, fast]
+//	      - over: [fast, slow]
+//	      - over: [trend_close, trend_ema]
+//	  exit:
+//	    under: [close, slow]
+type StrategySpec struct {
+	Name string `yaml:"name"`
+	// Unstable is the number of candles both sides wait before entering.
+	Unstable int `yaml:"unstable"`
+	// Timeframes maps the names of the higher timeframe series used by the indicators to their binance interval.
+	Timeframes map[string]string `yaml:"timeframes"`
+	// Indicators are the indicators of the strategy by name. the close, open, high, low and volume prices of the
+	// candles can be used without declaring them.
+	Indicators map[string]IndicatorSpec `yaml:"indicators"`
+	// Long and Short are the rules of the sides. a side without an entry rule is never entered.
+	Long  SideSpec `yaml:"long"`
+	Short SideSpec `yaml:"short"`
+}
+
+// IndicatorSpec describes an indicator of a StrategySpec. Only the parameters used by its Type are read.
+type IndicatorSpec struct {
+	Type string `yaml:"type"`
+	// Input is the name of the indicator it is calculated on. it defaults to the close price.
+	Input string `yaml:"input"`
+	// Inputs are the two indicators of the difference, min and max types.
+	Inputs []string `yaml:"inputs"`
+	// Timeframe is the name of the higher timeframe series it is calculated on. its inputs must use the same one.
+	Timeframe string  `yaml:"timeframe"`
+	Window    int     `yaml:"window"`
+	Fast      int     `yaml:"fast"`
+	Slow      int     `yaml:"slow"`
+	Signal    int     `yaml:"signal"`
+	Sigma     float64 `yaml:"sigma"`
+	// Shift is the number of candles the shift type looks back.
+	Shift int     `yaml:"shift"`
+	Value float64 `yaml:"value"`
+}
+
+// SideSpec holds the rules of a side of a StrategySpec. A side without an exit rule is only closed by the bracket.
+type SideSpec struct {
+	Entry *RuleSpec `yaml:"entry"`
+	Exit  *RuleSpec `yaml:"exit"`
+}
+
+// RuleSpec is a node of a rule tree. Exactly one of its fields must be set. The comparisons take two operands,
+// which are names of indicators or numbers. CrossUp is satisfied when the first operand crosses above the second
+// one and CrossDown when it crosses below it.
+type RuleSpec struct {
+	And       []RuleSpec `yaml:"and"`
+	Or        []RuleSpec `yaml:"or"`
+	Not       *RuleSpec  `yaml:"not"`
+	Over      []string   `yaml:"over"`
+	Under     []string   `yaml:"under"`
+	CrossUp   []string   `yaml:"cross_up"`
+	CrossDown []string   `yaml:"cross_down"`
+}
+
+// indicatorType is a type of indicator of a StrategySpec.
+type indicatorType struct {
+	// inputs is the number of input indicators. indicators without inputs are calculated on the candles.
+	inputs int
+	// positive are the parameters which must be positive.
+	positive []string
+	// create returns the indicator on the series of its timeframe and its resolved inputs.
+	create func(series *techan.TimeSeries, s IndicatorSpec, in []techan.Indicator) techan.Indicator
+}
+
+// indicatorTypes are the indicator types of a StrategySpec by name.
+var indicatorTypes = map[string]indicatorType{
+	"close": {0, nil, func(series *techan.TimeSeries, _ IndicatorSpec, _ []techan.Indicator) techan.Indicator {
+		return techan.NewClosePriceIndicator(series)
+	}},
+	"open": {0, nil, func(series *techan.TimeSeries, _ IndicatorSpec, _ []techan.Indicator) techan.Indicator {
+		return techan.NewOpenPriceIndicator(series)
+	}},
+	"high": {0, nil, func(series *techan.TimeSeries, _ IndicatorSpec, _ []techan.Indicator) techan.Indicator {
+		return techan.NewHighPriceIndicator(series)
+	}},
+	"low": {0, nil, func(series *techan.TimeSeries, _ IndicatorSpec, _ []techan.Indicator) techan.Indicator {
+		return techan.NewLowPriceIndicator(series)
+	}},
+	"volume": {0, nil, func(series *techan.TimeSeries, _ IndicatorSpec, _ []techan.Indicator) techan.Indicator {
+		return techan.NewVolumeIndicator(series)
+	}},
+	"constant": {0, nil, func(_ *techan.TimeSeries, s IndicatorSpec, _ []techan.Indicator) techan.Indicator {
+		return techan.NewConstantIndicator(s.Value)
+	}},
+	"atr": {0, []string{"window"}, func(series *techan.TimeSeries, s IndicatorSpec, _ []techan.Indicator) techan.Indicator {
+		return techan.NewAverageTrueRangeIndicator(series, s.Window)
+	}},
+	"cci": {0, []string{"window"}, func(series *techan.TimeSeries, s IndicatorSpec, _ []techan.Indicator) techan.Indicator {
+		return techan.NewCCIIndicator(series, s.Window)
+	}},
+	"ema": {1, []string{"window"}, func(_ *techan.TimeSeries, s IndicatorSpec, in []techan.Indicator) techan.Indicator {
+		return techan.NewEMAIndicator(in[0], s.Window)
+	}},
+	"sma": {1, []string{"window"}, func(_ *techan.TimeSeries, s IndicatorSpec, in []techan.Indicator) techan.Indicator {
+		return techan.NewSimpleMovingAverage(in[0], s.Window)
+	}},
+	"mma": {1, []string{"window"}, func(_ *techan.TimeSeries, s IndicatorSpec, in []techan.Indicator) techan.Indicator {
+		return techan.NewMMAIndicator(in[0], s.Window)
+	}},
+	"rsi": {1, []string{"window"}, func(_ *techan.TimeSeries, s IndicatorSpec, in []techan.Indicator) techan.Indicator {
+		return techan.NewRelativeStrengthIndexIndicator(in[0], s.Window)
+	}},
+	"macd": {1, []string{"fast", "slow"}, func(_ *techan.TimeSeries, s IndicatorSpec, in []techan.Indicator) techan.Indicator {
+		return techan.NewMACDIndicator(in[0], s.Fast, s.Slow)
+	}},
+	"macd_histogram": {1, []string{"signal"}, func(_ *techan.TimeSeries, s IndicatorSpec, in []techan.Indicator) techan.Indicator {
+		return techan.NewMACDHistogramIndicator(in[0], s.Signal)
+	}},
+	"bollinger_upper": {1, []string{"window", "sigma"}, func(_ *techan.TimeSeries, s IndicatorSpec, in []techan.Indicator) techan.Indicator {
+		return techan.NewBollingerUpperBandIndicator(in[0], s.Window, s.Sigma)
+	}},
+	"bollinger_lower": {1, []string{"window", "sigma"}, func(_ *techan.TimeSeries, s IndicatorSpec, in []techan.Indicator) techan.Indicator {
+		return techan.NewBollingerLowerBandIndicator(in[0], s.Window, s.Sigma)
+	}},
+	"stochastic": {1, []string{"window"}, func(series *techan.TimeSeries, s IndicatorSpec, in []techan.Indicator) techan.Indicator {
+		return NewFastStochasticIndicator(in[0], series, s.Window)
+	}},
+	"slow_stochastic": {1, []string{"window"}, func(_ *techan.TimeSeries, s IndicatorSpec, in []techan.Indicator) techan.Indicator {
+		return techan.NewSlowStochasticIndicator(in[0], s.Window)
+	}},
+	"highest": {1, []string{"window"}, func(_ *techan.TimeSeries, s IndicatorSpec, in []techan.Indicator) techan.Indicator {
+		return techan.NewMaximumValueIndicator(in[0], s.Window)
+	}},
+	"lowest": {1, []string{"window"}, func(_ *techan.TimeSeries, s IndicatorSpec, in []techan.Indicator) techan.Indicator {
+		return techan.NewMinimumValueIndicator(in[0], s.Window)
+	}},
+	"shift": {1, []string{"shift"}, func(_ *techan.TimeSeries, s IndicatorSpec, in []techan.Indicator) techan.Indicator {
+		return NewDispositionIndicator(in[0], -s.Shift)
+	}},
+	"difference": {2, nil, func(_ *techan.TimeSeries, _ IndicatorSpec, in []techan.Indicator) techan.Indicator {
+		return techan.NewDifferenceIndicator(in[0], in[1])
+	}},
+	"min": {2, nil, func(_ *techan.TimeSeries, _ IndicatorSpec, in []techan.Indicator) techan.Indicator {
+		return NewMinimumIndicator(in[0], in[1])
+	}},
+	"max": {2, nil, func(_ *techan.TimeSeries, _ IndicatorSpec, in []techan.Indicator) techan.Indicator {
+		return NewMaximumIndicator(in[0], in[1])
+	}},
+}
+
+// prices are the indicators which can be used without declaring them.
+var prices = map[string]bool{"close": true, "open": true, "high": true, "low": true, "volume": true}
+
+// param returns the value of the parameter name of s.
+func (s IndicatorSpec) param(name string) float64 {
+	switch name {
+	case "window":
+		return float64(s.Window)
+	case "fast":
+		return float64(s.Fast)
+	case "slow":
+		return float64(s.Slow)
+	case "signal":
+		return float64(s.Signal)
+	case "sigma":
+		return s.Sigma
+	case "shift":
+		return float64(s.Shift)
+	}
+	return s.Value
+}
+
+// ReadStrategySpec reads a StrategySpec in YAML or JSON from input and checks that it compiles.
+func ReadStrategySpec(input io.Reader) (StrategySpec, error) {
+	var spec StrategySpec
+	b, err := ioutil.ReadAll(input)
+	if err != nil {
+		return spec, err
+	}
+	if err := yaml.UnmarshalStrict(b, &spec); err != nil {
+		return spec, err
+	}
+	if _, err := spec.Compile(); err != nil {
+		return spec, err
+	}
+	return spec, nil
+}
+
+// Compile returns the strategy described by s. The strategy must be given the higher timeframe series of
+// s.Timeframes.
+func (s StrategySpec) Compile() (MultiTimeframeStrategyFunc, error) {
+	if s.Long.Entry == nil && s.Short.Entry == nil {
+		return nil, fmt.Errorf("strategy %q has no entry rule", s.Name)
+	}
+	// build the strategy on empty series to report the errors of s before it is used.
+	series := techan.NewTimeSeries()
+	timeframes := make(map[string]Timeframe, len(s.Timeframes))
+	for name, interval := range s.Timeframes {
+		period, err := IntervalDuration(interval)
+		if err != nil {
+			return nil, fmt.Errorf("timeframe %s: %v", name, err)
+		}
+		timeframes[name] = Timeframe{Period: period}
+	}
+	if _, _, err := s.build(series, newHigherSeriesMap(timeframes, series)); err != nil {
+		return nil, err
+	}
+	return func(series *techan.TimeSeries, higher map[string]*HigherSeries) (long, short techan.RuleStrategy) {
+		long, short, err := s.build(series, higher)
+		if err != nil {
+			// s compiled, so only a missing higher timeframe series can fail.
+			panic(err)
+		}
+		return long, short
+	}, nil
+}
+
+func (s StrategySpec) build(series *techan.TimeSeries, higher map[string]*HigherSeries) (long, short techan.RuleStrategy, err error) {
+	c := specCompiler{
+		spec:     s,
+		series:   series,
+		higher:   higher,
+		built:    make(map[string]techan.Indicator),
+		building: make(map[string]bool),
+	}
+	if long, err = c.side("long", s.Long); err != nil {
+		return long, short, err
+	}
+	short, err = c.side("short", s.Short)
+	return long, short, err
+}
+
+// specCompiler builds the indicators and rules of a StrategySpec.
+type specCompiler struct {
+	spec   StrategySpec
+	series *techan.TimeSeries
+	higher map[string]*HigherSeries
+	// built are the indicators built on the series of their timeframe by name.
+	built    map[string]techan.Indicator
+	building map[string]bool
+}
+
+func (c *specCompiler) side(name string, side SideSpec) (techan.RuleStrategy, error) {
+	strategy := techan.RuleStrategy{EntryRule: FalseRule{}, ExitRule: FalseRule{}, UnstablePeriod: c.spec.Unstable}
+	if side.Entry == nil {
+		if side.Exit != nil {
+			return strategy, fmt.Errorf("%s: exit rule without an entry rule", name)
+		}
+		return strategy, nil
+	}
+	var err error
+	if strategy.EntryRule, err = c.rule(*side.Entry); err != nil {
+		return strategy, fmt.Errorf("%s entry: %v", name, err)
+	}
+	if side.Exit != nil {
+		if strategy.ExitRule, err = c.rule(*side.Exit); err != nil {
+			return strategy, fmt.Errorf("%s exit: %v", name, err)
+		}
+	}
+	return strategy, nil
+}
+
+func (c *specCompiler) rule(r RuleSpec) (techan.Rule, error) {
+	set := 0
+	for _, ok := range []bool{r.And != nil, r.Or != nil, r.Not != nil, r.Over != nil, r.Under != nil, r.CrossUp != nil, r.CrossDown != nil} {
+		if ok {
+			set++
+		}
+	}
+	if set != 1 {
+		return nil, fmt.Errorf("a rule must have exactly one of and, or, not, over, under, cross_up or cross_down")
+	}
+
+	switch {
+	case r.And != nil, r.Or != nil:
+		rules, combine := r.And, techan.And
+		if r.Or != nil {
+			rules, combine = r.Or, techan.Or
+		}
+		if len(rules) == 0 {
+			return nil, fmt.Errorf("and and or need at least one rule")
+		}
+		result, err := c.rule(rules[0])
+		if err != nil {
+			return nil, err
+		}
+		for _, spec := range rules[1:] {
+			rule, err := c.rule(spec)
+			if err != nil {
+				return nil, err
+			}
+			result = combine(result, rule)
+		}
+		return result, nil
+	case r.Not != nil:
+		rule, err := c.rule(*r.Not)
+		if err != nil {
+			return nil, err
+		}
+		return techan.Not(rule), nil
+	}
+
+	operands, kind := r.Over, "over"
+	switch {
+	case r.Under != nil:
+		operands, kind = r.Under, "under"
+	case r.CrossUp != nil:
+		operands, kind = r.CrossUp, "cross_up"
+	case r.CrossDown != nil:
+		operands, kind = r.CrossDown, "cross_down"
+	}
+	if len(operands) != 2 {
+		return nil, fmt.Errorf("%s needs 2 operands, got %d", kind, len(operands))
+	}
+	first, err := c.operand(operands[0])
+	if err != nil {
+		return nil, err
+	}
+	second, err := c.operand(operands[1])
+	if err != nil {
+		return nil, err
+	}
+	switch kind {
+	case "over":
+		return techan.OverIndicatorRule{First: first, Second: second}, nil
+	case "under":
+		return techan.UnderIndicatorRule{First: first, Second: second}, nil
+	case "cross_up":
+		return techan.NewCrossUpIndicatorRule(second, first), nil
+	}
+	return techan.NewCrossDownIndicatorRule(first, second), nil
+}
+
+// operand returns the indicator named by operand aligned to the base series, or a constant if it is a number.
+func (c *specCompiler) operand(operand string) (techan.Indicator, error) {
+	if value, err := strconv.ParseFloat(operand, 64); err == nil {
+		return techan.NewConstantIndicator(value), nil
+	}
+	timeframe := c.spec.Indicators[operand].Timeframe
+	indicator, err := c.indicator(operand, "")
+	if err != nil || timeframe == "" {
+		return indicator, err
+	}
+	return c.higher[timeframe].Indicator(indicator), nil
+}
+
+// indicator returns the indicator named name built on the series of its timeframe. timeframe is the timeframe of
+// the indicator using it as an input, which is used by the undeclared price indicators.
+func (c *specCompiler) indicator(name, timeframe string) (techan.Indicator, error) {
+	spec, ok := c.spec.Indicators[name]
+	if !ok {
+		if !prices[name] {
+			return nil, fmt.Errorf("unknown indicator %q", name)
+		}
+		spec = IndicatorSpec{Type: name, Timeframe: timeframe}
+		name = timeframe + "." + name
+	}
+	if indicator, ok := c.built[name]; ok {
+		return indicator, nil
+	}
+	if c.building[name] {
+		return nil, fmt.Errorf("indicator %q depends on itself", name)
+	}
+	c.building[name] = true
+	defer delete(c.building, name)
+
+	indicator, err := c.build(spec)
+	if err != nil {
+		return nil, fmt.Errorf("indicator %q: %v", name, err)
+	}
+	c.built[name] = indicator
+	return indicator, nil
+}
+
+func (c *specCompiler) build(spec IndicatorSpec) (techan.Indicator, error) {
+	t, ok := indicatorTypes[spec.Type]
+	if !ok {
+		types := make([]string, 0, len(indicatorTypes))
+		for name := range indicatorTypes {
+			types = append(types, name)
+		}
+		sort.Strings(types)
+		return nil, fmt.Errorf("unknown type %q. expected one of %s", spec.Type, strings.Join(types, ", "))
+	}
+	for _, name := range t.positive {
+		if spec.param(name) <= 0 {
+			return nil, fmt.Errorf("%s needs a positive %s", spec.Type, name)
+		}
+	}
+	series := c.series
+	if spec.Timeframe != "" {
+		h, ok := c.higher[spec.Timeframe]
+		if !ok {
+			return nil, fmt.Errorf("unknown timeframe %q", spec.Timeframe)
+		}
+		series = h.TimeSeries
+	}
+
+	var names []string
+	switch t.inputs {
+	case 1:
+		names = []string{spec.Input}
+		if spec.Input == "" {
+			names = []string{"close"}
+		}
+	case 2:
+		if len(spec.Inputs) != 2 {
+			return nil, fmt.Errorf("%s needs 2 inputs, got %d", spec.Type, len(spec.Inputs))
+		}
+		names = spec.Inputs
+	}
+	inputs := make([]techan.Indicator, 0, len(names))
+	for _, name := range names {
+		if declared, ok := c.spec.Indicators[name]; ok && declared.Timeframe != spec.Timeframe {
+			return nil, fmt.Errorf("input %q is on another timeframe", name)
+		}
+		input, err := c.indicator(name, spec.Timeframe)
+		if err != nil {
+			return nil, err
+		}
+		inputs = append(inputs, input)
+	}
+	return t.create(series, spec, inputs), nil
+}
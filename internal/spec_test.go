@@ -0,0 +1,95 @@
+package internal
+
+import (
+	"math"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/MShoaei/techan"
+	"github.com/sdcoffey/big"
+)
+
+const emaSpec = `
+name: ema
+unstable: 20
+indicators:
+  fast: {type: ema, window: 5}
+  slow: {type: ema, window: 20}
+long:
+  entry:
+    and:
+      - over: [close, fast]
+      - over: [fast, slow]
+  exit:
+    under: [close, slow]
+short:
+  entry:
+    and:
+      - under: [close, fast]
+      - under: [fast, slow]
+  exit:
+    over: [close, slow]
+`
+
+func TestStrategySpec_Compile(t *testing.T) {
+	var candles []*techan.Candle
+	for i := 0; i < 300; i++ {
+		price := 100 + 10*math.Sin(float64(i)/15) + float64(i%7)
+		candle := techan.NewCandle(techan.NewTimePeriod(time.Unix(int64(i*60), 0), time.Minute))
+		candle.OpenPrice, candle.MaxPrice, candle.MinPrice, candle.ClosePrice = big.NewDecimal(price), big.NewDecimal(price+1), big.NewDecimal(price-1), big.NewDecimal(price)
+		candles = append(candles, candle)
+	}
+
+	spec, err := ReadStrategySpec(strings.NewReader(emaSpec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := spec.Compile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bt := &Backtest{Symbol: "ETHUSDT", Risk: 10, Leverage: 1}
+	_, got := bt.RunMultiTimeframe(f, CandleChannel(candles))
+	_, expect := bt.Run(NewEMAStrategy(Params{"fast": 5, "slow": 20}), CandleChannel(candles))
+
+	if len(got.Trades) == 0 || len(got.Trades) != len(expect.Trades) {
+		t.Fatalf("expected %d trades, got %d", len(expect.Trades), len(got.Trades))
+	}
+	for i := range expect.Trades {
+		e, g := expect.Trades[i].EntranceOrder(), got.Trades[i].EntranceOrder()
+		if e.Side != g.Side || !e.ExecutionTime.Equal(g.ExecutionTime) {
+			t.Errorf("trade %d: expected %s at %s, got %s at %s", i, sideName(e.Side), e.ExecutionTime, sideName(g.Side), g.ExecutionTime)
+		}
+	}
+}
+
+func TestReadStrategySpec_Errors(t *testing.T) {
+	for _, tt := range []struct {
+		name, spec, err string
+	}{
+		{"no entry", `name: empty`, "no entry rule"},
+		{"unknown indicator", `long: {entry: {over: [close, missing]}}`, `unknown indicator "missing"`},
+		{"unknown type", `{indicators: {x: {type: foo}}, long: {entry: {over: [close, x]}}}`, `unknown type "foo"`},
+		{"missing window", `{indicators: {x: {type: ema}}, long: {entry: {over: [close, x]}}}`, "positive window"},
+		{"cycle", `{indicators: {a: {type: ema, window: 2, input: b}, b: {type: ema, window: 2, input: a}}, long: {entry: {over: [close, a]}}}`, "depends on itself"},
+		{"two rules", `long: {entry: {over: [close, 1], under: [close, 2]}}`, "exactly one"},
+		{"operands", `long: {entry: {cross_up: [close]}}`, "2 operands"},
+		{"timeframe", `{indicators: {x: {type: close, timeframe: trend}}, long: {entry: {over: [close, x]}}}`, `unknown timeframe "trend"`},
+		{"unknown field", `{long: {entry: {over: [close, 1]}}, exit: {}}`, "not found"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ReadStrategySpec(strings.NewReader(tt.spec))
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("expected an error containing %q, got %v", tt.err, err)
+			}
+		})
+	}
+
+	// json is read as well and numbers are constants.
+	spec := `{"timeframes": {"trend": "4h"}, "indicators": {"trend_close": {"type": "close", "timeframe": "trend"}},
+		"long": {"entry": {"and": [{"over": ["trend_close", 100]}, {"cross_up": ["close", "trend_close"]}]}}}`
+	if _, err := ReadStrategySpec(strings.NewReader(spec)); err != nil {
+		t.Errorf("expected the json spec to compile, got %v", err)
+	}
+}
@@ -9,145 +9,265 @@ import (
 
 type DynamicStrategyFunc func(*techan.TimeSeries) (long, short techan.RuleStrategy)
 
-//type StaticStrategyFunc func(*techan.TimeSeries) (long, short techan.Rule)
+// StaticStrategyFunc creates a strategy whose positions are closed by a Bracket.
+// atr is the indicator used for ATR based bracket levels.
+type StaticStrategyFunc func(*techan.TimeSeries) (long, short techan.RuleStrategy, atr techan.Indicator)
+
+// Params holds the named numeric parameters of a strategy.
+type Params map[string]float64
+
+// With returns a copy of p with the values in overrides replacing its own.
+func (p Params) With(overrides Params) Params {
+	params := make(Params, len(p)+len(overrides))
+	for name, value := range p {
+		params[name] = value
+	}
+	for name, value := range overrides {
+		params[name] = value
+	}
+	return params
+}
+
+// Int returns the value of the parameter name rounded to the nearest int.
+func (p Params) Int(name string) int {
+	return int(math.Round(p[name]))
+}
+
+// ParamStrategyFunc creates a DynamicStrategyFunc using the given parameters.
+// parameters which are not set use their default value.
+type ParamStrategyFunc func(Params) DynamicStrategyFunc
+
+// BollingerStochDefaults are the default parameters of NewBollingerStochStrategy.
+var BollingerStochDefaults = Params{
+	"bb_window":    20,
+	"bb_sigma":     2,
+	"stoch_window": 14,
+	"stoch_smooth": 3,
+	"oversold":     20,
+	"overbought":   80,
+}
 
 func CreateBollingerStochStrategy(series *techan.TimeSeries) (long, short techan.RuleStrategy) {
-	closePrice := techan.NewClosePriceIndicator(series)
+	return NewBollingerStochStrategy(nil)(series)
+}
 
-	bbUpper := techan.NewBollingerUpperBandIndicator(closePrice, 20, 2)
-	bbLower := techan.NewBollingerLowerBandIndicator(closePrice, 20, 2)
+func NewBollingerStochStrategy(p Params) DynamicStrategyFunc {
+	p = BollingerStochDefaults.With(p)
+	return func(series *techan.TimeSeries) (long, short techan.RuleStrategy) {
+		closePrice := techan.NewClosePriceIndicator(series)
 
-	stoch := techan.NewSlowStochasticIndicator(techan.NewFastStochasticIndicator(series, 14), 3)
+		bbUpper := techan.NewBollingerUpperBandIndicator(closePrice, p.Int("bb_window"), p["bb_sigma"])
+		bbLower := techan.NewBollingerLowerBandIndicator(closePrice, p.Int("bb_window"), p["bb_sigma"])
 
-	longEntrySignal := techan.And(techan.UnderIndicatorRule{First: stoch, Second: techan.NewConstantIndicator(20)}, techan.NewCrossUpIndicatorRule(bbLower, closePrice))
-	longExitSignal := techan.Or(
-		techan.OverIndicatorRule{First: stoch, Second: techan.NewConstantIndicator(80)},
-		techan.OverIndicatorRule{First: closePrice, Second: bbUpper},
-	)
-	long = techan.RuleStrategy{
-		EntryRule:      longEntrySignal,
-		ExitRule:       longExitSignal,
-		UnstablePeriod: 100,
-	}
+		stoch := techan.NewSlowStochasticIndicator(techan.NewFastStochasticIndicator(series, p.Int("stoch_window")), p.Int("stoch_smooth"))
+		oversold := techan.NewConstantIndicator(p["oversold"])
+		overbought := techan.NewConstantIndicator(p["overbought"])
 
-	shortEntrySignal := techan.And(techan.OverIndicatorRule{First: stoch, Second: techan.NewConstantIndicator(80)}, techan.NewCrossDownIndicatorRule(closePrice, bbUpper))
-	shortExitSignal := techan.Or(
-		techan.OverIndicatorRule{First: stoch, Second: techan.NewConstantIndicator(80)},
-		techan.OverIndicatorRule{First: closePrice, Second: bbUpper},
-	)
-	short = techan.RuleStrategy{
-		EntryRule:      shortEntrySignal,
-		ExitRule:       shortExitSignal,
-		UnstablePeriod: 100,
+		longEntrySignal := techan.And(techan.UnderIndicatorRule{First: stoch, Second: oversold}, techan.NewCrossUpIndicatorRule(bbLower, closePrice))
+		longExitSignal := techan.Or(
+			techan.OverIndicatorRule{First: stoch, Second: overbought},
+			techan.OverIndicatorRule{First: closePrice, Second: bbUpper},
+		)
+		long = techan.RuleStrategy{
+			EntryRule:      longEntrySignal,
+			ExitRule:       longExitSignal,
+			UnstablePeriod: 100,
+		}
+
+		shortEntrySignal := techan.And(techan.OverIndicatorRule{First: stoch, Second: overbought}, techan.NewCrossDownIndicatorRule(closePrice, bbUpper))
+		shortExitSignal := techan.Or(
+			techan.UnderIndicatorRule{First: stoch, Second: oversold},
+			techan.UnderIndicatorRule{First: closePrice, Second: bbLower},
+		)
+		short = techan.RuleStrategy{
+			EntryRule:      shortEntrySignal,
+			ExitRule:       shortExitSignal,
+			UnstablePeriod: 100,
+		}
+		return long, short
 	}
-	return long, short
+}
+
+// MACDDefaults are the default parameters of NewMACDStrategy.
+var MACDDefaults = Params{
+	"fast":   12,
+	"slow":   26,
+	"signal": 9,
 }
 
 func CreateMACDStrategy(series *techan.TimeSeries) (long, short techan.RuleStrategy) {
-	closePrice := techan.NewClosePriceIndicator(series)
-	macd := techan.NewMACDIndicator(closePrice, 12, 26)
-	macdHist := techan.NewMACDHistogramIndicator(macd, 9)
+	return NewMACDStrategy(nil)(series)
+}
 
-	long = techan.RuleStrategy{
-		EntryRule:      techan.NewCrossUpIndicatorRule(techan.NewConstantIndicator(0), macdHist),
-		ExitRule:       techan.NewCrossDownIndicatorRule(macdHist, techan.NewConstantIndicator(0)),
-		UnstablePeriod: 100,
-	}
-	short = techan.RuleStrategy{
-		EntryRule:      techan.NewCrossDownIndicatorRule(macdHist, techan.NewConstantIndicator(0)),
-		ExitRule:       techan.NewCrossUpIndicatorRule(techan.NewConstantIndicator(0), macdHist),
-		UnstablePeriod: 100,
+func NewMACDStrategy(p Params) DynamicStrategyFunc {
+	p = MACDDefaults.With(p)
+	return func(series *techan.TimeSeries) (long, short techan.RuleStrategy) {
+		closePrice := techan.NewClosePriceIndicator(series)
+		macd := techan.NewMACDIndicator(closePrice, p.Int("fast"), p.Int("slow"))
+		macdHist := techan.NewMACDHistogramIndicator(macd, p.Int("signal"))
+
+		long = techan.RuleStrategy{
+			EntryRule:      techan.NewCrossUpIndicatorRule(techan.NewConstantIndicator(0), macdHist),
+			ExitRule:       techan.NewCrossDownIndicatorRule(macdHist, techan.NewConstantIndicator(0)),
+			UnstablePeriod: 100,
+		}
+		short = techan.RuleStrategy{
+			EntryRule:      techan.NewCrossDownIndicatorRule(macdHist, techan.NewConstantIndicator(0)),
+			ExitRule:       techan.NewCrossUpIndicatorRule(techan.NewConstantIndicator(0), macdHist),
+			UnstablePeriod: 100,
+		}
+		return long, short
 	}
-	return long, short
+}
+
+// EMADefaults are the default parameters of NewEMAStrategy.
+var EMADefaults = Params{
+	"fast": 50,
+	"slow": 200,
 }
 
 func CreateEMAStrategy(series *techan.TimeSeries) (long, short techan.RuleStrategy) {
-	closePrice := techan.NewClosePriceIndicator(series)
-	ema200 := techan.NewEMAIndicator(closePrice, 200)
-	ema50 := techan.NewEMAIndicator(closePrice, 50)
+	return NewEMAStrategy(nil)(series)
+}
 
-	long = techan.RuleStrategy{
-		EntryRule: techan.And(
-			techan.OverIndicatorRule{First: closePrice, Second: ema50},
-			techan.OverIndicatorRule{First: ema50, Second: ema200},
-		),
-		ExitRule:       techan.UnderIndicatorRule{First: closePrice, Second: ema200},
-		UnstablePeriod: 200,
+func NewEMAStrategy(p Params) DynamicStrategyFunc {
+	p = EMADefaults.With(p)
+	return func(series *techan.TimeSeries) (long, short techan.RuleStrategy) {
+		closePrice := techan.NewClosePriceIndicator(series)
+		emaSlow := techan.NewEMAIndicator(closePrice, p.Int("slow"))
+		emaFast := techan.NewEMAIndicator(closePrice, p.Int("fast"))
+
+		long = techan.RuleStrategy{
+			EntryRule: techan.And(
+				techan.OverIndicatorRule{First: closePrice, Second: emaFast},
+				techan.OverIndicatorRule{First: emaFast, Second: emaSlow},
+			),
+			ExitRule:       techan.UnderIndicatorRule{First: closePrice, Second: emaSlow},
+			UnstablePeriod: p.Int("slow"),
+		}
+		short = techan.RuleStrategy{
+			EntryRule: techan.And(
+				techan.UnderIndicatorRule{First: closePrice, Second: emaFast},
+				techan.UnderIndicatorRule{First: emaFast, Second: emaSlow},
+			),
+			ExitRule:       techan.OverIndicatorRule{First: closePrice, Second: emaSlow},
+			UnstablePeriod: p.Int("slow"),
+		}
+		return long, short
 	}
-	short = techan.RuleStrategy{
-		EntryRule: techan.And(
-			techan.UnderIndicatorRule{First: closePrice, Second: ema50},
-			techan.UnderIndicatorRule{First: ema50, Second: ema200},
-		),
-		ExitRule:       techan.OverIndicatorRule{First: closePrice, Second: ema200},
-		UnstablePeriod: 200,
+}
+
+// EMATrendDefaults are the default parameters of NewEMATrendStrategy.
+var EMATrendDefaults = EMADefaults.With(Params{"trend": 50})
+
+func CreateEMATrendStrategy(series *techan.TimeSeries, higher map[string]*HigherSeries) (long, short techan.RuleStrategy) {
+	return NewEMATrendStrategy(nil)(series, higher)
+}
+
+// NewEMATrendStrategy returns the EMA strategy which only enters in the direction of the trend of the higher
+// timeframe series named trend. The trend is up while the close of that series is over its EMA of the trend window.
+// It trades like the EMA strategy if there is no trend series.
+func NewEMATrendStrategy(p Params) MultiTimeframeStrategyFunc {
+	p = EMATrendDefaults.With(p)
+	return func(series *techan.TimeSeries, higher map[string]*HigherSeries) (long, short techan.RuleStrategy) {
+		long, short = NewEMAStrategy(p)(series)
+		trend, ok := higher["trend"]
+		if !ok {
+			return long, short
+		}
+		trendClose := techan.NewClosePriceIndicator(trend.TimeSeries)
+		trendEMA := techan.NewEMAIndicator(trendClose, p.Int("trend"))
+		long.EntryRule = techan.And(long.EntryRule, techan.OverIndicatorRule{
+			First:  trend.Indicator(trendClose),
+			Second: trend.Indicator(trendEMA),
+		})
+		short.EntryRule = techan.And(short.EntryRule, techan.UnderIndicatorRule{
+			First:  trend.Indicator(trendClose),
+			Second: trend.Indicator(trendEMA),
+		})
+		return long, short
 	}
-	return long, short
+}
+
+// IchimokuDefaults are the default parameters of NewIchimokuStrategy.
+var IchimokuDefaults = Params{
+	"conversion":   9,
+	"base":         26,
+	"span_b":       52,
+	"displacement": 26,
 }
 
 func CreateIchimokuStrategy(series *techan.TimeSeries) (long, short techan.RuleStrategy) {
-	closePrice := techan.NewClosePriceIndicator(series)
-	conv := NewConversionLineIndicator(series, 9)
-	base := NewBaseLineIndicator(series, 26)
-	spanA := NewLeadingSpanAIndicator(conv.(conversionLineIndicator), base.(baseLineIndicator))
-	spanB := NewLeadingSpanBIndicator(series, 52)
-	laggingSpan := NewLaggingSpanIndicator(series)
+	return NewIchimokuStrategy(nil)(series)
+}
 
-	longRule1 := techan.And(
-		techan.OverIndicatorRule{First: closePrice, Second: NewDispositionIndicator(spanA, -26)},
-		techan.OverIndicatorRule{First: closePrice, Second: NewDispositionIndicator(spanB, -26)},
-	)
-	longRule2 := techan.OverIndicatorRule{First: spanA, Second: spanB}
-	longRule3 := techan.OverIndicatorRule{First: conv, Second: base}
-	longRule4 := techan.And(
-		techan.OverIndicatorRule{First: laggingSpan, Second: NewDispositionIndicator(spanA, -52)},
-		techan.OverIndicatorRule{First: laggingSpan, Second: NewDispositionIndicator(spanB, -52)},
-	)
-	long = techan.RuleStrategy{
-		EntryRule: techan.And(
-			longRule1,
-			techan.And(longRule2,
-				techan.And(longRule3, longRule4),
+func NewIchimokuStrategy(p Params) DynamicStrategyFunc {
+	p = IchimokuDefaults.With(p)
+	return func(series *techan.TimeSeries) (long, short techan.RuleStrategy) {
+		displacement := p.Int("displacement")
+		closePrice := techan.NewClosePriceIndicator(series)
+		conv := NewConversionLineIndicator(series, p.Int("conversion"))
+		base := NewBaseLineIndicator(series, p.Int("base"))
+		spanA := NewLeadingSpanAIndicator(conv.(conversionLineIndicator), base.(baseLineIndicator))
+		spanB := NewLeadingSpanBIndicator(series, p.Int("span_b"))
+		laggingSpan := NewLaggingSpanIndicator(series)
+
+		longRule1 := techan.And(
+			techan.OverIndicatorRule{First: closePrice, Second: NewDispositionIndicator(spanA, -displacement)},
+			techan.OverIndicatorRule{First: closePrice, Second: NewDispositionIndicator(spanB, -displacement)},
+		)
+		longRule2 := techan.OverIndicatorRule{First: spanA, Second: spanB}
+		longRule3 := techan.OverIndicatorRule{First: conv, Second: base}
+		longRule4 := techan.And(
+			techan.OverIndicatorRule{First: laggingSpan, Second: NewDispositionIndicator(spanA, -2*displacement)},
+			techan.OverIndicatorRule{First: laggingSpan, Second: NewDispositionIndicator(spanB, -2*displacement)},
+		)
+		long = techan.RuleStrategy{
+			EntryRule: techan.And(
+				longRule1,
+				techan.And(longRule2,
+					techan.And(longRule3, longRule4),
+				),
 			),
-		),
-		ExitRule: techan.Or(
-			techan.UnderIndicatorRule{First: laggingSpan, Second: NewDispositionIndicator(closePrice, -26)},
-			techan.UnderIndicatorRule{
-				First: closePrice,
-				Second: NewMinimumIndicator(
-					NewDispositionIndicator(spanA, -26),
-					NewDispositionIndicator(spanB, -26)),
-			}),
-		UnstablePeriod: 100,
-	}
-	shortRule1 := techan.And(
-		techan.UnderIndicatorRule{First: closePrice, Second: NewDispositionIndicator(spanA, -26)},
-		techan.UnderIndicatorRule{First: closePrice, Second: NewDispositionIndicator(spanB, -26)},
-	)
-	shortRule2 := techan.UnderIndicatorRule{First: spanA, Second: spanB}
-	shortRule3 := techan.UnderIndicatorRule{First: conv, Second: base}
-	shortRule4 := techan.And(
-		techan.UnderIndicatorRule{First: laggingSpan, Second: NewDispositionIndicator(spanA, -52)},
-		techan.UnderIndicatorRule{First: laggingSpan, Second: NewDispositionIndicator(spanB, -52)},
-	)
-	short = techan.RuleStrategy{
-		EntryRule: techan.And(
-			shortRule1,
-			techan.And(shortRule2,
-				techan.And(shortRule3, shortRule4),
+			ExitRule: techan.Or(
+				techan.UnderIndicatorRule{First: laggingSpan, Second: NewDispositionIndicator(closePrice, -displacement)},
+				techan.UnderIndicatorRule{
+					First: closePrice,
+					Second: NewMinimumIndicator(
+						NewDispositionIndicator(spanA, -displacement),
+						NewDispositionIndicator(spanB, -displacement)),
+				}),
+			UnstablePeriod: 100,
+		}
+		shortRule1 := techan.And(
+			techan.UnderIndicatorRule{First: closePrice, Second: NewDispositionIndicator(spanA, -displacement)},
+			techan.UnderIndicatorRule{First: closePrice, Second: NewDispositionIndicator(spanB, -displacement)},
+		)
+		shortRule2 := techan.UnderIndicatorRule{First: spanA, Second: spanB}
+		shortRule3 := techan.UnderIndicatorRule{First: conv, Second: base}
+		shortRule4 := techan.And(
+			techan.UnderIndicatorRule{First: laggingSpan, Second: NewDispositionIndicator(spanA, -2*displacement)},
+			techan.UnderIndicatorRule{First: laggingSpan, Second: NewDispositionIndicator(spanB, -2*displacement)},
+		)
+		short = techan.RuleStrategy{
+			EntryRule: techan.And(
+				shortRule1,
+				techan.And(shortRule2,
+					techan.And(shortRule3, shortRule4),
+				),
 			),
-		),
-		ExitRule: techan.Or(
-			techan.OverIndicatorRule{First: laggingSpan, Second: NewDispositionIndicator(closePrice, -26)},
-			techan.OverIndicatorRule{
-				First: closePrice,
-				Second: NewMinimumIndicator(
-					NewDispositionIndicator(spanA, -26),
-					NewDispositionIndicator(spanB, -26)),
-			}),
-		UnstablePeriod: 100,
+			ExitRule: techan.Or(
+				techan.OverIndicatorRule{First: laggingSpan, Second: NewDispositionIndicator(closePrice, -displacement)},
+				techan.OverIndicatorRule{
+					First: closePrice,
+					Second: NewMaximumIndicator(
+						NewDispositionIndicator(spanA, -displacement),
+						NewDispositionIndicator(spanB, -displacement)),
+				}),
+			UnstablePeriod: 100,
+		}
+		return long, short
 	}
-	return long, short
 }
 
 func CreateEMAStochATRStrategy(series *techan.TimeSeries) (long, short techan.RuleStrategy, atr techan.Indicator) {
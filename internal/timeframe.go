@@ -0,0 +1,146 @@
+package internal
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/MShoaei/techan"
+	"github.com/sdcoffey/big"
+)
+
+// MultiTimeframeStrategyFunc creates a strategy trading the candles of series which may also use the higher
+// timeframe series in higher. The indicators of a higher series must be aligned to series using its Indicator method.
+type MultiTimeframeStrategyFunc func(series *techan.TimeSeries, higher map[string]*HigherSeries) (long, short techan.RuleStrategy)
+
+// SingleTimeframe returns f as a MultiTimeframeStrategyFunc which ignores the higher timeframe series.
+func SingleTimeframe(f DynamicStrategyFunc) MultiTimeframeStrategyFunc {
+	return func(series *techan.TimeSeries, _ map[string]*HigherSeries) (long, short techan.RuleStrategy) {
+		return f(series)
+	}
+}
+
+// Timeframe describes a higher timeframe series of a strategy. The series starts with Candles and is extended by
+// aggregating the candles of the base series into candles of Period. Either of them may be empty.
+type Timeframe struct {
+	Period  time.Duration
+	Candles []*techan.Candle
+}
+
+// HigherSeries is a series of a higher timeframe than the base series of a strategy. Its candles are only added once
+// they are closed, so a strategy never sees a higher timeframe candle before its close.
+type HigherSeries struct {
+	*techan.TimeSeries
+	base    *techan.TimeSeries
+	period  time.Duration
+	pending *techan.Candle
+}
+
+// newHigherSeries returns the series described by tf alongside base.
+func (tf Timeframe) newHigherSeries(base *techan.TimeSeries) *HigherSeries {
+	series := techan.NewTimeSeries()
+	for _, candle := range tf.Candles {
+		series.AddCandle(candle)
+	}
+	return &HigherSeries{TimeSeries: series, base: base, period: tf.Period}
+}
+
+// newHigherSeriesMap returns the higher series of timeframes alongside base.
+func newHigherSeriesMap(timeframes map[string]Timeframe, base *techan.TimeSeries) map[string]*HigherSeries {
+	higher := make(map[string]*HigherSeries, len(timeframes))
+	for name, tf := range timeframes {
+		higher[name] = tf.newHigherSeries(base)
+	}
+	return higher
+}
+
+// Update aggregates a closed candle of the base series. Candles covered by the candles the series started with are
+// ignored.
+func (h *HigherSeries) Update(candle *techan.Candle) {
+	if h.period <= 0 {
+		return
+	}
+	if last := h.LastCandle(); last != nil && !candle.Period.Start.After(last.Period.End) {
+		return
+	}
+
+	start := candle.Period.Start.Truncate(h.period)
+	if h.pending != nil && !h.pending.Period.Start.Equal(start) {
+		// the base series had a gap over the end of the pending candle.
+		h.AddCandle(h.pending)
+		h.pending = nil
+	}
+	if h.pending == nil {
+		h.pending = &techan.Candle{
+			Period:     techan.TimePeriod{Start: start, End: candle.Period.End},
+			OpenPrice:  candle.OpenPrice,
+			ClosePrice: candle.ClosePrice,
+			MaxPrice:   candle.MaxPrice,
+			MinPrice:   candle.MinPrice,
+			Volume:     candle.Volume,
+			TradeCount: candle.TradeCount,
+		}
+	} else {
+		h.pending.Period.End = candle.Period.End
+		h.pending.ClosePrice = candle.ClosePrice
+		h.pending.MaxPrice = big.MaxSlice(h.pending.MaxPrice, candle.MaxPrice)
+		h.pending.MinPrice = big.MinSlice(h.pending.MinPrice, candle.MinPrice)
+		h.pending.Volume = h.pending.Volume.Add(candle.Volume)
+		h.pending.TradeCount += candle.TradeCount
+	}
+
+	// binance candles end a millisecond before the next one starts.
+	if !candle.Period.End.Add(time.Millisecond).Before(start.Add(h.period)) {
+		h.AddCandle(h.pending)
+		h.pending = nil
+	}
+}
+
+// Indicator returns indicator, calculated on the higher series, as an indicator of the base series.
+// The value on a base candle is the value on the last higher candle which closed no later than it.
+func (h *HigherSeries) Indicator(indicator techan.Indicator) techan.Indicator {
+	return alignedIndicator{higher: h, indicator: indicator}
+}
+
+// index returns the index of the last higher candle closed at the end of the base candle at index, or -1.
+func (h *HigherSeries) index(index int) int {
+	end := h.base.Candles[index].Period.End
+	candles := h.Candles
+	return sort.Search(len(candles), func(i int) bool { return candles[i].Period.End.After(end) }) - 1
+}
+
+type alignedIndicator struct {
+	higher    *HigherSeries
+	indicator techan.Indicator
+}
+
+func (a alignedIndicator) Calculate(index int) big.Decimal {
+	i := a.higher.index(index)
+	if i < 0 {
+		return big.ZERO
+	}
+	return a.indicator.Calculate(i)
+}
+
+// IntervalDuration returns the duration of a binance kline interval such as 15m, 4h or 1d.
+func IntervalDuration(interval string) (time.Duration, error) {
+	if len(interval) < 2 {
+		return 0, fmt.Errorf("invalid interval: %s", interval)
+	}
+	n, err := strconv.Atoi(interval[:len(interval)-1])
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid interval: %s", interval)
+	}
+	units := map[byte]time.Duration{
+		'm': time.Minute,
+		'h': time.Hour,
+		'd': 24 * time.Hour,
+		'w': 7 * 24 * time.Hour,
+	}
+	unit, ok := units[interval[len(interval)-1]]
+	if !ok {
+		return 0, fmt.Errorf("invalid interval: %s", interval)
+	}
+	return time.Duration(n) * unit, nil
+}
@@ -0,0 +1,46 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/MShoaei/techan"
+	"github.com/sdcoffey/big"
+)
+
+func TestHigherSeries_Update(t *testing.T) {
+	base := techan.NewTimeSeries()
+	h := Timeframe{Period: time.Hour}.newHigherSeries(base)
+	closePrice := h.Indicator(techan.NewClosePriceIndicator(h.TimeSeries))
+
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 6; i++ {
+		candle := techan.NewCandle(techan.TimePeriod{
+			Start: start.Add(time.Duration(i) * 30 * time.Minute),
+			End:   start.Add(time.Duration(i+1)*30*time.Minute - time.Millisecond),
+		})
+		candle.OpenPrice = big.NewDecimal(float64(i))
+		candle.ClosePrice = big.NewDecimal(float64(i + 1))
+		candle.MaxPrice = big.NewDecimal(float64(i + 2))
+		candle.MinPrice = big.NewDecimal(float64(i))
+		candle.Volume = big.NewDecimal(1)
+		base.AddCandle(candle)
+		h.Update(candle)
+
+		if got := closePrice.Calculate(i).Float(); i%2 == 0 && got != float64(i) {
+			t.Errorf("candle %d: expected the close of the last closed hour %d, got %f", i, i, got)
+		}
+	}
+
+	if len(h.Candles) != 3 {
+		t.Fatalf("expected 3 candles, got %d", len(h.Candles))
+	}
+	candle := h.Candles[1]
+	if candle.OpenPrice.Float() != 2 || candle.ClosePrice.Float() != 4 || candle.MaxPrice.Float() != 5 ||
+		candle.MinPrice.Float() != 2 || candle.Volume.Float() != 2 {
+		t.Errorf("unexpected candle %v", candle)
+	}
+	if got := closePrice.Calculate(3).Float(); got != 4 {
+		t.Errorf("expected the hour to be visible on its last candle, got %f", got)
+	}
+}
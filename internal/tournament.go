@@ -0,0 +1,90 @@
+package internal
+
+import (
+	"runtime"
+	"sort"
+	"sync"
+
+	"github.com/MShoaei/techan"
+)
+
+// Entrant is a strategy taking part in a tournament. Run runs it in the backtest bt.
+type Entrant struct {
+	Name string
+	Run  func(bt *Backtest, candleC <-chan *techan.Candle) (*techan.TimeSeries, *techan.TradingRecord)
+}
+
+// Market holds the candles of a symbol.
+type Market struct {
+	Symbol  string
+	Candles []*techan.Candle
+}
+
+// Standing is the result of a strategy on a market of a tournament. Rank is its rank among the strategies run on
+// the same market.
+type Standing struct {
+	Strategy string  `json:"strategy"`
+	Symbol   string  `json:"symbol"`
+	Rank     int     `json:"rank"`
+	Metrics  Metrics `json:"metrics"`
+}
+
+// Tournament runs every strategy on every market.
+type Tournament struct {
+	// Backtest is used as the template of every backtest. its Symbol is set to the symbol of the market.
+	Backtest Backtest
+	// Workers is the number of backtests run concurrently. it defaults to the number of CPUs.
+	Workers int
+}
+
+// Run runs entrants on markets and returns the standings of every market, from the best to the worst score of
+// objective, in the order of markets.
+func (t Tournament) Run(entrants []Entrant, markets []Market, objective string) ([]Standing, error) {
+	if _, err := (Metrics{}).Score(objective); err != nil {
+		return nil, err
+	}
+	standings := make([]Standing, len(entrants)*len(markets))
+
+	workers := t.Workers
+	if workers <= 0 {
+		workers = runtime.NumCPU()
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobs {
+				market, entrant := markets[job/len(entrants)], entrants[job%len(entrants)]
+				bt := t.Backtest
+				bt.Symbol = market.Symbol
+				bt.Fees = bt.Fees.fresh()
+				_, record := entrant.Run(&bt, CandleChannel(market.Candles))
+				standings[job] = Standing{
+					Strategy: entrant.Name,
+					Symbol:   market.Symbol,
+					Metrics:  NewMetrics(record, bt.Fees),
+				}
+			}
+		}()
+	}
+	for i := range standings {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	for i := 0; i < len(standings); i += len(entrants) {
+		market := standings[i : i+len(entrants)]
+		sort.SliceStable(market, func(a, b int) bool {
+			x, _ := market[a].Metrics.Score(objective)
+			y, _ := market[b].Metrics.Score(objective)
+			return x > y
+		})
+		for rank := range market {
+			market[rank].Rank = rank + 1
+		}
+	}
+	return standings, nil
+}
@@ -0,0 +1,62 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/MShoaei/techan"
+	"github.com/sdcoffey/big"
+)
+
+// fixedEntrant drains the candles and makes a single trade with a profit of profit, or -profit on the symbol
+// LOSS.
+func fixedEntrant(name string, profit float64) Entrant {
+	return Entrant{
+		Name: name,
+		Run: func(bt *Backtest, candleC <-chan *techan.Candle) (*techan.TimeSeries, *techan.TradingRecord) {
+			series := techan.NewTimeSeries()
+			for candle := range candleC {
+				series.AddCandle(candle)
+			}
+			exit := 100 + profit
+			if bt.Symbol == "LOSS" {
+				exit = 100 - profit
+			}
+			start := time.Unix(0, 0)
+			record := techan.NewTradingRecord()
+			record.Operate(techan.Order{Side: techan.BUY, Price: big.NewDecimal(100), Amount: big.ONE, ExecutionTime: start})
+			record.Operate(techan.Order{Side: techan.SELL, Price: big.NewDecimal(exit), Amount: big.ONE, ExecutionTime: start.Add(time.Minute)})
+			return series, record
+		},
+	}
+}
+
+func TestTournament_Run(t *testing.T) {
+	entrants := []Entrant{fixedEntrant("small", 1), fixedEntrant("large", 5), fixedEntrant("medium", 3)}
+	markets := []Market{{Symbol: "WIN"}, {Symbol: "LOSS"}}
+	tournament := Tournament{Backtest: Backtest{Fees: FlatFee(0)}, Workers: 2}
+
+	standings, err := tournament.Run(entrants, markets, "profit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []struct {
+		symbol, strategy string
+	}{
+		{"WIN", "large"}, {"WIN", "medium"}, {"WIN", "small"},
+		{"LOSS", "small"}, {"LOSS", "medium"}, {"LOSS", "large"},
+	}
+	if len(standings) != len(expect) {
+		t.Fatalf("expected %d standings, got %d", len(expect), len(standings))
+	}
+	for i, e := range expect {
+		s := standings[i]
+		if s.Symbol != e.symbol || s.Strategy != e.strategy || s.Rank != i%3+1 {
+			t.Errorf("standing %d: expected %d. %s on %s, got %d. %s on %s", i, i%3+1, e.strategy, e.symbol, s.Rank, s.Strategy, s.Symbol)
+		}
+	}
+
+	if _, err := tournament.Run(entrants, markets, "unknown"); err == nil {
+		t.Error("expected an error for an unknown objective")
+	}
+}
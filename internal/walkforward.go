@@ -0,0 +1,82 @@
+package internal
+
+import (
+	"fmt"
+
+	"github.com/MShoaei/techan"
+)
+
+// WalkForward optimizes a strategy on rolling in-sample windows and trades the best parameters of each
+// window on the out-of-sample window that follows it.
+type WalkForward struct {
+	Optimizer Optimizer
+	Objective string
+	// InSample and OutSample are the number of candles in the in-sample and out-of-sample windows.
+	// The windows move forward by OutSample candles so the out-of-sample windows never overlap.
+	// The last out-of-sample window is shorter when the candles left after it are fewer than OutSample.
+	InSample  int
+	OutSample int
+}
+
+// WalkForwardWindow is the result of a single step of a walk-forward analysis.
+type WalkForwardWindow struct {
+	InSample         techan.TimePeriod     `json:"inSample"`
+	OutSample        techan.TimePeriod     `json:"outSample"`
+	Params           Params                `json:"params"`
+	InSampleMetrics  Metrics               `json:"inSampleMetrics"`
+	OutSampleMetrics Metrics               `json:"outSampleMetrics"`
+	Record           *techan.TradingRecord `json:"-"`
+}
+
+// Run runs the walk-forward analysis of the strategy created by f over candles.
+// It returns the result of every window and the out-of-sample trades of all windows merged into one record.
+// Positions still open at the end of an out-of-sample window are closed at the close price of its last candle.
+func (wf WalkForward) Run(f ParamStrategyFunc, grid Grid, candles []*techan.Candle) ([]WalkForwardWindow, *techan.TradingRecord, error) {
+	if wf.InSample <= 0 || wf.OutSample <= 0 {
+		return nil, nil, fmt.Errorf("in-sample and out-of-sample windows must be positive")
+	}
+	if len(candles) < wf.InSample+wf.OutSample {
+		return nil, nil, fmt.Errorf("%d candles are not enough for a single window", len(candles))
+	}
+
+	windows := make([]WalkForwardWindow, 0)
+	records := make([]*techan.TradingRecord, 0)
+	for start := 0; start+wf.InSample < len(candles); start += wf.OutSample {
+		end := start + wf.InSample + wf.OutSample
+		if end > len(candles) {
+			end = len(candles)
+		}
+		inSample := candles[start : start+wf.InSample]
+		outSample := candles[start+wf.InSample : end]
+
+		results := wf.Optimizer.Run(f, grid, inSample)
+		if err := RankResults(results, wf.Objective); err != nil {
+			return nil, nil, err
+		}
+		best := results[0]
+
+		// the in-sample candles are fed first so the indicators are warmed up when trading starts.
+		bt := wf.Optimizer.Backtest
+		bt.Start = outSample[0].Period.Start
+		_, record := bt.Run(f(best.Params), CandleChannel(candles[start:end]))
+		bt.Close(record, outSample[len(outSample)-1])
+
+		windows = append(windows, WalkForwardWindow{
+			InSample:         periodOf(inSample),
+			OutSample:        periodOf(outSample),
+			Params:           best.Params,
+			InSampleMetrics:  best.Metrics,
+			OutSampleMetrics: NewMetrics(record, bt.Fees),
+			Record:           record,
+		})
+		records = append(records, record)
+	}
+	return windows, MergeRecords(records...), nil
+}
+
+func periodOf(candles []*techan.Candle) techan.TimePeriod {
+	return techan.TimePeriod{
+		Start: candles[0].Period.Start,
+		End:   candles[len(candles)-1].Period.End,
+	}
+}
@@ -0,0 +1,97 @@
+package internal
+
+import (
+	"testing"
+	"time"
+
+	"github.com/MShoaei/techan"
+	"github.com/sdcoffey/big"
+)
+
+func TestWalkForward_Run(t *testing.T) {
+	var candles []*techan.Candle
+	for i := 0; i < 11; i++ {
+		candle := techan.NewCandle(techan.NewTimePeriod(time.Unix(int64(i*60), 0), time.Minute))
+		price := big.NewDecimal(float64(100 + i))
+		candle.OpenPrice, candle.MaxPrice, candle.MinPrice, candle.ClosePrice = price, price, price, price
+		candles = append(candles, candle)
+	}
+	f := func(Params) DynamicStrategyFunc {
+		return func(series *techan.TimeSeries) (long, short techan.RuleStrategy) {
+			long = techan.RuleStrategy{EntryRule: constantRule(true), ExitRule: constantRule(false)}
+			short = techan.RuleStrategy{EntryRule: constantRule(false), ExitRule: constantRule(false)}
+			return long, short
+		}
+	}
+	wf := WalkForward{
+		Optimizer: Optimizer{Backtest: Backtest{Symbol: "ETHUSDT", Risk: 10, Leverage: 1, Fees: FlatFee(0)}, Workers: 1},
+		Objective: "profit",
+		InSample:  4,
+		OutSample: 3,
+	}
+
+	windows, record, err := wf.Run(f, Grid{"x": {1, 2}}, candles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the last window only has the single candle left after the second one.
+	expect := []struct{ inStart, inEnd, outStart, outEnd int }{{0, 3, 4, 6}, {3, 6, 7, 9}, {6, 9, 10, 10}}
+	if len(windows) != len(expect) {
+		t.Fatalf("expected %d windows, got %d", len(expect), len(windows))
+	}
+	for i, e := range expect {
+		w := windows[i]
+		if !w.InSample.Start.Equal(candles[e.inStart].Period.Start) || !w.InSample.End.Equal(candles[e.inEnd].Period.End) {
+			t.Errorf("window %d: unexpected in-sample period %s", i, w.InSample)
+		}
+		if !w.OutSample.Start.Equal(candles[e.outStart].Period.Start) || !w.OutSample.End.Equal(candles[e.outEnd].Period.End) {
+			t.Errorf("window %d: unexpected out-of-sample period %s", i, w.OutSample)
+		}
+		for _, trade := range w.Record.Trades {
+			if trade.EntranceOrder().ExecutionTime.Before(w.OutSample.Start) || trade.ExitOrder().ExecutionTime.After(w.OutSample.End) {
+				t.Errorf("window %d: trade outside of the out-of-sample window", i)
+			}
+		}
+	}
+
+	trades := 0
+	for _, w := range windows {
+		trades += len(w.Record.Trades)
+	}
+	if trades == 0 || len(record.Trades) != trades {
+		t.Errorf("expected the merged record to have the %d trades of the windows, got %d", trades, len(record.Trades))
+	}
+	for i := 1; i < len(record.Trades); i++ {
+		if record.Trades[i].EntranceOrder().ExecutionTime.Before(record.Trades[i-1].ExitOrder().ExecutionTime) {
+			t.Errorf("expected the merged trades to be in order")
+		}
+	}
+
+	if _, _, err := wf.Run(f, Grid{"x": {1}}, candles[:4]); err == nil {
+		t.Errorf("expected an error when there are no out-of-sample candles")
+	}
+}
+
+func TestMergeRecords(t *testing.T) {
+	start := time.Unix(0, 0)
+	first, second := techan.NewTradingRecord(), techan.NewTradingRecord()
+	first.Operate(techan.Order{Side: techan.BUY, Price: big.NewDecimal(100), Amount: big.ONE, ExecutionTime: start})
+	first.Operate(techan.Order{Side: techan.SELL, Price: big.NewDecimal(110), Amount: big.ONE, ExecutionTime: start.Add(time.Minute)})
+	second.Operate(techan.Order{Side: techan.SELL, Price: big.NewDecimal(110), Amount: big.ONE, ExecutionTime: start.Add(2 * time.Minute)})
+	second.Operate(techan.Order{Side: techan.BUY, Price: big.NewDecimal(105), Amount: big.ONE, ExecutionTime: start.Add(3 * time.Minute)})
+	second.Operate(techan.Order{Side: techan.BUY, Price: big.NewDecimal(100), Amount: big.ONE, ExecutionTime: start.Add(4 * time.Minute)})
+
+	merged := MergeRecords(first, second)
+	if len(merged.Trades) != 2 || !merged.Trades[0].IsLong() || !merged.Trades[1].IsShort() {
+		t.Fatalf("expected a long and a short trade, got %d trades", len(merged.Trades))
+	}
+	if got := (TotalProfitAnalysis{}).Analyze(merged); got != 15 {
+		t.Errorf("expected a total profit of 15, got %f", got)
+	}
+	if current := merged.CurrentPosition(); !current.IsOpen() || !current.IsLong() {
+		t.Errorf("expected the open position of the last record to be carried over")
+	}
+	if len(MergeRecords().Trades) != 0 {
+		t.Errorf("expected an empty record")
+	}
+}
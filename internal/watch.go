@@ -3,8 +3,8 @@ package internal
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"os"
-	"strings"
 	"time"
 
 	"github.com/MShoaei/techan"
@@ -18,23 +18,27 @@ import (
 func createTimeSeries(klines []*binance.Kline) (series *techan.TimeSeries) {
 	series = techan.NewTimeSeries()
 	for i := 0; i < len(klines); i++ {
-		candle := techan.Candle{
-			Period: techan.TimePeriod{
-				Start: time.Unix(klines[i].OpenTime/1e3, (klines[i].OpenTime%1e3)*1e3),
-				End:   time.Unix(klines[i].CloseTime/1e3, (klines[i].CloseTime%1e3)*1e3),
-			},
-			OpenPrice:  big.NewFromString(klines[i].Open),
-			ClosePrice: big.NewFromString(klines[i].Close),
-			MaxPrice:   big.NewFromString(klines[i].High),
-			MinPrice:   big.NewFromString(klines[i].Low),
-			Volume:     big.NewFromString(klines[i].Volume),
-			TradeCount: uint(klines[i].TradeNum),
-		}
-		series.AddCandle(&candle)
+		series.AddCandle(KlineCandle(klines[i]))
 	}
 	return series
 }
 
+// KlineCandle converts a kline to a candle.
+func KlineCandle(kline *binance.Kline) *techan.Candle {
+	return &techan.Candle{
+		Period: techan.TimePeriod{
+			Start: time.Unix(0, kline.OpenTime*int64(time.Millisecond)),
+			End:   time.Unix(0, kline.CloseTime*int64(time.Millisecond)),
+		},
+		OpenPrice:  big.NewFromString(kline.Open),
+		ClosePrice: big.NewFromString(kline.Close),
+		MaxPrice:   big.NewFromString(kline.High),
+		MinPrice:   big.NewFromString(kline.Low),
+		Volume:     big.NewFromString(kline.Volume),
+		TradeCount: uint(kline.TradeNum),
+	}
+}
+
 func getKlines(symbol, interval string, limit int) (*techan.TimeSeries, error) {
 	klines, err := binance.NewClient("", "").NewKlinesService().
 		Symbol(symbol).
@@ -48,26 +52,6 @@ func getKlines(symbol, interval string, limit int) (*techan.TimeSeries, error) {
 	return createTimeSeries(klines), nil
 }
 
-func calculateAmount(total big.Decimal, price big.Decimal, leverage big.Decimal, filter *binance.LotSizeFilter) big.Decimal {
-	amount := total.Div(price.Div(leverage))
-	str := amount.FormattedString(10)
-
-	return big.NewFromString(str[:len(str)-(10-precision(filter.StepSize))])
-}
-
-func precision(number string) int {
-	if number[0] == '1' {
-		return 0
-	}
-	return strings.IndexByte(number, '1') - 1
-}
-
-func cleanPrecision(num big.Decimal, precision int) string {
-	str := num.FormattedString(10)
-
-	return str[:len(str)-(10-precision)]
-}
-
 type Watchdog struct {
 	Symbol     string
 	Interval   string
@@ -76,6 +60,24 @@ type Watchdog struct {
 	Leverage   int
 	Demo       bool
 	SymbolInfo binance.Symbol
+	// Timeframes maps the names of the higher timeframe series of Strategy to their binance interval.
+	Timeframes map[string]string
+	// Sizer sizes the positions of the watchdog. every position uses Risk USD of margin if it is nil.
+	Sizer Sizer
+	// Capital is the starting equity passed to Sizer.
+	Capital float64
+	// Scaling scales the positions of the watchdog in and out. only its Gain targets are used.
+	Scaling Scaling
+	// Strategy is the strategy traded by the watchdog. only its long side is traded.
+	// the DefaultStrategy is traded if it is nil.
+	Strategy MultiTimeframeStrategyFunc
+	// DCA is the dollar-cost averaging plan traded by the watchdog instead of Strategy if it is set.
+	DCA *DCA
+	// Executor places the orders of the watchdog. the orders are placed on binance if it is nil.
+	Executor Executor
+	// History are the candles the watchdog starts with. the recent klines are downloaded if it is nil,
+	// otherwise the higher timeframe series are only built from History.
+	History []*techan.Candle
 
 	series  *techan.TimeSeries
 	records *techan.TradingRecord
@@ -84,122 +86,100 @@ type Watchdog struct {
 	InterruptCh chan os.Signal
 }
 
+// Watch loads the recent klines of the watchdog and returns the handler of its kline stream, which trades through an
+// Engine placing its orders on binance.
 func (w *Watchdog) Watch(client *binance.Client) (binance.WsKlineHandler, binance.ErrHandler, error) {
-	record := techan.NewTradingRecord()
-	w.records = record
-
-	series, err := getKlines(w.Symbol, w.Interval, 1000)
+	// the watchdog trades without a bracket, so its positions have no stop loss to size or scale them by.
+	if _, ok := w.Sizer.(FixedFractionalSizer); ok {
+		return nil, nil, fmt.Errorf("the fixed fractional sizer needs a stop loss, which the watchdog does not set")
+	}
+	if err := w.Scaling.Validate(false); err != nil {
+		return nil, nil, err
+	}
+	series, err := w.history()
 	if err != nil {
 		return nil, nil, err
 	}
-	w.series = series
+	higher, err := w.higherSeries(series)
+	if err != nil {
+		return nil, nil, err
+	}
+	lotSize, err := NewLotSize(w.SymbolInfo.LotSizeFilter())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	executor := w.Executor
+	if executor == nil {
+		executor = BinanceExecutor{Client: client, SymbolInfo: w.SymbolInfo, Demo: w.Demo}
+	}
+	engine := w.Engine(lotSize, executor)
+	engine.Start(series.Candles, higher)
+	w.series = engine.Series()
+	w.records = engine.Record()
+
+	errHandler := func(err error) {
+		log.Error(err)
+	}
+	return engine.Handle, errHandler, nil
+}
 
-	long, _ := CreateEMAStrategy(series)
+// Engine returns the trading engine of the watchdog which places its orders through executor.
+func (w *Watchdog) Engine(lotSize LotSize, executor Executor) *Engine {
+	return &Engine{
+		Symbol:   w.Symbol,
+		Risk:     w.Risk,
+		Fees:     FlatFee(w.Commission),
+		Leverage: w.Leverage,
+		Capital:  w.Capital,
+		Sizer:    w.Sizer,
+		LotSize:  lotSize,
+		Scaling:  w.Scaling,
+		Strategy: w.Strategy,
+		DCA:      w.DCA,
+		Executor: executor,
+	}
+}
 
-	newCandle := series.LastCandle()
+// history returns the series the watchdog starts with.
+func (w *Watchdog) history() (*techan.TimeSeries, error) {
+	if w.History == nil {
+		return getKlines(w.Symbol, w.Interval, 1000)
+	}
+	series := techan.NewTimeSeries()
+	for _, candle := range w.History {
+		series.AddCandle(candle)
+	}
+	return series, nil
+}
 
-	wsKlineHandler := func(event *binance.WsKlineEvent) {
-		newCandle.OpenPrice = big.NewFromString(event.Kline.Open)
-		newCandle.ClosePrice = big.NewFromString(event.Kline.Close)
-		newCandle.MaxPrice = big.NewFromString(event.Kline.High)
-		newCandle.MinPrice = big.NewFromString(event.Kline.Low)
-		newCandle.Volume = big.NewFromString(event.Kline.Volume)
-		newCandle.TradeCount = uint(event.Kline.TradeNum)
-		log.Debugln(event)
-		if !event.Kline.IsFinal {
-			return
+// higherSeries loads the higher timeframe series of the watchdog alongside series, whose last candle is still open.
+func (w *Watchdog) higherSeries(series *techan.TimeSeries) (map[string]*HigherSeries, error) {
+	higher := make(map[string]*HigherSeries, len(w.Timeframes))
+	for name, interval := range w.Timeframes {
+		period, err := IntervalDuration(interval)
+		if err != nil {
+			return nil, err
 		}
-		if long.ShouldEnter(series.LastIndex(), record) {
-			var (
-				// resp *binance.CreateOrderResponse
-				err error
-			)
-			quantity := calculateAmount(big.NewDecimal(w.Risk), newCandle.ClosePrice, big.NewFromInt(w.Leverage), w.SymbolInfo.LotSizeFilter())
-			price := newCandle.ClosePrice.FormattedString(w.SymbolInfo.QuotePrecision)
-			if !w.Demo {
-				_, err = client.NewCreateOrderService().
-					Symbol(w.Symbol).
-					Side(binance.SideTypeBuy).
-					Type(binance.OrderTypeLimit).
-					Quantity(quantity.String()).
-					TimeInForce(binance.TimeInForceTypeGTC).
-					Price(price).
-					Do(context.Background())
-			} else {
-				err = client.NewCreateOrderService().
-					Symbol(w.Symbol).
-					Side(binance.SideTypeBuy).
-					Type(binance.OrderTypeLimit).
-					Quantity(quantity.String()).
-					TimeInForce(binance.TimeInForceTypeGTC).
-					Price(price).
-					Test(context.Background())
-				log.Infof("%s buy: %v", w.Symbol, err)
-			}
+		var candles []*techan.Candle
+		if w.History == nil {
+			klines, err := getKlines(w.Symbol, interval, 1000)
 			if err != nil {
-				log.Errorf("%s, Qty: %s, Price: %s", w.Symbol, quantity.String(), price)
+				return nil, err
 			}
-			record.Operate(techan.Order{
-				Side:          techan.BUY,
-				Security:      w.Symbol,
-				Price:         newCandle.ClosePrice,
-				Amount:        quantity,
-				ExecutionTime: time.Now(),
-			})
-			log.Infof("%s entering at price: %s", w.Symbol, price)
-		} else if long.ShouldExit(series.LastIndex(), record) {
-			var (
-				// resp *binance.CreateOrderResponse
-				err error
-			)
-			// quantity := calculateAmount(big.NewDecimal(w.Risk), newCandle.ClosePrice, big.NewFromInt(w.Leverage), w.SymbolInfo.LotSizeFilter())
-			openAmount := record.CurrentPosition().EntranceOrder().Amount
-			quantity := openAmount.Sub(openAmount.Mul(big.NewDecimal(w.Commission * 0.01)))
-			cleanQuantity := cleanPrecision(quantity, precision(w.SymbolInfo.LotSizeFilter().StepSize))
-			price := newCandle.ClosePrice.FormattedString(w.SymbolInfo.QuotePrecision)
-			if !w.Demo {
-				_, err = client.NewCreateOrderService().
-					Symbol(w.Symbol).
-					Side(binance.SideTypeSell).
-					Type(binance.OrderTypeLimit).
-					Quantity(cleanQuantity).
-					TimeInForce(binance.TimeInForceTypeGTC).
-					Price(price).
-					Do(context.Background())
-			} else {
-				err = client.NewCreateOrderService().
-					Symbol(w.Symbol).
-					Side(binance.SideTypeSell).
-					Type(binance.OrderTypeLimit).
-					Quantity(cleanQuantity).
-					TimeInForce(binance.TimeInForceTypeGTC).
-					Price(price).
-					Test(context.Background())
+			// the last kline is still open, so it is built from the closed candles of series instead.
+			candles = klines.Candles
+			if len(candles) > 0 {
+				candles = candles[:len(candles)-1]
 			}
-			log.Infof("%s sell: %v", w.Symbol, err)
-			if err != nil {
-				log.Errorf("%s, Qty: %s, Price: %s", w.Symbol, quantity.String(), price)
-				return
-			}
-			record.Operate(techan.Order{
-				Side:          techan.SELL,
-				Security:      w.Symbol,
-				Price:         newCandle.ClosePrice,
-				Amount:        big.NewFromString(cleanQuantity),
-				ExecutionTime: time.Now(),
-			})
-			log.Infof("%s exiting at price: %s", w.Symbol, price)
 		}
-		newCandle = techan.NewCandle(newCandle.Period.Advance(1))
-		if success := series.AddCandle(newCandle); !success {
-			log.Errorln("failed to add candle")
+		h := Timeframe{Period: period, Candles: candles}.newHigherSeries(series)
+		for _, candle := range series.Candles[:series.LastIndex()] {
+			h.Update(candle)
 		}
-		log.Debugln(event)
-	}
-	errHandler := func(err error) {
-		log.Error(err)
+		higher[name] = h
 	}
-	return wsKlineHandler, errHandler, nil
+	return higher, nil
 }
 
 type Report struct {
@@ -212,11 +192,11 @@ type Report struct {
 
 func (w *Watchdog) Report() Report {
 	return Report{
-		TotalProfit:          TotalProfitAnalysis{w.Commission}.Analyze(w.records),
-		CommissionValue:      CommissionAnalysis{w.Commission}.Analyze(w.records),
-		OpenProfit:           OpenPLAnalysis{w.series.LastCandle(), w.Commission}.Analyze(w.records),
+		TotalProfit:          TotalProfitAnalysis{FlatFee(w.Commission)}.Analyze(w.records),
+		CommissionValue:      CommissionAnalysis{FlatFee(w.Commission)}.Analyze(w.records),
+		OpenProfit:           OpenPLAnalysis{w.series.LastCandle(), FlatFee(w.Commission)}.Analyze(w.records),
 		TradeCount:           techan.NumTradesAnalysis{}.Analyze(w.records),
-		ProfitableTradeCount: ProfitableTradesAnalysis{w.Commission}.Analyze(w.records),
+		ProfitableTradeCount: ProfitableTradesAnalysis{FlatFee(w.Commission)}.Analyze(w.records),
 	}
 }
 
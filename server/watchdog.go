@@ -1,6 +1,8 @@
 package server
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"os"
@@ -20,6 +22,21 @@ func (s *Server) CreateWatchdog(c *gin.Context) {
 		Commission float64
 		Leverage   int
 		Demo       bool
+		// Strategy is either the name of a registered strategy or a strategy definition in the format of
+		// internal.StrategySpec. the internal.DefaultStrategy is traded if it is empty.
+		Strategy json.RawMessage
+		// Params override the default parameters of a registered strategy.
+		Params internal.Params
+		// Timeframes are the higher timeframe series of a registered strategy as name: interval.
+		Timeframes map[string]string
+		// DCA is a dollar-cost averaging plan traded instead of the strategy.
+		DCA *struct {
+			Quote      float64
+			Every      string
+			Steps      []float64
+			TakeProfit float64
+			MaxBuys    int
+		}
 	}{}
 	if err := c.BindJSON(&data); err != nil {
 		fail(c, http.StatusBadRequest, err)
@@ -37,9 +54,31 @@ func (s *Server) CreateWatchdog(c *gin.Context) {
 		return
 	}
 
+	// create every strategy and plan before creating any watchdog.
+	strategies := make([]internal.MultiTimeframeStrategyFunc, len(data))
+	timeframes := make([]map[string]string, len(data))
+	plans := make([]*internal.DCA, len(data))
+	for i, d := range data {
+		var err error
+		strategies[i], timeframes[i], err = watchdogStrategy(d.Strategy, d.Params, d.Timeframes)
+		if err == nil && d.DCA != nil {
+			plans[i] = &internal.DCA{Quote: d.DCA.Quote, Steps: d.DCA.Steps, TakeProfit: d.DCA.TakeProfit, MaxBuys: d.DCA.MaxBuys}
+			if d.DCA.Every != "" {
+				plans[i].Every, err = time.ParseDuration(d.DCA.Every)
+			}
+			if err == nil {
+				err = plans[i].Validate()
+			}
+		}
+		if err != nil {
+			fail(c, http.StatusBadRequest, fmt.Errorf("%s: %v", d.Symbol, err))
+			return
+		}
+	}
+
 	created := make([]string, 0, len(data))
 	exists := make([]string, 0, len(data))
-	for _, d := range data {
+	for i, d := range data {
 		if _, ok := user.GetWatchdog(d.Symbol, d.Interval); ok {
 			exists = append(exists, d.Symbol)
 			continue
@@ -60,6 +99,7 @@ func (s *Server) CreateWatchdog(c *gin.Context) {
 
 			InterruptCh: interruptCh,
 		}
+		w.Strategy, w.Timeframes, w.DCA = strategies[i], timeframes[i], plans[i]
 		go func() {
 			wsKlineHandler, errHandler, err := w.Watch(user.Client)
 			if err != nil {
@@ -97,6 +137,45 @@ func (s *Server) CreateWatchdog(c *gin.Context) {
 	})
 }
 
+// watchdogStrategy returns the strategy of a watchdog and its higher timeframes. strategy is either a json string
+// naming a registered strategy or a strategy definition.
+func watchdogStrategy(strategy json.RawMessage, params internal.Params, timeframes map[string]string) (internal.MultiTimeframeStrategyFunc, map[string]string, error) {
+	name := internal.DefaultStrategy
+	if len(strategy) > 0 && strategy[0] != '"' {
+		if len(params) > 0 || len(timeframes) > 0 {
+			return nil, nil, fmt.Errorf("params and timeframes can only be used with a registered strategy")
+		}
+		spec, err := internal.ReadStrategySpec(bytes.NewReader(strategy))
+		if err != nil {
+			return nil, nil, err
+		}
+		f, err := spec.Compile()
+		return f, spec.Timeframes, err
+	}
+	if len(strategy) > 0 {
+		if err := json.Unmarshal(strategy, &name); err != nil {
+			return nil, nil, err
+		}
+	}
+	info, err := internal.LookupStrategy(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	p, err := info.Params(params)
+	if err != nil {
+		return nil, nil, err
+	}
+	names := make([]string, 0, len(timeframes))
+	for name, interval := range timeframes {
+		if _, err := internal.IntervalDuration(interval); err != nil {
+			return nil, nil, err
+		}
+		names = append(names, name)
+	}
+	f, err := info.EngineStrategy(p, names)
+	return f, timeframes, err
+}
+
 func (s *Server) StopWatchdog(c *gin.Context) {
 	symbol := c.Param("symbol")
 	interval := c.Param("interval")